@@ -1,29 +1,99 @@
 package b2
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/benbusby/b2/utils"
 	"io"
 	"log"
 	"net/http"
-	"net/http/httputil"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
 const AuthURLV2 string = "https://api.backblazeb2.com/b2api/v2/b2_authorize_account"
 const AuthURLV3 string = "https://api.backblazeb2.com/b2api/v3/b2_authorize_account"
+const APIAuthorizeAccount = "b2_authorize_account"
+
+// localMetadataDir is the hidden directory within a dummy account's LocalPath
+// used for storing metadata that B2 would normally keep track of (buckets,
+// etc).
+const localMetadataDir = ".b2"
 
 type Service struct {
-	APIURL             string
-	AuthorizationToken string
-	APIVersion         string
-	Dummy              bool
-	LocalPath          string
-	StorageMaximum     int64
-	Logging            bool
+	AccountID               string
+	APIURL                  string
+	DownloadURL             string
+	AuthorizationToken      string
+	APIVersion              string
+	RecommendedPartSize     int64
+	AbsoluteMinimumPartSize int64
+	Dummy                   bool
+	LocalPath               string
+	StorageMaximum          int64
+	Logging                 bool
+
+	// HTTPClient is the client used for every request made by the Service.
+	// If nil, the package-level utils.Client is used instead.
+	HTTPClient *http.Client
+
+	// RetryPolicy determines how failed requests are retried. If nil,
+	// DefaultRetryPolicy is used instead.
+	RetryPolicy *RetryPolicy
+
+	// credentials provides the key used for reauthorizing the account once
+	// its authorization token has expired.
+	credentials CredentialProvider
+
+	// localKeyID is the ID of the key from the dummy account's key registry
+	// that the account was authorized with, if any. Requests made by the
+	// account are limited to the key's capabilities, bucket, and name prefix.
+	localKeyID string
+
+	// authMu guards the fields that are updated when the account is
+	// reauthorized, and reauthMu ensures that only one goroutine
+	// reauthorizes the account at a time.
+	authMu   sync.RWMutex
+	reauthMu sync.Mutex
+}
+
+// Option configures optional settings of a Service when it's authorized.
+type Option func(*Service)
+
+// WithHTTPClient sets the http.Client used for all requests made by the
+// Service, including the authorization request itself. This can be used to
+// change the default timeout, or to use a custom transport or proxy.
+func WithHTTPClient(client *http.Client) Option {
+	return func(b2Service *Service) {
+		b2Service.HTTPClient = client
+	}
+}
+
+// newService creates a Service with each of the provided options applied.
+func newService(opts []Option) *Service {
+	service := &Service{}
+	for _, opt := range opts {
+		opt(service)
+	}
+
+	return service
+}
+
+// httpClient returns the http.Client that should be used for requests made
+// by the Service.
+func (b2Service *Service) httpClient() *http.Client {
+	if b2Service == nil || b2Service.HTTPClient == nil {
+		return utils.Client
+	}
+
+	return b2Service.HTTPClient
 }
 
 type AuthV2 struct {
@@ -67,16 +137,51 @@ type AuthV3 struct {
 	AuthorizationToken                string `json:"authorizationToken"`
 }
 
-func AuthorizeAccount(b2BucketKeyId, b2BucketKey string) (*Service, AuthV3, error) {
-	response, err := InitAuthorization(b2BucketKeyId, b2BucketKey, AuthURLV3)
+func AuthorizeAccount(
+	b2BucketKeyId string,
+	b2BucketKey string,
+	opts ...Option,
+) (*Service, AuthV3, error) {
+	return AuthorizeAccountContext(
+		context.Background(), b2BucketKeyId, b2BucketKey, opts...)
+}
+
+// AuthorizeAccountContext is the same as AuthorizeAccount, but uses the
+// provided context for the authorization request.
+func AuthorizeAccountContext(
+	ctx context.Context,
+	b2BucketKeyId string,
+	b2BucketKey string,
+	opts ...Option,
+) (*Service, AuthV3, error) {
+	service := newService(opts)
+	service.setCredentials(b2BucketKeyId, b2BucketKey)
+
+	auth, err := service.authorizeV3(ctx, b2BucketKeyId, b2BucketKey)
 	if err != nil {
 		return &Service{}, AuthV3{}, err
 	}
 
+	return service, auth, nil
+}
+
+// authorizeV3 authorizes the account using the v3 API, and updates the
+// Service with the new authorization token and API URL.
+func (b2Service *Service) authorizeV3(
+	ctx context.Context,
+	b2BucketKeyId string,
+	b2BucketKey string,
+) (AuthV3, error) {
+	response, err := b2Service.initAuthorization(
+		ctx, b2BucketKeyId, b2BucketKey, AuthURLV3)
+	if err != nil {
+		return AuthV3{}, err
+	}
+
 	var auth AuthV3
 	err = json.NewDecoder(response).Decode(&auth)
 	if err != nil {
-		return &Service{}, AuthV3{}, err
+		return AuthV3{}, err
 	}
 
 	// Trim trailing slash
@@ -85,28 +190,67 @@ func AuthorizeAccount(b2BucketKeyId, b2BucketKey string) (*Service, AuthV3, erro
 		auth.APIInfo.StorageAPI.APIURL = apiURL[0 : len(apiURL)-2]
 	}
 
-	service := &Service{
-		APIURL:             auth.APIInfo.StorageAPI.APIURL,
-		AuthorizationToken: auth.AuthorizationToken,
-		APIVersion:         "v3",
-		Dummy:              false,
-		LocalPath:          "",
-		StorageMaximum:     0,
+	storageAPI := auth.APIInfo.StorageAPI
+
+	b2Service.authMu.Lock()
+	defer b2Service.authMu.Unlock()
+
+	b2Service.AccountID = auth.AccountID
+	b2Service.APIURL = storageAPI.APIURL
+	b2Service.DownloadURL = strings.TrimSuffix(storageAPI.DownloadURL, "/")
+	b2Service.AuthorizationToken = auth.AuthorizationToken
+	b2Service.APIVersion = "v3"
+	b2Service.RecommendedPartSize = int64(storageAPI.RecommendedPartSize)
+	b2Service.AbsoluteMinimumPartSize = int64(storageAPI.AbsoluteMinimumPartSize)
+
+	return auth, nil
+}
+
+func AuthorizeAccountV2(
+	b2BucketKeyId string,
+	b2BucketKey string,
+	opts ...Option,
+) (*Service, AuthV2, error) {
+	return AuthorizeAccountV2Context(
+		context.Background(), b2BucketKeyId, b2BucketKey, opts...)
+}
+
+// AuthorizeAccountV2Context is the same as AuthorizeAccountV2, but uses the
+// provided context for the authorization request.
+func AuthorizeAccountV2Context(
+	ctx context.Context,
+	b2BucketKeyId string,
+	b2BucketKey string,
+	opts ...Option,
+) (*Service, AuthV2, error) {
+	service := newService(opts)
+	service.setCredentials(b2BucketKeyId, b2BucketKey)
+
+	auth, err := service.authorizeV2(ctx, b2BucketKeyId, b2BucketKey)
+	if err != nil {
+		return &Service{}, AuthV2{}, err
 	}
 
 	return service, auth, nil
 }
 
-func AuthorizeAccountV2(b2BucketKeyId, b2BucketKey string) (*Service, AuthV2, error) {
-	response, err := InitAuthorization(b2BucketKeyId, b2BucketKey, AuthURLV2)
+// authorizeV2 authorizes the account using the v2 API, and updates the
+// Service with the new authorization token and API URL.
+func (b2Service *Service) authorizeV2(
+	ctx context.Context,
+	b2BucketKeyId string,
+	b2BucketKey string,
+) (AuthV2, error) {
+	response, err := b2Service.initAuthorization(
+		ctx, b2BucketKeyId, b2BucketKey, AuthURLV2)
 	if err != nil {
-		return &Service{}, AuthV2{}, err
+		return AuthV2{}, err
 	}
 
 	var auth AuthV2
 	err = json.NewDecoder(response).Decode(&auth)
 	if err != nil {
-		return &Service{}, AuthV2{}, err
+		return AuthV2{}, err
 	}
 
 	// Trim trailing slash
@@ -114,20 +258,46 @@ func AuthorizeAccountV2(b2BucketKeyId, b2BucketKey string) (*Service, AuthV2, er
 		auth.APIURL = auth.APIURL[0 : len(auth.APIURL)-2]
 	}
 
-	service := &Service{
-		APIURL:             auth.APIURL,
-		AuthorizationToken: auth.AuthorizationToken,
-		APIVersion:         "v2",
-		Dummy:              false,
-		LocalPath:          "",
-		StorageMaximum:     0,
-	}
+	b2Service.authMu.Lock()
+	defer b2Service.authMu.Unlock()
 
-	return service, auth, nil
+	b2Service.AccountID = auth.AccountID
+	b2Service.APIURL = auth.APIURL
+	b2Service.DownloadURL = strings.TrimSuffix(auth.DownloadURL, "/")
+	b2Service.AuthorizationToken = auth.AuthorizationToken
+	b2Service.APIVersion = "v2"
+	b2Service.RecommendedPartSize = int64(auth.RecommendedPartSize)
+	b2Service.AbsoluteMinimumPartSize = int64(auth.AbsoluteMinimumPartSize)
+
+	return auth, nil
 }
 
 func InitAuthorization(b2BucketKeyId, b2BucketKey, authURL string) (io.ReadCloser, error) {
-	req, err := http.NewRequest("GET", authURL, nil)
+	return InitAuthorizationContext(
+		context.Background(), b2BucketKeyId, b2BucketKey, authURL)
+}
+
+// InitAuthorizationContext is the same as InitAuthorization, but uses the
+// provided context for the authorization request.
+func InitAuthorizationContext(
+	ctx context.Context,
+	b2BucketKeyId string,
+	b2BucketKey string,
+	authURL string,
+) (io.ReadCloser, error) {
+	return (&Service{}).initAuthorization(
+		ctx, b2BucketKeyId, b2BucketKey, authURL)
+}
+
+// initAuthorization sends the authorization request using the Service's
+// http.Client and RetryPolicy.
+func (b2Service *Service) initAuthorization(
+	ctx context.Context,
+	b2BucketKeyId string,
+	b2BucketKey string,
+	authURL string,
+) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", authURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -140,14 +310,11 @@ func InitAuthorization(b2BucketKeyId, b2BucketKey, authURL string) (io.ReadClose
 		"Authorization": {fmt.Sprintf("Basic %s", authString)},
 	}
 
-	res, err := utils.Client.Do(req)
+	res, err := b2Service.do(req)
 	if err != nil {
 		return nil, err
 	} else if res.StatusCode >= 400 {
-		log.Printf("%s -- error: %d\n", authURL, res.StatusCode)
-		resp, _ := httputil.DumpResponse(res, true)
-		log.Println(fmt.Sprintf("%s", resp))
-		return res.Body, utils.B2Error
+		return res.Body, b2Service.apiError(res, APIAuthorizeAccount)
 	}
 
 	return res.Body, nil
@@ -155,7 +322,7 @@ func InitAuthorization(b2BucketKeyId, b2BucketKey, authURL string) (io.ReadClose
 
 // AuthorizeDummyAccount allows using the B2 library as normal, but having
 // all files saved and retrieved from a specific folder on the machine.
-func AuthorizeDummyAccount(path string) (*Service, error) {
+func AuthorizeDummyAccount(path string, opts ...Option) (*Service, error) {
 	if _, err := os.Stat(path); err != nil {
 		// Attempt to create directory
 		err = os.MkdirAll(path, 0755)
@@ -164,17 +331,45 @@ func AuthorizeDummyAccount(path string) (*Service, error) {
 		}
 	}
 
-	return &Service{
-		Dummy:     true,
-		LocalPath: path,
-	}, nil
+	service := newService(opts)
+	service.Dummy = true
+	service.LocalPath = path
+	return service, nil
+}
+
+// AuthorizeDummyAccountWithKey functions the same as AuthorizeDummyAccount,
+// but authorizes the account with a key created by another dummy account
+// using the same path. Like B2, requests made by the account are refused if
+// they need a capability the key doesn't have, are outside of the key's bucket
+// or name prefix, or are made after the key has expired or been deleted.
+func AuthorizeDummyAccountWithKey(
+	path string,
+	keyID string,
+	key string,
+	opts ...Option,
+) (*Service, error) {
+	service, err := AuthorizeDummyAccount(path, opts...)
+	if err != nil {
+		return &Service{}, err
+	}
+
+	if err = authorizeLocalKey(path, keyID, key); err != nil {
+		return &Service{}, err
+	}
+
+	service.localKeyID = keyID
+	return service, nil
 }
 
 // AuthorizeLimitedDummyAccount functions the same as AuthorizeDummyAccount, but
 // imposes an additional limitation for the total size of the directory specified
 // in the "path" variable.
-func AuthorizeLimitedDummyAccount(path string, storageLimit int64) (*Service, error) {
-	service, err := AuthorizeDummyAccount(path)
+func AuthorizeLimitedDummyAccount(
+	path string,
+	storageLimit int64,
+	opts ...Option,
+) (*Service, error) {
+	service, err := AuthorizeDummyAccount(path, opts...)
 	if err != nil {
 		return &Service{}, err
 	}
@@ -183,14 +378,147 @@ func AuthorizeLimitedDummyAccount(path string, storageLimit int64) (*Service, er
 	return service, nil
 }
 
+// postJSON sends a JSON-encoded request body to a B2 API endpoint, and
+// decodes the JSON response into `out`.
+func (b2Service *Service) postJSON(
+	ctx context.Context,
+	endpoint string,
+	body any,
+	out any,
+) error {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	reqURL := utils.FormatB2URL(
+		b2Service.apiURL(), b2Service.APIVersion, endpoint)
+
+	req, err := http.NewRequestWithContext(
+		ctx, "POST", reqURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		b2Service.Logf("B2Error creating new HTTP request: %v\n", err)
+		return err
+	}
+
+	req.Header = http.Header{
+		"Content-Type":  {"application/json"},
+		"Authorization": {b2Service.token()},
+	}
+
+	res, err := b2Service.do(req)
+	if err != nil {
+		b2Service.Logf("%s error: %v\n", endpoint, err)
+		return err
+	} else if res.StatusCode >= 400 {
+		b2Service.Logf("\n%s %s\n", "POST", reqURL)
+		return b2Service.apiError(res, endpoint)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(out)
+	if err != nil {
+		b2Service.Logf("B2Error decoding %s response: %v", endpoint, err)
+		return err
+	}
+
+	return nil
+}
+
+// localMetadataPath returns the path to a metadata file or directory stored
+// by a dummy account.
+func localMetadataPath(root string, elem ...string) string {
+	return filepath.Join(append([]string{root, localMetadataDir}, elem...)...)
+}
+
+// localRegistryMu guards the registries kept in a dummy account's metadata
+// directory (i.e. keys and hidden files), so that concurrent requests don't
+// lose each other's changes.
+var localRegistryMu sync.RWMutex
+
+// readLocalRegistry reads one of a dummy account's registries into `v`,
+// leaving `v` unchanged if the registry hasn't been written yet.
+func readLocalRegistry(path string, v any) error {
+	localRegistryMu.RLock()
+	defer localRegistryMu.RUnlock()
+
+	err := utils.ReadJSONFile(path, v)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// updateLocalRegistry reads one of a dummy account's registries into `v` and
+// calls `update` to modify it, without any other changes being made to the
+// registry in between. The registry is only written if `update` returns true.
+func updateLocalRegistry(
+	path string,
+	v any,
+	update func() (bool, error),
+) error {
+	localRegistryMu.Lock()
+	defer localRegistryMu.Unlock()
+
+	err := utils.ReadJSONFile(path, v)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if changed, err := update(); err != nil || !changed {
+		return err
+	}
+
+	return utils.WriteJSONFile(path, v)
+}
+
+// localFileID returns the ID used for a file stored by a dummy account, which
+// is the file's path relative to the account's LocalPath. Files uploaded
+// without the ID of a bucket created by the dummy account are stored
+// directly in LocalPath.
+func localFileID(root string, bucketID string, filename string) string {
+	if !localBucketExists(root, bucketID) {
+		return filename
+	}
+
+	return fmt.Sprintf("%s/%s", bucketID, filename)
+}
+
+// splitLocalFileID is the inverse of localFileID, returning the bucket ID and
+// file name for a file stored by a dummy account.
+func splitLocalFileID(root string, id string) (string, string) {
+	bucketID, filename, found := strings.Cut(id, "/")
+	if !found || !localBucketExists(root, bucketID) {
+		return "", id
+	}
+
+	return bucketID, filename
+}
+
+// checkLocalFileName checks that the name of a file stored by a dummy account
+// stays within its bucket's directory, and doesn't overwrite the metadata
+// kept by the account.
+func checkLocalFileName(root string, id string, endpoint string) error {
+	bucketID, filename := splitLocalFileID(root, id)
+	name := path.Clean(filename)
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") ||
+		(len(bucketID) == 0 && (name == localMetadataDir ||
+			strings.HasPrefix(name, localMetadataDir+"/"))) {
+		return localError(http.StatusBadRequest, "bad_request", endpoint,
+			"invalid file name: %q", filename)
+	}
+
+	return nil
+}
+
 func (b2Service *Service) SetLogging(enable bool) {
 	b2Service.Logging = enable
 }
 
 func (b2Service *Service) Logf(format string, v ...any) {
-	if !b2Service.Logging {
+	if b2Service == nil || !b2Service.Logging {
 		return
 	}
 
-	log.Printf(format, v)
+	log.Printf(format, v...)
 }
@@ -0,0 +1,104 @@
+package b2_test
+
+import (
+	"fmt"
+	. "github.com/benbusby/b2"
+	"os"
+	"testing"
+)
+
+func TestListBuckets(t *testing.T) {
+	bucketID := os.Getenv("B2_TEST_BUCKET_ID")
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		bucketList, err := service.ListBuckets(bucketID, "")
+		if err != nil {
+			t.Fatalf("Error listing buckets: %v", err)
+		} else if len(bucketList.Buckets) != 1 {
+			t.Fatalf("Error: expected=%d, received=%d",
+				1, len(bucketList.Buckets))
+		} else if bucketList.Buckets[0].BucketID != bucketID {
+			t.Fatalf("Incorrect bucket listed: expected=%s, received=%s",
+				bucketID, bucketList.Buckets[0].BucketID)
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalBuckets(t *testing.T) {
+	bucketName := "local-test-bucket"
+
+	bucket, err := dummyAccount.CreateBucket(bucketName, BucketOptions{
+		BucketInfo: map[string]string{"purpose": "testing"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create local bucket: %v", err)
+	} else if bucket.BucketType != BucketTypeAllPrivate {
+		t.Fatalf("Incorrect bucket type: expected=%s, received=%s",
+			BucketTypeAllPrivate, bucket.BucketType)
+	}
+
+	_, err = dummyAccount.CreateBucket(bucketName, BucketOptions{})
+	if err == nil {
+		t.Fatal("Created duplicate local bucket without error")
+	}
+
+	info, _ := dummyAccount.GetUploadURL(bucket.BucketID)
+	file, err := UploadFile(info, "bucket-file.txt", "", []byte(testString))
+	if err != nil {
+		t.Fatalf("Failed to upload file to local bucket: %v", err)
+	}
+
+	files, err := dummyAccount.ListAllFiles(bucket.BucketID)
+	if err != nil {
+		t.Fatalf("Failed to list local bucket files: %v", err)
+	} else if len(files.Files) != 1 {
+		t.Fatalf("Error: expected=%d, received=%d", 1, len(files.Files))
+	}
+
+	if _, err = dummyAccount.DeleteBucket(bucket.BucketID); err == nil {
+		t.Fatal("Deleted non-empty local bucket without error")
+	}
+
+	updated, err := dummyAccount.UpdateBucket(bucket.BucketID, BucketOptions{
+		BucketType:   BucketTypeAllPublic,
+		IfRevisionIs: bucket.Revision,
+	})
+	if err != nil {
+		t.Fatalf("Failed to update local bucket: %v", err)
+	} else if updated.BucketType != BucketTypeAllPublic {
+		t.Fatal("Local bucket type was not updated")
+	} else if updated.Revision != bucket.Revision+1 {
+		t.Fatal("Local bucket revision was not incremented")
+	} else if updated.BucketInfo["purpose"] != "testing" {
+		t.Fatal("Local bucket info was not preserved")
+	}
+
+	_, err = dummyAccount.UpdateBucket(bucket.BucketID, BucketOptions{
+		IfRevisionIs: bucket.Revision,
+	})
+	if err == nil {
+		t.Fatal("Updated local bucket with outdated revision")
+	}
+
+	bucketList, err := dummyAccount.ListAllBuckets()
+	if err != nil {
+		t.Fatalf("Failed to list local buckets: %v", err)
+	} else if len(bucketList.Buckets) != 1 {
+		t.Fatalf("Error: expected=%d, received=%d",
+			1, len(bucketList.Buckets))
+	}
+
+	_, _ = dummyAccount.DeleteFile(file.FileID, file.FileName)
+	if _, err = dummyAccount.DeleteBucket(bucket.BucketID); err != nil {
+		t.Fatalf("Failed to delete local bucket: %v", err)
+	}
+
+	bucketList, _ = dummyAccount.ListAllBuckets()
+	if len(bucketList.Buckets) != 0 {
+		t.Fatal("Local bucket still listed after being deleted")
+	}
+}
@@ -0,0 +1,167 @@
+package b2_test
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/benbusby/b2"
+	"os"
+	"testing"
+)
+
+func TestCopyFile(t *testing.T) {
+	file := uploadTestFile("copy-source.txt")
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		copied, err := service.CopyFile(
+			file.FileID, "copy-destination.txt", CopyFileOptions{})
+		if err != nil {
+			t.Fatalf("Failed to copy file: %v", err)
+		} else if copied.FileID == file.FileID {
+			t.Fatal("Copied file has the same ID as the source file")
+		}
+
+		contents, err := service.DownloadById(copied.FileID)
+		if err != nil || string(contents) != testString {
+			t.Fatalf("Copied content does not match source: %v", err)
+		}
+
+		partial, err := service.CopyFile(
+			file.FileID, "copy-partial.txt", CopyFileOptions{
+				Range:             &ByteRange{Begin: 0, End: 4},
+				MetadataDirective: MetadataDirectiveReplace,
+				ContentType:       "text/plain",
+			})
+		if err != nil {
+			t.Fatalf("Failed to copy file range: %v", err)
+		} else if partial.ContentLength != 5 {
+			t.Fatalf("Incorrect copied range size: expected=%d, received=%d",
+				5, partial.ContentLength)
+		} else if partial.ContentType != "text/plain" {
+			t.Fatalf("Content type was not replaced: %s", partial.ContentType)
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestCopyPart(t *testing.T) {
+	source, err := uploadLargeFile(accountV3)
+	if err != nil {
+		t.Fatalf("Failed to upload large source file: %v", err)
+	}
+
+	startFile, err := accountV3.StartLargeFile(
+		"copy-large.txt", os.Getenv("B2_TEST_BUCKET_ID"))
+	if err != nil {
+		t.Fatalf("Failed to start large file: %v", err)
+	}
+
+	ranges := []ByteRange{
+		{Begin: 0, End: chunkSize - 1},
+		{Begin: chunkSize, End: largeUploadSize - 1},
+	}
+
+	var checksums []string
+	for i, byteRange := range ranges {
+		part, err := accountV3.CopyPart(
+			source.FileID, startFile.FileID, i+1, &byteRange)
+		if err != nil {
+			t.Fatalf("Failed to copy part %d: %v", i+1, err)
+		}
+
+		checksums = append(checksums, part.ContentSha1)
+	}
+
+	largeFile, err := accountV3.FinishLargeFile(startFile.FileID, checksums)
+	if err != nil {
+		t.Fatalf("Failed to finish copied large file: %v", err)
+	} else if largeFile.ContentLength != largeUploadSize {
+		t.Fatalf("Incorrect copied file size: expected=%d, received=%d",
+			largeUploadSize, largeFile.ContentLength)
+	}
+}
+
+func TestLocalCopyFile(t *testing.T) {
+	file := uploadLocalTestFile("local-copy-source.txt")
+
+	copied, err := dummyAccount.CopyFile(
+		file.FileID, "local-copy-destination.txt", CopyFileOptions{})
+	if err != nil {
+		t.Fatalf("Failed to copy local file: %v", err)
+	}
+
+	contents, err := dummyAccount.DownloadById(copied.FileID)
+	if err != nil || string(contents) != testString {
+		t.Fatalf("Copied content does not match source: %v", err)
+	}
+
+	partial, err := dummyAccount.CopyFile(
+		file.FileID, "local-copy-partial.txt", CopyFileOptions{
+			Range: &ByteRange{Begin: 6, End: 10},
+		})
+	if err != nil {
+		t.Fatalf("Failed to copy local file range: %v", err)
+	} else if partial.ContentLength != 5 {
+		t.Fatalf("Incorrect copied range size: expected=%d, received=%d",
+			5, partial.ContentLength)
+	}
+
+	// Like B2, copying a file onto its own name creates a new version of it
+	self, err := dummyAccount.CopyFile(
+		file.FileID, file.FileName, CopyFileOptions{
+			MetadataDirective: MetadataDirectiveReplace,
+			ContentType:       "text/plain",
+		})
+	if err != nil {
+		t.Fatalf("Failed to copy local file onto itself: %v", err)
+	} else if self.ContentType != "text/plain" {
+		t.Fatalf("Incorrect content type: %s", self.ContentType)
+	}
+
+	contents, err = dummyAccount.DownloadById(self.FileID)
+	if err != nil || string(contents) != testString {
+		t.Fatalf("Local file copied onto itself does not match: %v", err)
+	}
+
+	_, err = dummyAccount.CopyFile("missing.txt", "copy.txt", CopyFileOptions{})
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error, got %v", err)
+	}
+
+	_, err = dummyAccount.CopyFile(file.FileID, ".b2/keys.json", CopyFileOptions{})
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request for copying into metadata, got %v", err)
+	}
+}
+
+func TestLocalCopyPart(t *testing.T) {
+	file := uploadLocalTestFile("local-copy-part-source.txt")
+
+	startFile, err := dummyAccount.StartLargeFile("local-copy-large.txt", "")
+	if err != nil {
+		t.Fatalf("Failed to start local large file: %v", err)
+	}
+
+	var checksums []string
+	for i := 1; i <= 2; i++ {
+		part, err := dummyAccount.CopyPart(
+			file.FileID, startFile.FileID, i, nil)
+		if err != nil {
+			t.Fatalf("Failed to copy local part %d: %v", i, err)
+		}
+
+		checksums = append(checksums, part.ContentSha1)
+	}
+
+	largeFile, err := dummyAccount.FinishLargeFile(startFile.FileID, checksums)
+	if err != nil {
+		t.Fatalf("Failed to finish local large file: %v", err)
+	}
+
+	contents, err := dummyAccount.DownloadById(largeFile.FileID)
+	if err != nil || string(contents) != testString+testString {
+		t.Fatalf("Copied parts do not match source: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package b2_test
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/benbusby/b2"
+	"os"
+	"testing"
+)
+
+var testCORSRules = []CORSRule{
+	{
+		CORSRuleName:      "uploads",
+		AllowedOrigins:    []string{"https://app.example.com"},
+		AllowedOperations: []string{CORSOperationUploadFile},
+		AllowedHeaders:    []string{"authorization", "content-type", "x-bz-*"},
+		MaxAgeSeconds:     3600,
+	},
+	{
+		CORSRuleName:   "downloads",
+		AllowedOrigins: []string{"https://*.example.com"},
+		AllowedOperations: []string{
+			CORSOperationDownloadFileByName,
+			CORSOperationDownloadFileById,
+		},
+		ExposeHeaders: []string{"x-bz-content-sha1"},
+		MaxAgeSeconds: 60,
+	},
+}
+
+func TestCORS(t *testing.T) {
+	bucketID := os.Getenv("B2_TEST_BUCKET_ID")
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		bucketList, err := service.ListBuckets(bucketID, "")
+		if err != nil || len(bucketList.Buckets) != 1 {
+			t.Fatalf("Failed to look up test bucket: %v", err)
+		}
+
+		// Invalid rules are rejected before being sent to B2
+		_, err = service.UpdateBucket(bucketID, BucketOptions{
+			CORSRules: []CORSRule{{
+				CORSRuleName:      "invalid",
+				AllowedOrigins:    []string{"*"},
+				AllowedOperations: []string{"b2_download_file"},
+			}},
+		})
+		if !errors.Is(err, badRequest) {
+			t.Fatalf("Expected bad request for invalid operation, got %v", err)
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalCORS(t *testing.T) {
+	invalidRules := [][]CORSRule{
+		{{CORSRuleName: "b2-rule", AllowedOrigins: []string{"*"},
+			AllowedOperations: []string{CORSOperationS3Get}}},
+		{{CORSRuleName: "no-origins",
+			AllowedOperations: []string{CORSOperationS3Get}}},
+		{{CORSRuleName: "bad-origin", AllowedOrigins: []string{"https://*.*.com"},
+			AllowedOperations: []string{CORSOperationS3Get}}},
+		{{CORSRuleName: "bad-operation", AllowedOrigins: []string{"*"},
+			AllowedOperations: []string{"s3_patch"}}},
+		{{CORSRuleName: "max-age", AllowedOrigins: []string{"*"},
+			AllowedOperations: []string{CORSOperationS3Get},
+			MaxAgeSeconds:     86401}},
+		{testCORSRules[0], testCORSRules[0]},
+	}
+
+	for _, rules := range invalidRules {
+		_, err := dummyAccount.CreateBucket("local-cors-invalid", BucketOptions{
+			CORSRules: rules,
+		})
+		if !errors.Is(err, badRequest) {
+			t.Fatalf("Expected bad request for %+v, got %v", rules, err)
+		}
+	}
+
+	bucket, err := dummyAccount.CreateBucket("local-cors-bucket", BucketOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create local bucket: %v", err)
+	} else if len(bucket.CORSRules) != 0 {
+		t.Fatalf("Unexpected CORS rules: %+v", bucket.CORSRules)
+	}
+
+	bucket, err = dummyAccount.UpdateBucket(bucket.BucketID, BucketOptions{
+		CORSRules: testCORSRules,
+	})
+	if err != nil {
+		t.Fatalf("Failed to update local CORS rules: %v", err)
+	} else if len(bucket.CORSRules) != 2 {
+		t.Fatalf("Incorrect CORS rules: %+v", bucket.CORSRules)
+	}
+
+	bucketList, _ := dummyAccount.ListBuckets(bucket.BucketID, "")
+	rules := bucketList.Buckets[0].CORSRules
+
+	preflights := []struct {
+		preflight CORSPreflight
+		rule      string
+	}{
+		{CORSPreflight{
+			Origin:    "https://app.example.com",
+			Operation: CORSOperationUploadFile,
+			Headers:   []string{"Authorization", "X-Bz-File-Name"},
+		}, "uploads"},
+		{CORSPreflight{
+			Origin:    "https://app.example.com",
+			Operation: CORSOperationUploadFile,
+			Headers:   []string{"X-Custom-Header"},
+		}, ""},
+		{CORSPreflight{
+			Origin:    "https://cdn.example.com",
+			Operation: CORSOperationUploadFile,
+		}, ""},
+		{CORSPreflight{
+			Origin:    "https://cdn.example.com",
+			Operation: CORSOperationDownloadFileByName,
+		}, "downloads"},
+		{CORSPreflight{
+			Origin:    "https://app.example.com",
+			Operation: CORSOperationDownloadFileById,
+		}, "downloads"},
+		{CORSPreflight{
+			Origin:    "https://example.org",
+			Operation: CORSOperationDownloadFileByName,
+		}, ""},
+	}
+
+	for _, test := range preflights {
+		rule, ok := EvaluateCORSPreflight(rules, test.preflight)
+		if ok != (len(test.rule) > 0) || rule.CORSRuleName != test.rule {
+			t.Fatalf("Incorrect rule for %+v: expected=%q, received=%q",
+				test.preflight, test.rule, rule.CORSRuleName)
+		}
+	}
+
+	bucket, err = dummyAccount.UpdateBucket(bucket.BucketID, BucketOptions{
+		CORSRules: []CORSRule{},
+	})
+	if err != nil || len(bucket.CORSRules) != 0 {
+		t.Fatalf("Failed to remove local CORS rules: %v", err)
+	}
+
+	if _, err = dummyAccount.DeleteBucket(bucket.BucketID); err != nil {
+		t.Fatalf("Failed to delete local bucket: %v", err)
+	}
+}
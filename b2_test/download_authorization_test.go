@@ -0,0 +1,120 @@
+package b2_test
+
+import (
+	"fmt"
+	. "github.com/benbusby/b2"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSignedDownloadURL(t *testing.T) {
+	file := uploadTestFile("signed/download.txt")
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		bucketID := os.Getenv("B2_TEST_BUCKET_ID")
+		bucketList, err := service.ListBuckets(bucketID, "")
+		if err != nil || len(bucketList.Buckets) != 1 {
+			t.Fatalf("Failed to look up test bucket name: %v", err)
+		}
+
+		overrides := DownloadOverrides{
+			ContentDisposition: "attachment; filename=\"download.txt\"",
+		}
+
+		auth, err := service.GetDownloadAuthorization(
+			bucketID, "signed/", time.Minute, overrides)
+		if err != nil {
+			t.Fatalf("Failed to get download authorization: %v", err)
+		} else if len(auth.AuthorizationToken) == 0 {
+			t.Fatal("Missing download authorization token")
+		}
+
+		signedURL, err := service.SignedDownloadURL(
+			bucketList.Buckets[0].BucketName, file.FileName, auth, overrides)
+		if err != nil {
+			t.Fatalf("Failed to create signed URL: %v", err)
+		}
+
+		res, err := http.Get(signedURL)
+		if err != nil {
+			t.Fatalf("Failed to download signed URL: %v", err)
+		}
+
+		defer func() {
+			_ = res.Body.Close()
+		}()
+
+		contents, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Signed URL download failed: %d", res.StatusCode)
+		} else if string(contents) != testString {
+			t.Fatal("Downloaded content does not match expected")
+		} else if res.Header.Get("Content-Disposition") !=
+			overrides.ContentDisposition {
+			t.Fatal("Content-Disposition override was not applied")
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalSignedDownloadURL(t *testing.T) {
+	file := uploadLocalTestFile("local-signed-download.txt")
+	overrides := DownloadOverrides{ContentType: "text/plain"}
+
+	auth, err := dummyAccount.GetDownloadAuthorization(
+		"local", "local-signed", time.Minute, overrides)
+	if err != nil {
+		t.Fatalf("Failed to get local download authorization: %v", err)
+	}
+
+	signedURL, err := dummyAccount.SignedDownloadURL(
+		"local", file.FileName, auth, overrides)
+	if err != nil {
+		t.Fatalf("Failed to create local signed URL: %v", err)
+	}
+
+	bucketName, fileName, err := dummyAccount.ValidateSignedDownloadURL(signedURL)
+	if err != nil {
+		t.Fatalf("Failed to validate local signed URL: %v", err)
+	} else if bucketName != "local" || fileName != file.FileName {
+		t.Fatalf("Incorrect file from signed URL: %s/%s", bucketName, fileName)
+	}
+
+	contents, err := dummyAccount.DownloadByName(bucketName, fileName)
+	if err != nil || string(contents) != testString {
+		t.Fatalf("Failed to download file from signed URL: %v", err)
+	}
+
+	// Modifying the URL should invalidate it
+	parsedURL, _ := url.Parse(signedURL)
+	query := parsedURL.Query()
+	query.Del("b2ContentType")
+	parsedURL.RawQuery = query.Encode()
+
+	_, _, err = dummyAccount.ValidateSignedDownloadURL(parsedURL.String())
+	if !IsUnauthorized(err) {
+		t.Fatalf("Expected unauthorized error for missing override, got %v", err)
+	}
+
+	otherURL, _ := dummyAccount.SignedDownloadURL(
+		"local", "other-file.txt", auth, overrides)
+	_, _, err = dummyAccount.ValidateSignedDownloadURL(otherURL)
+	if !IsUnauthorized(err) {
+		t.Fatalf("Expected unauthorized error for other file, got %v", err)
+	}
+
+	auth.AuthorizationToken += "0"
+	tamperedURL, _ := dummyAccount.SignedDownloadURL(
+		"local", file.FileName, auth, overrides)
+	_, _, err = dummyAccount.ValidateSignedDownloadURL(tamperedURL)
+	if !IsUnauthorized(err) {
+		t.Fatalf("Expected unauthorized error for tampered token, got %v", err)
+	}
+}
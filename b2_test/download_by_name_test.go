@@ -0,0 +1,73 @@
+package b2_test
+
+import (
+	"fmt"
+	. "github.com/benbusby/b2"
+	"os"
+	"testing"
+)
+
+func TestDownloadByName(t *testing.T) {
+	file := uploadTestFile("download by name.txt")
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		bucketList, err := service.ListBuckets(os.Getenv("B2_TEST_BUCKET_ID"), "")
+		if err != nil || len(bucketList.Buckets) != 1 {
+			t.Fatalf("Failed to look up test bucket name: %v", err)
+		}
+
+		bucketName := bucketList.Buckets[0].BucketName
+		contents, err := service.DownloadByName(bucketName, file.FileName)
+		if err != nil {
+			t.Fatalf("Failed to download file by name: %v", err)
+		} else if string(contents) != testString {
+			t.Fatal("Downloaded content does not match expected")
+		}
+
+		contents, err = service.PartialDownloadByName(
+			bucketName, file.FileName, 0, 4)
+		if err != nil {
+			t.Fatalf("Failed partial download by name: %v", err)
+		} else if string(contents) != testString[0:5] {
+			t.Fatalf("Invalid download contents: "+
+				"expected=%s, received=%s",
+				testString[0:5],
+				string(contents))
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalDownloadByName(t *testing.T) {
+	file := uploadLocalTestFile("local-download-by-name.txt")
+
+	contents, err := dummyAccount.DownloadByName("any-bucket", file.FileName)
+	if err != nil {
+		t.Fatalf("Failed to \"download\" local file by name: %v", err)
+	} else if string(contents) != testString {
+		t.Fatal("Downloaded content does not match expected")
+	}
+
+	reader, info, err := dummyAccount.PartialDownloadReaderByName(
+		"any-bucket", file.FileName, 6, -1)
+	if err != nil {
+		t.Fatalf("Failed partial download by name: %v", err)
+	}
+
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	if info.ContentLength != int64(len(testString)-6) {
+		t.Fatalf("Incorrect content length: expected=%d, received=%d",
+			len(testString)-6, info.ContentLength)
+	}
+
+	_, err = dummyAccount.DownloadByName("any-bucket", "missing.txt")
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error, got %v", err)
+	}
+}
@@ -1,8 +1,12 @@
 package b2_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	. "github.com/benbusby/b2"
+	"io"
+	"net/http"
 	"testing"
 )
 
@@ -77,3 +81,110 @@ func TestLocalDownload(t *testing.T) {
 			string(contents))
 	}
 }
+
+func TestDownloadReader(t *testing.T) {
+	file := uploadTestFile("download-reader.txt")
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		reader, info, err := service.DownloadReaderById(file.FileID)
+		if err != nil {
+			t.Fatalf("Failed to open download reader: %v", err)
+		}
+
+		defer reader.Close()
+
+		contents, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Failed to read download: %v", err)
+		} else if string(contents) != testString {
+			t.Fatal("Downloaded content does not match expected")
+		} else if info.ContentLength != int64(len(testString)) {
+			t.Fatalf("Incorrect content length: expected=%d, received=%d",
+				len(testString), info.ContentLength)
+		} else if info.ContentSha1 != file.ContentSha1 {
+			t.Fatalf("Incorrect checksum: expected=%s, received=%s",
+				file.ContentSha1, info.ContentSha1)
+		} else if info.FileName != file.FileName {
+			t.Fatalf("Incorrect file name: expected=%s, received=%s",
+				file.FileName, info.FileName)
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalDownloadReader(t *testing.T) {
+	file := uploadLocalTestFile("local-download-reader.txt")
+
+	reader, info, err := dummyAccount.DownloadReaderById(file.FileID)
+	if err != nil {
+		t.Fatalf("Failed to open local download reader: %v", err)
+	}
+
+	contents, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	if string(contents) != testString {
+		t.Fatal("Local file content does not match expected")
+	} else if info.ContentSha1 != file.ContentSha1 {
+		t.Fatalf("Incorrect local checksum: expected=%s, received=%s",
+			file.ContentSha1, info.ContentSha1)
+	}
+
+	reader, info, err = dummyAccount.PartialDownloadReaderById(file.FileID, 1, 5)
+	if err != nil {
+		t.Fatalf("Failed to open partial local download reader: %v", err)
+	}
+
+	contents, _ = io.ReadAll(reader)
+	_ = reader.Close()
+	if string(contents) != testString[1:6] {
+		t.Fatalf("Invalid local download contents: "+
+			"expected=%s, received=%s",
+			testString[1:6],
+			string(contents))
+	} else if info.ContentLength != 5 {
+		t.Fatalf("Incorrect partial local content length: "+
+			"expected=%d, received=%d", 5, info.ContentLength)
+	}
+
+	// Ranges that don't start within the file are rejected like in B2
+	rangeNotSatisfiable := &APIError{Status: http.StatusRequestedRangeNotSatisfiable}
+	for _, byteRange := range [][2]int64{{100, 200}, {5, 2}, {-1, 5}} {
+		_, _, err = dummyAccount.PartialDownloadReaderById(
+			file.FileID, byteRange[0], byteRange[1])
+		if !errors.Is(err, rangeNotSatisfiable) {
+			t.Fatalf("Expected range not satisfiable for %v, got %v",
+				byteRange, err)
+		}
+	}
+
+	if _, err = dummyAccount.DownloadById(""); !IsNotFound(err) {
+		t.Fatalf("Expected not found error for empty ID, got %v", err)
+	}
+}
+
+func TestLocalDownloadContext(t *testing.T) {
+	file := uploadLocalTestFile("local-download-context.txt")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, _, err := dummyAccount.DownloadReaderByIdContext(ctx, file.FileID)
+	if err != nil {
+		t.Fatalf("Failed to open local download reader: %v", err)
+	}
+
+	defer reader.Close()
+	cancel()
+
+	if _, err = io.ReadAll(reader); err != context.Canceled {
+		t.Fatalf("Did not receive expected error: "+
+			"expected=%v, actual=%v", context.Canceled, err)
+	}
+
+	_, err = dummyAccount.DownloadByIdContext(ctx, file.FileID)
+	if err != context.Canceled {
+		t.Fatalf("Did not receive expected error: "+
+			"expected=%v, actual=%v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,278 @@
+package b2_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/benbusby/b2"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+var badRequest = &APIError{Status: http.StatusBadRequest}
+
+// newCustomerKey generates a random key for testing SSE-C
+func newCustomerKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate customer key: %v", err)
+	}
+
+	return key
+}
+
+// readDownload reads the contents of a download started with one of the
+// DownloadReader functions.
+func readDownload(reader io.ReadCloser, _ DownloadInfo, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+
+	defer func(reader io.ReadCloser) {
+		_ = reader.Close()
+	}(reader)
+
+	contents, err := io.ReadAll(reader)
+	return string(contents), err
+}
+
+func TestServerSideEncryption(t *testing.T) {
+	bucketID := os.Getenv("B2_TEST_BUCKET_ID")
+	sse := NewSSEC(newCustomerKey(t))
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		info, _ := service.GetUploadURL(bucketID)
+		file, err := UploadFileFromReader(
+			info,
+			"sse-b2.txt",
+			strings.NewReader(testString),
+			int64(len(testString)),
+			UploadOptions{Encryption: NewSSEB2()})
+		if err != nil {
+			t.Fatalf("Failed to upload file with SSE-B2: %v", err)
+		} else if file.ServerSideEncryption.Mode != SSEModeB2 {
+			t.Fatalf("Incorrect encryption mode: %s",
+				file.ServerSideEncryption.Mode)
+		}
+
+		info, _ = service.GetUploadURL(bucketID)
+		file, err = UploadFileFromReader(
+			info,
+			"sse-c.txt",
+			strings.NewReader(testString),
+			int64(len(testString)),
+			UploadOptions{Encryption: sse})
+		if err != nil {
+			t.Fatalf("Failed to upload file with SSE-C: %v", err)
+		} else if file.ServerSideEncryption.Mode != SSEModeC {
+			t.Fatalf("Incorrect encryption mode: %s",
+				file.ServerSideEncryption.Mode)
+		}
+
+		contents, err := readDownload(service.DownloadReaderByIdWithOptions(
+			file.FileID, DownloadOptions{Encryption: sse}))
+		if err != nil {
+			t.Fatalf("Failed to download file with SSE-C: %v", err)
+		} else if contents != testString {
+			t.Fatalf("Invalid download contents: expected=%s, received=%s",
+				testString, contents)
+		}
+
+		_, err = service.DownloadById(file.FileID)
+		if !errors.Is(err, badRequest) {
+			t.Fatalf("Expected bad request without customer key, got %v", err)
+		}
+
+		copied, err := service.CopyFile(file.FileID, "sse-c-copy.txt",
+			CopyFileOptions{
+				SourceEncryption:      sse,
+				DestinationEncryption: NewSSEB2(),
+			})
+		if err != nil {
+			t.Fatalf("Failed to copy file with SSE-C: %v", err)
+		} else if copied.ServerSideEncryption.Mode != SSEModeB2 {
+			t.Fatalf("Incorrect copied encryption mode: %s",
+				copied.ServerSideEncryption.Mode)
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalServerSideEncryption(t *testing.T) {
+	sse := NewSSEC(newCustomerKey(t))
+	info, _ := dummyAccount.GetUploadURL("")
+	file, err := UploadFileFromReader(
+		info,
+		"local-sse-c.txt",
+		strings.NewReader(testString),
+		int64(len(testString)),
+		UploadOptions{Encryption: sse})
+	if err != nil {
+		t.Fatalf("Failed to upload local file with SSE-C: %v", err)
+	} else if file.ServerSideEncryption.Mode != SSEModeC {
+		t.Fatalf("Incorrect local encryption mode: %s",
+			file.ServerSideEncryption.Mode)
+	}
+
+	// The file should be encrypted at rest
+	raw, err := os.ReadFile(fmt.Sprintf("%s/%s", localUploadsPath, file.FileID))
+	if err != nil {
+		t.Fatalf("Failed to read local file: %v", err)
+	} else if len(raw) != len(testString) || string(raw) == testString {
+		t.Fatal("Local file was not encrypted at rest")
+	}
+
+	contents, err := readDownload(dummyAccount.DownloadReaderByIdWithOptions(
+		file.FileID, DownloadOptions{Encryption: sse}))
+	if err != nil {
+		t.Fatalf("Failed to download local file with SSE-C: %v", err)
+	} else if contents != testString {
+		t.Fatalf("Invalid local download contents: expected=%s, received=%s",
+			testString, contents)
+	}
+
+	contents, err = readDownload(dummyAccount.DownloadReaderByNameWithOptions(
+		"", file.FileName, DownloadOptions{
+			Range:      &ByteRange{Begin: 2, End: 6},
+			Encryption: sse,
+		}))
+	if err != nil {
+		t.Fatalf("Failed to download local range with SSE-C: %v", err)
+	} else if contents != testString[2:7] {
+		t.Fatalf("Invalid local range contents: expected=%s, received=%s",
+			testString[2:7], contents)
+	}
+
+	_, err = dummyAccount.DownloadById(file.FileID)
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request without customer key, got %v", err)
+	}
+
+	_, _, err = dummyAccount.DownloadReaderByIdWithOptions(
+		file.FileID, DownloadOptions{Encryption: NewSSEC(newCustomerKey(t))})
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request with wrong customer key, got %v", err)
+	}
+
+	fileInfo, err := dummyAccount.GetFileInfo(file.FileID)
+	if err != nil {
+		t.Fatalf("Failed to get local file info without customer key: %v", err)
+	} else if fileInfo.ContentSha1 != file.ContentSha1 ||
+		fileInfo.ServerSideEncryption.Mode != SSEModeC {
+		t.Fatalf("Incorrect local file info: %+v", fileInfo)
+	}
+
+	_, err = dummyAccount.CopyFile(
+		file.FileID, "local-sse-c-copy.txt", CopyFileOptions{})
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request copying without key, got %v", err)
+	}
+
+	copied, err := dummyAccount.CopyFile(
+		file.FileID, "local-sse-c-copy.txt", CopyFileOptions{
+			SourceEncryption:      sse,
+			DestinationEncryption: NewSSEB2(),
+		})
+	if err != nil {
+		t.Fatalf("Failed to copy local file with SSE-C: %v", err)
+	} else if copied.ServerSideEncryption.Mode != SSEModeB2 {
+		t.Fatalf("Incorrect local copy encryption mode: %s",
+			copied.ServerSideEncryption.Mode)
+	}
+
+	contents, err = readDownload(dummyAccount.DownloadReaderById(copied.FileID))
+	if err != nil || contents != testString {
+		t.Fatalf("Failed to download local SSE-B2 copy: %v", err)
+	}
+
+	_, err = UploadFileFromReader(
+		info,
+		"local-sse-c-short-key.txt",
+		strings.NewReader(testString),
+		int64(len(testString)),
+		UploadOptions{Encryption: NewSSEC([]byte("too short"))})
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request with short customer key, got %v", err)
+	}
+
+	// A file whose stored encryption segments were removed fails to
+	// download instead of being decrypted incorrectly
+	metadataPath := fmt.Sprintf("%s/.b2/info/%s.json",
+		localUploadsPath, url.PathEscape(file.FileID))
+	var metadata map[string]json.RawMessage
+	var encryption map[string]any
+	raw, _ = os.ReadFile(metadataPath)
+	_ = json.Unmarshal(raw, &metadata)
+	err = json.Unmarshal(metadata["serverSideEncryption"], &encryption)
+	if err != nil {
+		t.Fatalf("Failed to read local file metadata: %v", err)
+	}
+
+	delete(encryption, "segments")
+	metadata["serverSideEncryption"], _ = json.Marshal(encryption)
+	raw, _ = json.Marshal(metadata)
+	if err = os.WriteFile(metadataPath, raw, 0600); err != nil {
+		t.Fatalf("Failed to write local file metadata: %v", err)
+	}
+
+	_, err = readDownload(dummyAccount.DownloadReaderByIdWithOptions(
+		file.FileID, DownloadOptions{Encryption: sse}))
+	if err == nil {
+		t.Fatal("Downloaded local file with missing encryption segments")
+	}
+}
+
+func TestLocalLargeFileServerSideEncryption(t *testing.T) {
+	sse := NewSSEC(newCustomerKey(t))
+	data := make([]byte, 100)
+	_, _ = rand.Read(data)
+
+	largeFile, err := dummyAccount.UploadLarge(
+		context.Background(),
+		"",
+		"local-sse-c-large.bin",
+		bytes.NewReader(data),
+		LargeUploadOptions{PartSize: 30, Workers: 2, Encryption: sse})
+	if err != nil {
+		t.Fatalf("Failed to upload local large file with SSE-C: %v", err)
+	} else if largeFile.ServerSideEncryption.Mode != SSEModeC {
+		t.Fatalf("Incorrect local large file encryption mode: %s",
+			largeFile.ServerSideEncryption.Mode)
+	}
+
+	output := make(writerAt, len(data))
+	_, err = dummyAccount.ParallelDownloadById(
+		context.Background(),
+		largeFile.FileID,
+		output,
+		ParallelDownloadOptions{PartSize: 7, Workers: 3, Encryption: sse})
+	if err != nil {
+		t.Fatalf("Failed local parallel download with SSE-C: %v", err)
+	} else if !bytes.Equal(output, data) {
+		t.Fatal("Local large file contents do not match after decrypting")
+	}
+
+	startFile, err := dummyAccount.StartLargeFileWithOptions(
+		"local-sse-c-parts.bin", "", UploadOptions{Encryption: sse})
+	if err != nil {
+		t.Fatalf("Failed to start local large file with SSE-C: %v", err)
+	}
+
+	partInfo, _ := dummyAccount.GetUploadPartURL(startFile.FileID)
+	err = UploadFilePart(partInfo, 1, "", data)
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request uploading part without key, got %v", err)
+	}
+
+	_, _ = dummyAccount.CancelLargeFile(startFile.FileID)
+}
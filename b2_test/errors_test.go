@@ -0,0 +1,92 @@
+package b2_test
+
+import (
+	"errors"
+	. "github.com/benbusby/b2"
+	"github.com/benbusby/b2/utils"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIError(t *testing.T) {
+	_, err := accountV3.DownloadById("invalid-file-id")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected *APIError, got %v", err)
+	} else if apiErr.Status < 400 || len(apiErr.Code) == 0 {
+		t.Fatalf("Missing error status or code: %v", apiErr)
+	} else if apiErr.Endpoint != APIDownloadById {
+		t.Fatalf("Unexpected endpoint: %s", apiErr.Endpoint)
+	} else if !errors.Is(err, utils.B2Error) {
+		t.Fatal("APIError should match utils.B2Error")
+	}
+}
+
+func TestLocalAPIError(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusForbidden,
+			Header:     http.Header{"Retry-After": {"30"}},
+			Body: io.NopCloser(strings.NewReader(`{
+				"status": 403,
+				"code": "storage_cap_exceeded",
+				"message": "Cannot upload files, storage cap exceeded."
+			}`)),
+			Request: req,
+		}, nil
+	})
+
+	b2 := &Service{
+		APIURL:     "https://b2.invalid",
+		APIVersion: "v3",
+		HTTPClient: &http.Client{Transport: transport},
+	}
+
+	_, err := b2.GetUploadURL("bucket")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected *APIError, got %v", err)
+	} else if apiErr.Status != http.StatusForbidden ||
+		apiErr.Code != "storage_cap_exceeded" ||
+		apiErr.Endpoint != APIGetUploadURL ||
+		apiErr.RetryAfter != 30*time.Second {
+		t.Fatalf("Error was not parsed correctly: %#v", apiErr)
+	} else if !IsCapExceeded(err) || IsNotFound(err) || IsUnauthorized(err) {
+		t.Fatal("Error was not categorized correctly")
+	} else if !errors.Is(err, &APIError{Code: "storage_cap_exceeded"}) {
+		t.Fatal("Error should match target with the same code")
+	}
+}
+
+func TestLocalErrors(t *testing.T) {
+	_, err := dummyAccount.DownloadById("missing.txt")
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error, got %v", err)
+	}
+
+	_, err = dummyAccount.DeleteFile("missing.txt", "missing.txt")
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error, got %v", err)
+	}
+
+	_, err = dummyAccount.DeleteBucket("missing-bucket")
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error, got %v", err)
+	}
+
+	limitedAccount, err := AuthorizeLimitedDummyAccount(localUploadsPath, 1)
+	if err != nil {
+		t.Fatalf("Failed to set up limited dummy account: %v", err)
+	}
+
+	info, _ := limitedAccount.GetUploadURL("")
+	_, err = UploadFile(info, "too-big.txt", "", []byte(testString))
+	if !IsCapExceeded(err) {
+		t.Fatalf("Expected cap exceeded error, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package b2_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	. "github.com/benbusby/b2"
+	"github.com/benbusby/b2/utils"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// signEvents creates a signed event notification request body
+func signEvents(t *testing.T, events ...Event) ([]byte, string) {
+	body, err := json.Marshal(EventNotification{Events: events})
+	if err != nil {
+		t.Fatalf("Failed to encode events: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(testSigningSecret))
+	mac.Write(body)
+	return body, "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestLocalParseEventNotification(t *testing.T) {
+	event := Event{
+		EventID:        "event-1",
+		EventType:      EventObjectCreatedUpload,
+		EventTimestamp: time.Now().UnixMilli(),
+		FileName:       "parse.txt",
+	}
+
+	body, signature := signEvents(t, event)
+	notification, err := ParseEventNotification(
+		body, signature, testSigningSecret)
+	if err != nil || len(notification.Events) != 1 ||
+		notification.Events[0] != event {
+		t.Fatalf("Failed to parse event notification: %+v (%v)",
+			notification, err)
+	}
+
+	_, err = ParseEventNotification(body, signature, "wrong-secret")
+	if !errors.Is(err, utils.SignatureError) {
+		t.Fatalf("Expected signature error, got %v", err)
+	}
+
+	body, signature = signEvents(t, Event{FileName: "incomplete.txt"})
+	_, err = ParseEventNotification(body, signature, testSigningSecret)
+	if err == nil || errors.Is(err, utils.SignatureError) {
+		t.Fatalf("Expected malformed event error, got %v", err)
+	}
+}
+
+func TestLocalEventHandler(t *testing.T) {
+	var mu sync.Mutex
+	var received []Event
+	fail := false
+	handler := NewEventHandler(testSigningSecret, func(
+		ctx context.Context,
+		event Event,
+	) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if fail {
+			return errors.New("callback failed")
+		}
+
+		received = append(received, event)
+		return nil
+	})
+
+	receivedEvents := func() []Event {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]Event{}, received...)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	bucket, err := dummyAccount.CreateBucket("local-webhook-bucket", BucketOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create local bucket: %v", err)
+	}
+
+	_, err = dummyAccount.SetBucketNotificationRules(bucket.BucketID,
+		[]EventNotificationRule{{
+			Name:       "webhook",
+			EventTypes: []string{EventObjectCreatedAll},
+			IsEnabled:  true,
+			TargetConfiguration: EventNotificationTarget{
+				URL:                     server.URL,
+				HmacSha256SigningSecret: testSigningSecret,
+			},
+		}})
+	if err != nil {
+		t.Fatalf("Failed to set local notification rules: %v", err)
+	}
+
+	// Events sent by a dummy account are received by the handler
+	info, _ := dummyAccount.GetUploadURL(bucket.BucketID)
+	file, err := UploadFile(info, "webhook.txt", "", []byte(testString))
+	if err != nil {
+		t.Fatalf("Failed to upload local file: %v", err)
+	}
+
+	events := receivedEvents()
+	if len(events) != 1 || events[0].FileID != file.FileID ||
+		events[0].FileName != file.FileName ||
+		events[0].ContentLength != file.ContentLength ||
+		events[0].ContentSha1 != file.ContentSha1 {
+		t.Fatalf("Incorrect events received: %+v", events)
+	}
+
+	send := func(method string, body []byte, signature string) int {
+		req, _ := http.NewRequest(method, server.URL, bytes.NewReader(body))
+		req.Header.Set(EventSignatureHeader, signature)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send event notification: %v", err)
+		}
+
+		_ = res.Body.Close()
+		return res.StatusCode
+	}
+
+	event := Event{
+		EventID:         "event-1",
+		EventType:       EventObjectDeletedDelete,
+		EventTimestamp:  time.Now().UnixMilli(),
+		MatchedRuleName: "webhook",
+		FileName:        "webhook.txt",
+	}
+
+	body, signature := signEvents(t, event)
+	stale, staleSignature := signEvents(t, Event{
+		EventID:        "event-2",
+		EventType:      EventObjectDeletedDelete,
+		EventTimestamp: time.Now().Add(-2 * DefaultMaxEventAge).UnixMilli(),
+	})
+	malformed, malformedSignature := signEvents(t)
+
+	responses := []struct {
+		method    string
+		body      []byte
+		signature string
+		status    int
+	}{
+		{http.MethodGet, nil, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, body, "v1=invalid", http.StatusUnauthorized},
+		{http.MethodPost, body, "", http.StatusUnauthorized},
+		{http.MethodPost, malformed, malformedSignature, http.StatusBadRequest},
+		{http.MethodPost, stale, staleSignature, http.StatusBadRequest},
+		{http.MethodPost, body, signature, http.StatusOK},
+		{http.MethodPost, body, signature, http.StatusOK},
+	}
+
+	for _, test := range responses {
+		status := send(test.method, test.body, test.signature)
+		if status != test.status {
+			t.Fatalf("Incorrect status for %s %s: expected=%d, received=%d",
+				test.method, test.body, test.status, status)
+		}
+	}
+
+	// The replayed event is acknowledged, but only handled once
+	if events = receivedEvents(); len(events) != 2 || events[1] != event {
+		t.Fatalf("Incorrect events received: %+v", events)
+	}
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+
+	// Events that fail are handled again when B2 resends them
+	retried, retriedSignature := signEvents(t, Event{
+		EventID:        "event-3",
+		EventType:      EventObjectDeletedDelete,
+		EventTimestamp: time.Now().UnixMilli(),
+	})
+	status := send(http.MethodPost, retried, retriedSignature)
+	if status != http.StatusInternalServerError {
+		t.Fatalf("Expected callback failure, got %d", status)
+	}
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+
+	status = send(http.MethodPost, retried, retriedSignature)
+	if status != http.StatusOK {
+		t.Fatalf("Failed to resend event, got %d", status)
+	} else if events = receivedEvents(); len(events) != 3 {
+		t.Fatalf("Resent event wasn't handled: %+v", events)
+	}
+
+	_, _ = dummyAccount.DeleteFile(file.FileID, file.FileName)
+	if _, err = dummyAccount.DeleteBucket(bucket.BucketID); err != nil {
+		t.Fatalf("Failed to delete local bucket: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package b2_test
+
+import (
+	"fmt"
+	. "github.com/benbusby/b2"
+	"os"
+	"testing"
+)
+
+func TestGetFileInfo(t *testing.T) {
+	file := uploadTestFile("file-info.txt")
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		info, err := service.GetFileInfo(file.FileID)
+		if err != nil {
+			t.Fatalf("Failed to get file info: %v", err)
+		} else if info.FileName != file.FileName ||
+			info.ContentLength != int64(len(testString)) {
+			t.Fatalf("Incorrect file info: %s (%d bytes)",
+				info.FileName, info.ContentLength)
+		}
+
+		head, err := service.HeadById(file.FileID)
+		if err != nil {
+			t.Fatalf("Failed to get file headers by ID: %v", err)
+		} else if head.ContentSha1 != file.ContentSha1 {
+			t.Fatalf("Incorrect checksum: expected=%s, received=%s",
+				file.ContentSha1, head.ContentSha1)
+		}
+
+		bucketList, err := service.ListBuckets(os.Getenv("B2_TEST_BUCKET_ID"), "")
+		if err != nil || len(bucketList.Buckets) != 1 {
+			t.Fatalf("Failed to look up test bucket name: %v", err)
+		}
+
+		head, err = service.HeadByName(
+			bucketList.Buckets[0].BucketName, file.FileName)
+		if err != nil {
+			t.Fatalf("Failed to get file headers by name: %v", err)
+		} else if head.FileID != file.FileID {
+			t.Fatalf("Incorrect file ID: expected=%s, received=%s",
+				file.FileID, head.FileID)
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalGetFileInfo(t *testing.T) {
+	file := uploadLocalTestFile("local-file-info.txt")
+
+	info, err := dummyAccount.GetFileInfo(file.FileID)
+	if err != nil {
+		t.Fatalf("Failed to get local file info: %v", err)
+	} else if info.ContentLength != int64(len(testString)) {
+		t.Fatalf("Incorrect local file size: expected=%d, received=%d",
+			len(testString), info.ContentLength)
+	} else if info.ContentSha1 != file.ContentSha1 {
+		t.Fatalf("Incorrect local checksum: expected=%s, received=%s",
+			file.ContentSha1, info.ContentSha1)
+	} else if info.Action != ActionUpload || info.UploadTimestamp == 0 {
+		t.Fatalf("Missing local file info: %+v", info)
+	}
+
+	head, err := dummyAccount.HeadById(file.FileID)
+	if err != nil {
+		t.Fatalf("Failed to get local file headers by ID: %v", err)
+	} else if head.ContentLength != info.ContentLength {
+		t.Fatalf("Incorrect local file size: expected=%d, received=%d",
+			info.ContentLength, head.ContentLength)
+	}
+
+	head, err = dummyAccount.HeadByName("", file.FileName)
+	if err != nil {
+		t.Fatalf("Failed to get local file headers by name: %v", err)
+	} else if head.FileID != file.FileID {
+		t.Fatalf("Incorrect local file ID: expected=%s, received=%s",
+			file.FileID, head.FileID)
+	}
+
+	marker, err := dummyAccount.HideFile("", file.FileName)
+	if err != nil {
+		t.Fatalf("Failed to hide local file: %v", err)
+	}
+
+	info, err = dummyAccount.GetFileInfo(marker.FileID)
+	if err != nil || info.Action != ActionHide {
+		t.Fatalf("Failed to get local hide marker info: %v", err)
+	}
+
+	_, err = dummyAccount.HeadByName("", file.FileName)
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error for hidden file, got %v", err)
+	}
+
+	_, err = dummyAccount.GetFileInfo("local-missing.txt")
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error for missing file, got %v", err)
+	}
+}
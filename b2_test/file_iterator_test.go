@@ -0,0 +1,98 @@
+package b2_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/benbusby/b2"
+	"os"
+	"testing"
+)
+
+func TestFileIterator(t *testing.T) {
+	bucketID := os.Getenv("B2_TEST_BUCKET_ID")
+	testFiles := []string{"iterator/a.txt", "iterator/b.txt", "iterator/c.txt"}
+	for _, filename := range testFiles {
+		uploadTestFile(filename)
+	}
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		iterator := service.IterateFileNames(bucketID, ListOptions{
+			Prefix: "iterator/",
+			Count:  1,
+		})
+
+		var names []string
+		for iterator.Next() {
+			names = append(names, iterator.File().FileName)
+		}
+
+		if err := iterator.Err(); err != nil {
+			t.Fatalf("Error iterating over files: %v", err)
+		} else if len(names) != len(testFiles) {
+			t.Fatalf("Error: expected=%d, received=%d",
+				len(testFiles), len(names))
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalFileIterator(t *testing.T) {
+	testFiles := []string{
+		"local-iterator/a.txt",
+		"local-iterator/b.txt",
+		"local-iterator/c.txt",
+		"local-iterator/d.txt",
+		"local-iterator/e.txt",
+	}
+
+	for _, filename := range testFiles {
+		uploadLocalTestFile(filename)
+	}
+
+	opts := ListOptions{Prefix: "local-iterator/", Count: 2}
+	iterator := dummyAccount.IterateFileVersions("", opts)
+
+	var names []string
+	for iterator.Next() {
+		names = append(names, iterator.File().FileName)
+	}
+
+	if err := iterator.Err(); err != nil {
+		t.Fatalf("Error iterating over local files: %v", err)
+	} else if len(names) != len(testFiles) {
+		t.Fatalf("Error: expected=%d, received=%d", len(testFiles), len(names))
+	}
+
+	for i, name := range names {
+		if name != testFiles[i] {
+			t.Fatalf("Incorrect file order: expected=%s, received=%s",
+				testFiles[i], name)
+		}
+	}
+
+	// Stopping early shouldn't cause an error
+	iterator = dummyAccount.IterateFileNames("", opts)
+	for i := 0; i < 3 && iterator.Next(); i++ {
+	}
+
+	if err := iterator.Err(); err != nil {
+		t.Fatalf("Error stopping local iterator early: %v", err)
+	} else if iterator.File().FileName != testFiles[2] {
+		t.Fatalf("Incorrect file after stopping early: %s",
+			iterator.File().FileName)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	iterator = dummyAccount.IterateFileNamesContext(ctx, "", opts)
+	if iterator.Next() {
+		t.Fatal("Iterator with a canceled context should not return files")
+	} else if !errors.Is(iterator.Err(), context.Canceled) {
+		t.Fatalf("Expected context canceled error, got %v", iterator.Err())
+	}
+}
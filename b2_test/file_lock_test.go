@@ -0,0 +1,213 @@
+package b2_test
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	. "github.com/benbusby/b2"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var accessDenied = &APIError{Code: "access_denied"}
+
+func TestFileLock(t *testing.T) {
+	bucketID := os.Getenv("B2_TEST_BUCKET_ID")
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		bucketList, err := service.ListBuckets(bucketID, "")
+		if err != nil || len(bucketList.Buckets) != 1 {
+			t.Fatalf("Failed to look up test bucket: %v", err)
+		} else if !bucketList.Buckets[0].FileLockConfiguration.Value.IsFileLockEnabled {
+			t.Skip("Object Lock is not enabled for the test bucket")
+		}
+
+		retention := FileRetention{
+			Mode:                 RetentionModeGovernance,
+			RetainUntilTimestamp: time.Now().Add(time.Hour).UnixMilli(),
+		}
+
+		info, _ := service.GetUploadURL(bucketID)
+		file, err := UploadFileFromReader(
+			info,
+			"file-lock.txt",
+			strings.NewReader(testString),
+			int64(len(testString)),
+			UploadOptions{Retention: &retention, LegalHold: LegalHoldOn})
+		if err != nil {
+			t.Fatalf("Failed to upload locked file: %v", err)
+		} else if file.FileRetention.Value.Mode != RetentionModeGovernance ||
+			file.LegalHold.Value != LegalHoldOn {
+			t.Fatalf("Incorrect file lock: %+v %+v",
+				file.FileRetention, file.LegalHold)
+		}
+
+		if _, err = service.DeleteFile(file.FileID, file.FileName); err == nil {
+			t.Fatal("Deleted file with a legal hold")
+		}
+
+		err = service.UpdateFileLegalHold(
+			file.FileID, file.FileName, LegalHoldOff)
+		if err != nil {
+			t.Fatalf("Failed to remove legal hold: %v", err)
+		}
+
+		deleted, err := service.DeleteFileWithOptions(
+			file.FileID, file.FileName, DeleteOptions{BypassGovernance: true})
+		if !deleted || err != nil {
+			t.Fatalf("Failed to delete file bypassing governance: %v", err)
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalFileLock(t *testing.T) {
+	info, _ := dummyAccount.GetUploadURL("")
+	upload := func(name string, opts UploadOptions) (File, error) {
+		return UploadFileFromReader(
+			info,
+			name,
+			strings.NewReader(testString),
+			int64(len(testString)),
+			opts)
+	}
+
+	retention := FileRetention{
+		Mode:                 RetentionModeGovernance,
+		RetainUntilTimestamp: time.Now().Add(time.Hour).UnixMilli(),
+	}
+
+	file, err := upload("local-file-lock.txt", UploadOptions{
+		Retention: &retention,
+		LegalHold: LegalHoldOn,
+	})
+	if err != nil {
+		t.Fatalf("Failed to upload locked local file: %v", err)
+	} else if file.FileRetention.Value != retention ||
+		file.LegalHold.Value != LegalHoldOn {
+		t.Fatalf("Incorrect local file lock: %+v %+v",
+			file.FileRetention, file.LegalHold)
+	}
+
+	_, err = dummyAccount.DeleteFileWithOptions(
+		file.FileID, file.FileName, DeleteOptions{BypassGovernance: true})
+	if !errors.Is(err, accessDenied) {
+		t.Fatalf("Expected access denied with legal hold, got %v", err)
+	}
+
+	err = dummyAccount.UpdateFileLegalHold(
+		file.FileID, file.FileName, LegalHoldOff)
+	if err != nil {
+		t.Fatalf("Failed to remove local legal hold: %v", err)
+	}
+
+	_, err = dummyAccount.DeleteFile(file.FileID, file.FileName)
+	if !errors.Is(err, accessDenied) {
+		t.Fatalf("Expected access denied with governance, got %v", err)
+	}
+
+	_, err = upload(file.FileName, UploadOptions{})
+	if !errors.Is(err, accessDenied) {
+		t.Fatalf("Expected access denied replacing locked file, got %v", err)
+	}
+
+	err = dummyAccount.UpdateFileRetention(
+		file.FileID, file.FileName, FileRetention{}, false)
+	if !errors.Is(err, accessDenied) {
+		t.Fatalf("Expected access denied removing governance, got %v", err)
+	}
+
+	// Governance can be upgraded to compliance, which can't be bypassed
+	compliance := FileRetention{
+		Mode:                 RetentionModeCompliance,
+		RetainUntilTimestamp: time.Now().Add(time.Second).UnixMilli(),
+	}
+
+	err = dummyAccount.UpdateFileRetention(
+		file.FileID, file.FileName, compliance, false)
+	if !errors.Is(err, accessDenied) {
+		t.Fatalf("Expected access denied shortening retention, got %v", err)
+	}
+
+	err = dummyAccount.UpdateFileRetention(
+		file.FileID, file.FileName, compliance, true)
+	if err != nil {
+		t.Fatalf("Failed to change local retention to compliance: %v", err)
+	}
+
+	fileInfo, err := dummyAccount.GetFileInfo(file.FileID)
+	if err != nil || fileInfo.FileRetention.Value != compliance ||
+		fileInfo.LegalHold.Value != LegalHoldOff {
+		t.Fatalf("Incorrect local file lock info: %+v (%v)", fileInfo, err)
+	}
+
+	err = dummyAccount.UpdateFileRetention(
+		file.FileID, file.FileName, FileRetention{}, true)
+	if !errors.Is(err, accessDenied) {
+		t.Fatalf("Expected access denied removing compliance, got %v", err)
+	}
+
+	_, err = dummyAccount.DeleteFileWithOptions(
+		file.FileID, file.FileName, DeleteOptions{BypassGovernance: true})
+	if !errors.Is(err, accessDenied) {
+		t.Fatalf("Expected access denied with compliance, got %v", err)
+	}
+
+	// Files can be deleted once their retention has expired
+	time.Sleep(time.Until(time.UnixMilli(compliance.RetainUntilTimestamp)))
+	deleted, err := dummyAccount.DeleteFile(file.FileID, file.FileName)
+	if !deleted || err != nil {
+		t.Fatalf("Failed to delete local file after retention: %v", err)
+	}
+
+	startFile, err := dummyAccount.StartLargeFileWithOptions(
+		"local-large-file-lock.txt", "", UploadOptions{Retention: &retention})
+	if err != nil {
+		t.Fatalf("Failed to start locked local large file: %v", err)
+	}
+
+	partInfo, _ := dummyAccount.GetUploadPartURL(startFile.FileID)
+	data := []byte(testString)
+	checksum := fmt.Sprintf("%x", sha1.Sum(data))
+	if err = UploadFilePart(partInfo, 1, checksum, data); err != nil {
+		t.Fatalf("Failed to upload local part: %v", err)
+	}
+
+	largeFile, err := dummyAccount.FinishLargeFile(
+		startFile.FileID, []string{checksum})
+	if err != nil {
+		t.Fatalf("Failed to finish locked local large file: %v", err)
+	} else if largeFile.FileRetention.Value != retention {
+		t.Fatalf("Incorrect local large file retention: %+v",
+			largeFile.FileRetention)
+	}
+
+	deleted, err = dummyAccount.DeleteFileWithOptions(
+		largeFile.FileID, largeFile.FileName,
+		DeleteOptions{BypassGovernance: true})
+	if !deleted || err != nil {
+		t.Fatalf("Failed to delete local file bypassing governance: %v", err)
+	}
+
+	_, err = upload("local-file-lock-invalid.txt", UploadOptions{
+		Retention: &FileRetention{
+			Mode:                 RetentionModeGovernance,
+			RetainUntilTimestamp: time.Now().Add(-time.Hour).UnixMilli(),
+		},
+	})
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request for past retention, got %v", err)
+	}
+
+	_, err = upload("local-file-lock-invalid.txt", UploadOptions{
+		LegalHold: "maybe",
+	})
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request for invalid legal hold, got %v", err)
+	}
+}
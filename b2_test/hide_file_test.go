@@ -0,0 +1,143 @@
+package b2_test
+
+import (
+	"fmt"
+	. "github.com/benbusby/b2"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestHideFile(t *testing.T) {
+	bucketID := os.Getenv("B2_TEST_BUCKET_ID")
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		filename := fmt.Sprintf("hidden/%s.txt", service.APIVersion)
+		uploadTestFile(filename)
+
+		hidden, err := service.HideFile(bucketID, filename)
+		if err != nil {
+			t.Fatalf("Failed to hide file: %v", err)
+		} else if hidden.Action != ActionHide {
+			t.Fatalf("Incorrect hide marker action: %s", hidden.Action)
+		}
+
+		fileList, err := service.ListFileNames(bucketID, ListOptions{
+			Prefix: filename,
+		})
+		if err != nil {
+			t.Fatalf("Error listing file names: %v", err)
+		} else if len(fileList.Files) != 0 {
+			t.Fatal("Hidden file was included in file names")
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalHideFile(t *testing.T) {
+	file := uploadLocalTestFile("local-hidden.txt")
+	opts := ListOptions{Prefix: file.FileName}
+
+	hidden, err := dummyAccount.HideFile("", file.FileName)
+	if err != nil {
+		t.Fatalf("Failed to hide local file: %v", err)
+	} else if hidden.Action != ActionHide {
+		t.Fatalf("Incorrect hide marker action: %s", hidden.Action)
+	}
+
+	fileList, err := dummyAccount.ListFileNames("", opts)
+	if err != nil {
+		t.Fatalf("Error listing local file names: %v", err)
+	} else if len(fileList.Files) != 0 {
+		t.Fatal("Hidden file was included in local file names")
+	}
+
+	_, err = dummyAccount.DownloadByName("", file.FileName)
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error for hidden file, got %v", err)
+	}
+
+	versions, err := dummyAccount.ListAllFiles("")
+	if err != nil {
+		t.Fatalf("Error listing local file versions: %v", err)
+	}
+
+	markers := 0
+	for _, version := range versions.Files {
+		if version.FileID == hidden.FileID && version.Action == ActionHide {
+			markers += 1
+		}
+	}
+
+	if markers != 1 {
+		t.Fatalf("Expected 1 hide marker in file versions, found %d", markers)
+	}
+
+	// Deleting the hide marker should make the file visible again
+	if _, err = dummyAccount.DeleteFile(hidden.FileID, file.FileName); err != nil {
+		t.Fatalf("Failed to delete hide marker: %v", err)
+	}
+
+	fileList, err = dummyAccount.ListFileNames("", opts)
+	if err != nil || len(fileList.Files) != 1 {
+		t.Fatalf("Unhidden file was not included in file names: %v", err)
+	}
+
+	_, err = dummyAccount.HideFile("", "local-missing.txt")
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error for missing file, got %v", err)
+	}
+
+	// Files with names that look like hide markers are still regular files
+	lookalike := uploadLocalTestFile("hide:local-hidden.txt")
+	if info, err := dummyAccount.GetFileInfo(lookalike.FileID); err != nil {
+		t.Fatalf("Failed to get info for %s: %v", lookalike.FileName, err)
+	} else if info.Action != ActionUpload {
+		t.Fatalf("Incorrect action for %s: %s", lookalike.FileName, info.Action)
+	}
+
+	deleted, err := dummyAccount.DeleteFile(lookalike.FileID, lookalike.FileName)
+	if err != nil || !deleted {
+		t.Fatalf("Failed to delete file named like a hide marker: %v", err)
+	}
+}
+
+func TestLocalHideFileConcurrently(t *testing.T) {
+	var files []File
+	for i := 0; i < 10; i++ {
+		files = append(files, uploadLocalTestFile(
+			fmt.Sprintf("local-concurrent-hidden/%d.txt", i)))
+	}
+
+	// Hiding files at the same time shouldn't lose any of the hide markers
+	var wg sync.WaitGroup
+	errs := make([]error, len(files))
+	for i, file := range files {
+		wg.Add(1)
+		go func(i int, file File) {
+			defer wg.Done()
+			_, errs[i] = dummyAccount.HideFile("", file.FileName)
+		}(i, file)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Failed to hide local file: %v", err)
+		}
+	}
+
+	fileList, err := dummyAccount.ListFileNames("", ListOptions{
+		Prefix: "local-concurrent-hidden/",
+	})
+	if err != nil {
+		t.Fatalf("Error listing local file names: %v", err)
+	} else if len(fileList.Files) != 0 {
+		t.Fatalf("%d hidden files were included in local file names",
+			len(fileList.Files))
+	}
+}
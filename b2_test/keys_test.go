@@ -0,0 +1,164 @@
+package b2_test
+
+import (
+	"fmt"
+	. "github.com/benbusby/b2"
+	"testing"
+	"time"
+)
+
+func TestLocalKeys(t *testing.T) {
+	capabilities := []string{"listFiles", "readFiles"}
+
+	_, err := dummyAccount.CreateKey("prefix-only", capabilities, KeyOptions{
+		NamePrefix: "tenant-a/",
+	})
+	if err == nil {
+		t.Fatal("Created local key with name prefix but no bucket")
+	}
+
+	var created []Key
+	for _, name := range []string{"key-a", "key-b", "key-c"} {
+		key, err := dummyAccount.CreateKey(name, capabilities, KeyOptions{
+			ValidDuration: time.Hour,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create local key: %v", err)
+		} else if len(key.ApplicationKey) == 0 {
+			t.Fatal("Local key was created without a secret")
+		} else if key.ExpirationTimestamp <= time.Now().UnixMilli() {
+			t.Fatal("Local key expiration was not set")
+		}
+
+		created = append(created, key)
+	}
+
+	keyList, err := dummyAccount.ListKeys(2, "")
+	if err != nil {
+		t.Fatalf("Failed to list local keys: %v", err)
+	} else if len(keyList.Keys) != 2 {
+		t.Fatalf("Error: expected=%d, received=%d", 2, len(keyList.Keys))
+	} else if len(keyList.NextApplicationKeyID) == 0 {
+		t.Fatal("Missing next key ID for local key list")
+	} else if len(keyList.Keys[0].ApplicationKey) > 0 {
+		t.Fatal("Listed local key includes secret")
+	}
+
+	keyList, err = dummyAccount.ListKeys(2, keyList.NextApplicationKeyID)
+	if err != nil {
+		t.Fatalf("Failed to list remaining local keys: %v", err)
+	} else if len(keyList.Keys) != 1 {
+		t.Fatalf("Error: expected=%d, received=%d", 1, len(keyList.Keys))
+	}
+
+	// ListAllKeys pages through every key, rather than only the first 100
+	for i := len(created); i <= 100; i++ {
+		key, err := dummyAccount.CreateKey(
+			fmt.Sprintf("key-%d", i), capabilities, KeyOptions{})
+		if err != nil {
+			t.Fatalf("Failed to create local key: %v", err)
+		}
+
+		created = append(created, key)
+	}
+
+	keyList, err = dummyAccount.ListAllKeys()
+	if err != nil {
+		t.Fatalf("Failed to list all local keys: %v", err)
+	} else if len(keyList.Keys) != len(created) {
+		t.Fatalf("Error: expected=%d, received=%d",
+			len(created), len(keyList.Keys))
+	} else if len(keyList.NextApplicationKeyID) > 0 {
+		t.Fatal("Next key ID set after listing all local keys")
+	}
+
+	for _, key := range created {
+		if _, err = dummyAccount.DeleteKey(key.ApplicationKeyID); err != nil {
+			t.Fatalf("Failed to delete local key: %v", err)
+		}
+	}
+
+	keyList, _ = dummyAccount.ListAllKeys()
+	if len(keyList.Keys) != 0 {
+		t.Fatal("Local keys still listed after being deleted")
+	}
+}
+
+func TestLocalRestrictedKey(t *testing.T) {
+	bucket, err := dummyAccount.CreateBucket("local-key-bucket", BucketOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create local bucket: %v", err)
+	}
+
+	key, err := dummyAccount.CreateKey("tenant-a",
+		[]string{"listFiles", "readFiles", "writeFiles"},
+		KeyOptions{BucketID: bucket.BucketID, NamePrefix: "tenant-a/"})
+	if err != nil {
+		t.Fatalf("Failed to create local key: %v", err)
+	}
+
+	_, err = AuthorizeDummyAccountWithKey(
+		localUploadsPath, key.ApplicationKeyID, "wrong-secret")
+	if !IsUnauthorized(err) {
+		t.Fatalf("Expected unauthorized error for wrong secret, got %v", err)
+	}
+
+	tenant, err := AuthorizeDummyAccountWithKey(
+		localUploadsPath, key.ApplicationKeyID, key.ApplicationKey)
+	if err != nil {
+		t.Fatalf("Failed to authorize with local key: %v", err)
+	}
+
+	info, err := tenant.GetUploadURL(bucket.BucketID)
+	if err != nil {
+		t.Fatalf("Failed to get upload URL with local key: %v", err)
+	}
+
+	file, err := UploadFile(info, "tenant-a/a.txt", "", []byte(testString))
+	if err != nil {
+		t.Fatalf("Failed to upload with local key: %v", err)
+	}
+
+	if _, err = tenant.DownloadById(file.FileID); err != nil {
+		t.Fatalf("Failed to download with local key: %v", err)
+	}
+
+	// Requests outside of the key's prefix, bucket, or capabilities are
+	// refused in the same way as B2
+	refused := map[string]error{}
+	_, refused["other prefix"] = UploadFile(
+		info, "tenant-b/a.txt", "", []byte(testString))
+	_, refused["list outside prefix"] = tenant.ListFileNames(
+		bucket.BucketID, ListOptions{})
+	_, refused["other bucket"] = tenant.GetUploadURL("")
+	_, refused["missing capability"] = tenant.DeleteFile(
+		file.FileID, file.FileName)
+	_, refused["key management"] = tenant.ListAllKeys()
+
+	for name, err := range refused {
+		if !IsUnauthorized(err) {
+			t.Fatalf("Expected unauthorized error for %s, got %v", name, err)
+		}
+	}
+
+	// Expired and deleted keys can't be used
+	expired, _ := dummyAccount.CreateKey("expired", []string{"listBuckets"},
+		KeyOptions{ValidDuration: time.Millisecond})
+	time.Sleep(2 * time.Millisecond)
+	_, err = AuthorizeDummyAccountWithKey(
+		localUploadsPath, expired.ApplicationKeyID, expired.ApplicationKey)
+	if !IsUnauthorized(err) {
+		t.Fatalf("Expected unauthorized error for expired key, got %v", err)
+	}
+
+	_, _ = dummyAccount.DeleteKey(expired.ApplicationKeyID)
+	_, _ = dummyAccount.DeleteKey(key.ApplicationKeyID)
+	if _, err = tenant.DownloadById(file.FileID); !IsUnauthorized(err) {
+		t.Fatalf("Expected unauthorized error for deleted key, got %v", err)
+	}
+
+	_, _ = dummyAccount.DeleteFile(file.FileID, file.FileName)
+	if _, err = dummyAccount.DeleteBucket(bucket.BucketID); err != nil {
+		t.Fatalf("Failed to delete local bucket: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package b2_test
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/benbusby/b2"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLifecycle(t *testing.T) {
+	bucketID := os.Getenv("B2_TEST_BUCKET_ID")
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		bucketList, err := service.ListBuckets(bucketID, "")
+		if err != nil || len(bucketList.Buckets) != 1 {
+			t.Fatalf("Failed to look up test bucket: %v", err)
+		}
+
+		for _, rule := range bucketList.Buckets[0].LifecycleRules {
+			if rule.DaysFromUploadingToHiding < 0 ||
+				rule.DaysFromHidingToDeleting < 0 {
+				t.Fatalf("Invalid lifecycle rule: %+v", rule)
+			}
+		}
+
+		if err = service.RunLifecycle(time.Now()); err == nil {
+			t.Fatal("Ran lifecycle rules for a B2 account")
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalLifecycle(t *testing.T) {
+	_, err := dummyAccount.CreateBucket("local-lifecycle-invalid", BucketOptions{
+		LifecycleRules: []LifecycleRule{{FileNamePrefix: "tmp/"}},
+	})
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request for empty lifecycle rule, got %v", err)
+	}
+
+	bucket, err := dummyAccount.CreateBucket("local-lifecycle-bucket", BucketOptions{
+		LifecycleRules: []LifecycleRule{
+			{
+				DaysFromUploadingToHiding: 1,
+				DaysFromHidingToDeleting:  1,
+				FileNamePrefix:            "tmp/",
+			},
+			{
+				DaysFromUploadingToHiding: 7,
+				FileNamePrefix:            "tmp/keep/",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create local bucket with lifecycle rules: %v", err)
+	} else if len(bucket.LifecycleRules) != 2 {
+		t.Fatalf("Incorrect lifecycle rules: %+v", bucket.LifecycleRules)
+	}
+
+	info, _ := dummyAccount.GetUploadURL(bucket.BucketID)
+	for _, name := range []string{"tmp/a.txt", "tmp/keep/b.txt", "other.txt"} {
+		if _, err = UploadFile(info, name, "", []byte(testString)); err != nil {
+			t.Fatalf("Failed to upload local file: %v", err)
+		}
+	}
+
+	_, err = UploadFileFromReader(
+		info,
+		"tmp/locked.txt",
+		strings.NewReader(testString),
+		int64(len(testString)),
+		UploadOptions{LegalHold: LegalHoldOn})
+	if err != nil {
+		t.Fatalf("Failed to upload locked local file: %v", err)
+	}
+
+	listNames := func(list func(string, ListOptions) (FileList, error)) string {
+		fileList, err := list(bucket.BucketID, ListOptions{})
+		if err != nil {
+			t.Fatalf("Failed to list local files: %v", err)
+		}
+
+		var names []string
+		for _, file := range fileList.Files {
+			names = append(names, fmt.Sprintf("%s:%s", file.Action, file.FileName))
+		}
+
+		sort.Strings(names)
+		return strings.Join(names, ",")
+	}
+
+	checkLifecycle := func(days int, expected string) {
+		now := time.Now().AddDate(0, 0, days).Add(time.Minute)
+		if err := dummyAccount.RunLifecycle(now); err != nil {
+			t.Fatalf("Failed to run local lifecycle rules: %v", err)
+		} else if names := listNames(dummyAccount.ListFileVersions); names != expected {
+			t.Fatalf("Incorrect files after %d days:\n"+
+				"expected=%s\nreceived=%s", days, expected, names)
+		}
+	}
+
+	// Files are hidden after a day, and deleted a day after that, except for
+	// the longer rule for "tmp/keep/" and the file with a legal hold
+	checkLifecycle(0, "upload:other.txt,upload:tmp/a.txt,"+
+		"upload:tmp/keep/b.txt,upload:tmp/locked.txt")
+	checkLifecycle(1, "hide:tmp/a.txt,hide:tmp/locked.txt,upload:other.txt,"+
+		"upload:tmp/a.txt,upload:tmp/keep/b.txt,upload:tmp/locked.txt")
+	checkLifecycle(2, "hide:tmp/locked.txt,upload:other.txt,"+
+		"upload:tmp/keep/b.txt,upload:tmp/locked.txt")
+	checkLifecycle(10, "hide:tmp/keep/b.txt,hide:tmp/locked.txt,"+
+		"upload:other.txt,upload:tmp/keep/b.txt,upload:tmp/locked.txt")
+
+	if names := listNames(dummyAccount.ListFileNames); names != "upload:other.txt" {
+		t.Fatalf("Incorrect visible files: %s", names)
+	}
+
+	_, err = dummyAccount.UpdateBucket(bucket.BucketID, BucketOptions{
+		LifecycleRules: []LifecycleRule{
+			{DaysFromHidingToDeleting: 1},
+			{DaysFromUploadingToHiding: 1},
+		},
+	})
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request for duplicate prefixes, got %v", err)
+	}
+
+	updated, err := dummyAccount.UpdateBucket(bucket.BucketID, BucketOptions{
+		LifecycleRules: []LifecycleRule{},
+	})
+	if err != nil {
+		t.Fatalf("Failed to remove local lifecycle rules: %v", err)
+	} else if len(updated.LifecycleRules) != 0 {
+		t.Fatalf("Lifecycle rules weren't removed: %+v", updated.LifecycleRules)
+	}
+
+	fileList, _ := dummyAccount.ListFileVersions(bucket.BucketID, ListOptions{})
+	for _, file := range fileList.Files {
+		if file.Action != ActionUpload {
+			continue
+		}
+
+		_ = dummyAccount.UpdateFileLegalHold(file.FileID, file.FileName, LegalHoldOff)
+		if _, err = dummyAccount.DeleteFile(file.FileID, file.FileName); err != nil {
+			t.Fatalf("Failed to delete local file: %v", err)
+		}
+	}
+
+	if _, err = dummyAccount.DeleteBucket(bucket.BucketID); err != nil {
+		t.Fatalf("Failed to delete local bucket: %v", err)
+	}
+}
@@ -35,3 +35,194 @@ func TestListFiles(t *testing.T) {
 	test(accountV2)
 	test(accountV3)
 }
+
+func TestListFileNames(t *testing.T) {
+	bucketID := os.Getenv("B2_TEST_BUCKET_ID")
+	for _, filename := range []string{"names/a.txt", "names/b.txt"} {
+		uploadTestFile(filename)
+	}
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		fileList, err := service.ListFileNames(bucketID, ListOptions{
+			Prefix: "names/",
+			Count:  1,
+		})
+		if err != nil {
+			t.Fatalf("Error listing file names: %v", err)
+		} else if len(fileList.Files) != 1 {
+			t.Fatalf("Error: expected=%d, received=%d", 1, len(fileList.Files))
+		} else if fileList.Files[0].Action != ActionUpload {
+			t.Fatalf("Incorrect file action: %s", fileList.Files[0].Action)
+		} else if fileList.NextFileName != "names/b.txt" {
+			t.Fatalf("Incorrect next file name: %s", fileList.NextFileName)
+		}
+
+		folderList, err := service.ListFileNames(bucketID, ListOptions{
+			Delimiter: "/",
+		})
+		if err != nil {
+			t.Fatalf("Error listing folders: %v", err)
+		}
+
+		for _, file := range folderList.Files {
+			if file.FileName == "names/" && file.Action == ActionFolder {
+				return
+			}
+		}
+
+		t.Fatal("Folder list does not contain the \"names/\" folder")
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalListFileNames(t *testing.T) {
+	for _, filename := range []string{
+		"local-names-a.txt",
+		"local-names-b.txt",
+		"local-names-c.txt",
+	} {
+		uploadLocalTestFile(filename)
+	}
+
+	fileList, err := dummyAccount.ListFileNames("", ListOptions{
+		Prefix: "local-names-",
+		Count:  2,
+	})
+	if err != nil {
+		t.Fatalf("Error listing local file names: %v", err)
+	} else if len(fileList.Files) != 2 {
+		t.Fatalf("Error: expected=%d, received=%d", 2, len(fileList.Files))
+	} else if fileList.NextFileName != "local-names-c.txt" {
+		t.Fatalf("Incorrect next file name: %s", fileList.NextFileName)
+	}
+
+	fileList, err = dummyAccount.ListFileNames("", ListOptions{
+		Prefix:        "local-names-",
+		StartFileName: fileList.NextFileName,
+	})
+	if err != nil {
+		t.Fatalf("Error listing remaining local file names: %v", err)
+	} else if len(fileList.Files) != 1 || len(fileList.NextFileName) > 0 {
+		t.Fatalf("Error: expected=%d, received=%d", 1, len(fileList.Files))
+	} else if fileList.Files[0].FileName != "local-names-c.txt" {
+		t.Fatalf("Incorrect file name: %s", fileList.Files[0].FileName)
+	}
+
+	folderList, err := dummyAccount.ListFileNames("", ListOptions{
+		Prefix:    "local-",
+		Delimiter: "-",
+	})
+	if err != nil {
+		t.Fatalf("Error listing local folders: %v", err)
+	}
+
+	folders := 0
+	for _, file := range folderList.Files {
+		if file.FileName == "local-names-" && file.Action == ActionFolder {
+			folders += 1
+		}
+	}
+
+	if folders != 1 {
+		t.Fatalf("Expected a single \"local-names-\" folder, found %d", folders)
+	}
+}
+
+func TestListFolders(t *testing.T) {
+	bucketID := os.Getenv("B2_TEST_BUCKET_ID")
+	for _, filename := range []string{
+		"folders/a.txt",
+		"folders/sub/b.txt",
+		"folders/sub/c.txt",
+	} {
+		uploadTestFile(filename)
+	}
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		fileList, err := service.ListFileVersions(bucketID, ListOptions{
+			Prefix:    "folders/",
+			Delimiter: "/",
+		})
+		if err != nil {
+			t.Fatalf("Error listing folders: %v", err)
+		} else if len(fileList.Files) != 2 {
+			t.Fatalf("Error: expected=%d, received=%d", 2, len(fileList.Files))
+		} else if fileList.Files[1].FileName != "folders/sub/" ||
+			fileList.Files[1].Action != ActionFolder {
+			t.Fatalf("Incorrect folder: %s (%s)",
+				fileList.Files[1].FileName, fileList.Files[1].Action)
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalListFolders(t *testing.T) {
+	var files []File
+	for _, filename := range []string{
+		"local-folders/sub/c.txt",
+		"local-folders/a.txt",
+		"local-folders/sub/deeper/d.txt",
+		"local-folders/sub/b.txt",
+	} {
+		files = append(files, uploadLocalTestFile(filename))
+	}
+
+	fileList, err := dummyAccount.ListFileVersions("", ListOptions{
+		Prefix:    "local-folders/",
+		Delimiter: "/",
+	})
+	if err != nil {
+		t.Fatalf("Error listing local folders: %v", err)
+	} else if len(fileList.Files) != 2 {
+		t.Fatalf("Error: expected=%d, received=%d", 2, len(fileList.Files))
+	} else if fileList.Files[0].FileName != "local-folders/a.txt" ||
+		fileList.Files[0].Action != ActionUpload {
+		t.Fatalf("Incorrect file: %s", fileList.Files[0].FileName)
+	} else if fileList.Files[1].FileName != "local-folders/sub/" ||
+		fileList.Files[1].Action != ActionFolder {
+		t.Fatalf("Incorrect folder: %s", fileList.Files[1].FileName)
+	}
+
+	// Without a delimiter, nested files are listed in order by name
+	fileList, err = dummyAccount.ListFileNames("", ListOptions{
+		Prefix: "local-folders/sub/",
+	})
+	if err != nil {
+		t.Fatalf("Error listing nested local files: %v", err)
+	}
+
+	expected := []string{
+		"local-folders/sub/b.txt",
+		"local-folders/sub/c.txt",
+		"local-folders/sub/deeper/d.txt",
+	}
+
+	if len(fileList.Files) != len(expected) {
+		t.Fatalf("Error: expected=%d, received=%d",
+			len(expected), len(fileList.Files))
+	}
+
+	for i, file := range fileList.Files {
+		if file.FileName != expected[i] {
+			t.Fatalf("Incorrect file order: expected=%s, received=%s",
+				expected[i], file.FileName)
+		}
+	}
+
+	// Folders are removed once they no longer contain any files
+	for _, file := range files {
+		if _, err = dummyAccount.DeleteFile(file.FileID, file.FileName); err != nil {
+			t.Fatalf("Failed to delete local file: %v", err)
+		}
+	}
+
+	if _, err = os.Stat(localUploadsPath + "/local-folders"); !os.IsNotExist(err) {
+		t.Fatalf("Empty local folder was not removed: %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	. "github.com/benbusby/b2"
 	"github.com/benbusby/b2/utils"
 	"log"
+	"net/http"
 	"os"
 	"reflect"
 	"testing"
@@ -73,13 +74,11 @@ func cleanup() {
 	log.SetOutput(os.Stderr)
 
 	bucketID := os.Getenv("B2_TEST_BUCKET_ID")
-	files, err := accountV3.ListAllFiles(bucketID)
-	if err != nil {
-		log.Fatal("Unable to clean up testing files")
-	}
+	files := accountV3.IterateFileVersions(bucketID, ListOptions{})
 
 	removed := 0
-	for _, file := range files.Files {
+	for files.Next() {
+		file := files.File()
 		deleted, err := accountV3.DeleteFile(file.FileID, file.FileName)
 		if !deleted || err != nil {
 			log.Printf("Failed to delete file %s (%s)\n",
@@ -90,15 +89,17 @@ func cleanup() {
 		}
 	}
 
+	if files.Err() != nil {
+		log.Fatal("Unable to clean up testing files")
+	}
+
 	log.Printf("Removed %d test files from B2\n", removed)
 
-	localFiles, err := dummyAccount.ListAllFiles("")
-	if err != nil {
-		log.Fatal("Unable to list local test files")
-	}
+	localFiles := dummyAccount.IterateFileVersions("", ListOptions{})
 
 	locallyRemoved := 0
-	for _, file := range localFiles.Files {
+	for localFiles.Next() {
+		file := localFiles.File()
 		deleted, err := dummyAccount.DeleteFile(file.FileID, file.FileName)
 		if !deleted || err != nil {
 			log.Printf("Failed to delete local test file %s", file.FileName)
@@ -107,6 +108,10 @@ func cleanup() {
 		}
 	}
 
+	if localFiles.Err() != nil {
+		log.Fatal("Unable to list local test files")
+	}
+
 	log.Printf("Removed %d local test files\n", locallyRemoved)
 }
 
@@ -134,6 +139,77 @@ func TestLimitedDummyAccount(t *testing.T) {
 
 }
 
+// countingTransport is an http.RoundTripper that counts the number of
+// requests sent through it
+type countingTransport struct {
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests += 1
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestHTTPClient(t *testing.T) {
+	transport := &countingTransport{}
+	client := &http.Client{Transport: transport}
+
+	b2, _, err := AuthorizeAccount(
+		os.Getenv("B2_TEST_KEY_ID"),
+		os.Getenv("B2_TEST_KEY"),
+		WithHTTPClient(client))
+	if err != nil {
+		t.Fatalf("Failed to authorize with custom client: %v", err)
+	} else if b2.HTTPClient != client {
+		t.Fatal("Service was not configured with custom client")
+	}
+
+	info, err := b2.GetUploadURL(os.Getenv("B2_TEST_BUCKET_ID"))
+	if err != nil {
+		t.Fatalf("Failed to get upload URL: %v", err)
+	}
+
+	data := []byte(testString)
+	checksum := fmt.Sprintf("%x", sha1.Sum(data))
+	file, err := UploadFile(info, "http-client.txt", checksum, data)
+	if err != nil {
+		t.Fatalf("Failed to upload file: %v", err)
+	}
+
+	_, err = b2.DownloadById(file.FileID)
+	if err != nil {
+		t.Fatalf("Failed to download file: %v", err)
+	}
+
+	// Authorization, upload URL, upload, and download
+	if transport.requests != 4 {
+		t.Fatalf("Expected 4 requests through custom client, got %d",
+			transport.requests)
+	}
+}
+
+func TestDummyHTTPClient(t *testing.T) {
+	client := &http.Client{}
+	b2, err := AuthorizeDummyAccount(localUploadsPath, WithHTTPClient(client))
+	if err != nil {
+		t.Fatalf("Failed to set up dummy account: %v", err)
+	} else if b2.HTTPClient != client {
+		t.Fatal("Dummy account was not configured with custom client")
+	}
+}
+
+func TestDefaultHTTPClient(t *testing.T) {
+	// The default client can't have an overall timeout, since it would cut
+	// off streaming uploads and downloads that take longer
+	transport, ok := utils.Client.Transport.(*http.Transport)
+	if utils.Client.Timeout != 0 {
+		t.Fatalf("Default client has an overall timeout: %v",
+			utils.Client.Timeout)
+	} else if !ok || transport.ResponseHeaderTimeout == 0 {
+		t.Fatal("Default client doesn't time out waiting for a response")
+	}
+}
+
 func uploadTestFile(filename string) File {
 	info, _ := accountV3.GetUploadURL(os.Getenv("B2_TEST_BUCKET_ID"))
 	data := []byte(testString)
@@ -0,0 +1,268 @@
+package b2_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/benbusby/b2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSigningSecret = "abcdefghijklmnopqrstuvwxyz012345"
+
+func TestBucketNotificationRules(t *testing.T) {
+	bucketID := os.Getenv("B2_TEST_BUCKET_ID")
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+
+		// Invalid rules are rejected before being sent to B2
+		_, err := service.SetBucketNotificationRules(bucketID,
+			[]EventNotificationRule{{
+				Name:       "invalid",
+				EventTypes: []string{"b2:ObjectCreated"},
+				TargetConfiguration: EventNotificationTarget{
+					URL: "https://example.com/webhook",
+				},
+			}})
+		if !errors.Is(err, badRequest) {
+			t.Fatalf("Expected bad request for invalid event type, got %v", err)
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalBucketNotificationRules(t *testing.T) {
+	var mu sync.Mutex
+	var events []Event
+	server := httptest.NewServer(http.HandlerFunc(func(
+		w http.ResponseWriter,
+		r *http.Request,
+	) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte(testSigningSecret))
+		mac.Write(body)
+		signature := "v1=" + hex.EncodeToString(mac.Sum(nil))
+
+		var notification EventNotification
+		if err := json.Unmarshal(body, &notification); err != nil ||
+			r.Header.Get(EventSignatureHeader) != signature ||
+			r.Header.Get("X-Test-Header") != "test" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		events = append(events, notification.Events...)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	checkEvents := func(expected ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var received []string
+		for _, event := range events {
+			received = append(received, fmt.Sprintf("%s:%s:%s",
+				event.MatchedRuleName, event.EventType, event.FileName))
+		}
+
+		if strings.Join(received, ",") != strings.Join(expected, ",") {
+			t.Fatalf("Incorrect events:\nexpected=%v\nreceived=%v",
+				expected, received)
+		}
+
+		events = nil
+	}
+
+	bucket, err := dummyAccount.CreateBucket("local-notify-bucket", BucketOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create local bucket: %v", err)
+	}
+
+	target := EventNotificationTarget{
+		URL: server.URL,
+		CustomHeaders: []EventNotificationHeader{
+			{Name: "X-Test-Header", Value: "test"},
+		},
+		HmacSha256SigningSecret: testSigningSecret,
+	}
+
+	invalidRules := []EventNotificationRule{
+		{Name: "bad name!", EventTypes: []string{EventObjectCreatedAll},
+			TargetConfiguration: target},
+		{Name: "no-events", TargetConfiguration: target},
+		{Name: "bad-secret", EventTypes: []string{EventObjectCreatedAll},
+			TargetConfiguration: EventNotificationTarget{
+				URL:                     server.URL,
+				HmacSha256SigningSecret: "secret",
+			}},
+		{Name: "bad-url", EventTypes: []string{EventObjectCreatedAll},
+			TargetConfiguration: EventNotificationTarget{URL: "localhost"}},
+	}
+
+	for _, rule := range invalidRules {
+		_, err = dummyAccount.SetBucketNotificationRules(
+			bucket.BucketID, []EventNotificationRule{rule})
+		if !errors.Is(err, badRequest) {
+			t.Fatalf("Expected bad request for %+v, got %v", rule, err)
+		}
+	}
+
+	rules, err := dummyAccount.SetBucketNotificationRules(bucket.BucketID,
+		[]EventNotificationRule{
+			{
+				Name:                "uploads",
+				EventTypes:          []string{EventObjectCreatedAll},
+				ObjectNamePrefix:    "uploads/",
+				IsEnabled:           true,
+				TargetConfiguration: target,
+			},
+			{
+				Name: "removals",
+				EventTypes: []string{
+					EventObjectDeletedAll,
+					EventHideMarkerCreatedHide,
+				},
+				IsEnabled:           true,
+				TargetConfiguration: target,
+			},
+			{
+				Name:                "disabled",
+				EventTypes:          []string{EventObjectCreatedUpload},
+				TargetConfiguration: target,
+			},
+		})
+	if err != nil {
+		t.Fatalf("Failed to set local notification rules: %v", err)
+	} else if rules[0].TargetConfiguration.TargetType != EventTargetTypeWebhook {
+		t.Fatalf("Incorrect default target type: %+v", rules[0])
+	}
+
+	rules, err = dummyAccount.GetBucketNotificationRules(bucket.BucketID)
+	if err != nil || len(rules) != 3 {
+		t.Fatalf("Failed to get local notification rules: %v", err)
+	}
+
+	info, _ := dummyAccount.GetUploadURL(bucket.BucketID)
+	upload, err := UploadFile(info, "uploads/a.txt", "", []byte(testString))
+	if err != nil {
+		t.Fatalf("Failed to upload local file: %v", err)
+	}
+
+	mu.Lock()
+	var event Event
+	if len(events) > 0 {
+		event = events[0]
+	}
+	mu.Unlock()
+
+	if event.BucketID != bucket.BucketID || event.FileID != upload.FileID ||
+		event.ContentLength != int64(len(testString)) ||
+		event.ContentSha1 != upload.ContentSha1 || event.EventVersion != 1 ||
+		len(event.EventID) == 0 || event.EventTimestamp == 0 {
+		t.Fatalf("Incorrect local event: %+v", event)
+	}
+
+	checkEvents("uploads:b2:ObjectCreated:Upload:uploads/a.txt")
+
+	other, _ := UploadFile(info, "other.txt", "", []byte(testString))
+	checkEvents()
+
+	copied, err := dummyAccount.CopyFile(
+		other.FileID, "uploads/b.txt", CopyFileOptions{})
+	if err != nil {
+		t.Fatalf("Failed to copy local file: %v", err)
+	}
+
+	checkEvents("uploads:b2:ObjectCreated:Copy:uploads/b.txt")
+
+	if _, err = dummyAccount.HideFile(bucket.BucketID, other.FileName); err != nil {
+		t.Fatalf("Failed to hide local file: %v", err)
+	}
+
+	checkEvents("removals:b2:HideMarkerCreated:Hide:other.txt")
+
+	for _, file := range []File{upload, other, copied} {
+		if _, err = dummyAccount.DeleteFile(file.FileID, file.FileName); err != nil {
+			t.Fatalf("Failed to delete local file: %v", err)
+		}
+	}
+
+	checkEvents(
+		"removals:b2:ObjectDeleted:Delete:uploads/a.txt",
+		"removals:b2:ObjectDeleted:Delete:other.txt",
+		"removals:b2:ObjectDeleted:Delete:uploads/b.txt")
+
+	rules, err = dummyAccount.SetBucketNotificationRules(
+		bucket.BucketID, []EventNotificationRule{})
+	if err != nil || len(rules) != 0 {
+		t.Fatalf("Failed to remove local notification rules: %v", err)
+	}
+
+	if _, err = dummyAccount.DeleteBucket(bucket.BucketID); err != nil {
+		t.Fatalf("Failed to delete local bucket: %v", err)
+	}
+}
+
+func TestLocalBucketNotificationContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(
+		http.ResponseWriter,
+		*http.Request,
+	) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	bucket, err := dummyAccount.CreateBucket("local-notify-ctx-bucket", BucketOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create local bucket: %v", err)
+	}
+
+	_, err = dummyAccount.SetBucketNotificationRules(bucket.BucketID,
+		[]EventNotificationRule{{
+			Name:                "hung",
+			EventTypes:          []string{EventObjectCreatedAll},
+			IsEnabled:           true,
+			TargetConfiguration: EventNotificationTarget{URL: server.URL},
+		}})
+	if err != nil {
+		t.Fatalf("Failed to set local notification rules: %v", err)
+	}
+
+	// A webhook that never responds shouldn't block the upload past the
+	// caller's deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	info, _ := dummyAccount.GetUploadURL(bucket.BucketID)
+	upload, err := UploadFileContext(ctx, info, "a.txt", "", []byte(testString))
+	if err != nil {
+		t.Fatalf("Failed to upload local file: %v", err)
+	} else if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Upload blocked on notification for %v", elapsed)
+	}
+
+	if _, err = dummyAccount.DeleteFile(upload.FileID, upload.FileName); err != nil {
+		t.Fatalf("Failed to delete local file: %v", err)
+	} else if _, err = dummyAccount.DeleteBucket(bucket.BucketID); err != nil {
+		t.Fatalf("Failed to delete local bucket: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package b2_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	. "github.com/benbusby/b2"
+	"os"
+	"testing"
+)
+
+// writerAt is an in-memory io.WriterAt for testing parallel downloads
+type writerAt []byte
+
+func (w writerAt) WriteAt(p []byte, off int64) (int, error) {
+	return copy(w[off:], p), nil
+}
+
+func TestParallelDownload(t *testing.T) {
+	data := make([]byte, 100)
+	_, _ = rand.Read(data)
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		info, _ := service.GetUploadURL(os.Getenv("B2_TEST_BUCKET_ID"))
+		file, _ := UploadFile(info, "parallel-download.txt", "", data)
+
+		output := make(writerAt, len(data))
+		_, err := service.ParallelDownloadById(
+			context.Background(),
+			file.FileID,
+			output,
+			ParallelDownloadOptions{PartSize: 30, Workers: 3})
+		if err != nil {
+			t.Fatalf("Failed parallel download: %v", err)
+		} else if !bytes.Equal(output, data) {
+			t.Fatal("Downloaded content does not match expected")
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestLocalParallelDownload(t *testing.T) {
+	file := uploadLocalTestFile("local-parallel-download.txt")
+
+	output := make(writerAt, len(testString))
+	info, err := dummyAccount.ParallelDownloadById(
+		context.Background(),
+		file.FileID,
+		output,
+		ParallelDownloadOptions{PartSize: 3, Workers: 2})
+	if err != nil {
+		t.Fatalf("Failed local parallel download: %v", err)
+	} else if string(output) != testString {
+		t.Fatalf("Invalid local download contents: "+
+			"expected=%s, received=%s",
+			testString,
+			string(output))
+	} else if info.ContentLength != int64(len(testString)) {
+		t.Fatalf("Incorrect content length: expected=%d, received=%d",
+			len(testString), info.ContentLength)
+	}
+}
@@ -0,0 +1,89 @@
+package b2_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	. "github.com/benbusby/b2"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUploadLarge(t *testing.T) {
+	data := make([]byte, largeUploadSize)
+	_, _ = rand.Read(data)
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		largeFile, err := service.UploadLarge(
+			context.Background(),
+			os.Getenv("B2_TEST_BUCKET_ID"),
+			"parallel-large-file.txt",
+			bytes.NewReader(data),
+			LargeUploadOptions{PartSize: chunkSize, Workers: 2})
+
+		if err != nil {
+			t.Fatalf("Failed to upload large file: %v", err)
+		} else if reflect.ValueOf(largeFile).IsZero() {
+			t.Fatal("Empty large file response from B2")
+		} else if largeFile.ContentLength != largeUploadSize {
+			t.Fatalf("Content length does not match full upload size: "+
+				"expected=%d, actual=%d", largeUploadSize, largeFile.ContentLength)
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestUploadLocalLarge(t *testing.T) {
+	partSize := int64(4)
+	data := strings.Repeat(testString, 3)
+
+	largeFile, err := dummyAccount.UploadLarge(
+		context.Background(),
+		"",
+		"local-parallel-large-file.txt",
+		strings.NewReader(data),
+		LargeUploadOptions{PartSize: partSize, Workers: 3})
+	if err != nil {
+		t.Fatalf("Failed to upload local large file: %v", err)
+	} else if largeFile.ContentLength != int64(len(data)) {
+		t.Fatalf("Content length does not match full upload size: "+
+			"expected=%d, actual=%d", len(data), largeFile.ContentLength)
+	}
+
+	contents, _ := dummyAccount.DownloadById(largeFile.FileID)
+	if string(contents) != data {
+		t.Fatal("Local large file parts were not combined in order")
+	}
+
+	smallFile, err := dummyAccount.UploadLarge(
+		context.Background(),
+		"",
+		"local-parallel-small-file.txt",
+		strings.NewReader(data),
+		LargeUploadOptions{PartSize: int64(len(data))})
+	if err != nil {
+		t.Fatalf("Failed to upload local single part file: %v", err)
+	} else if smallFile.ContentSha1 == "none" {
+		t.Fatal("Single part file was uploaded as a large file")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = dummyAccount.UploadLarge(
+		ctx,
+		"",
+		"local-parallel-canceled-file.txt",
+		strings.NewReader(data),
+		LargeUploadOptions{PartSize: partSize})
+	if err != context.Canceled {
+		t.Fatalf("Did not receive expected error: "+
+			"expected=%v, actual=%v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,118 @@
+package b2_test
+
+import (
+	"context"
+	"fmt"
+	. "github.com/benbusby/b2"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// expiringTransport is an http.RoundTripper that acts as a minimal B2 API,
+// where each authorization request issues a new token and invalidates the
+// previous one.
+type expiringTransport struct {
+	mu    sync.Mutex
+	auths int
+}
+
+func (e *expiringTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	respond := func(status int, body string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}
+
+	if strings.HasSuffix(req.URL.Path, "b2_authorize_account") {
+		e.auths += 1
+		return respond(http.StatusOK, fmt.Sprintf(`{
+			"accountId": "test",
+			"authorizationToken": "token-%d",
+			"apiInfo": {"storageApi": {"apiUrl": "https://api%d.b2.invalid"}}
+		}`, e.auths, e.auths))
+	}
+
+	token := fmt.Sprintf("token-%d", e.auths)
+	host := fmt.Sprintf("api%d.b2.invalid", e.auths)
+	if req.Header.Get("Authorization") != token || req.URL.Host != host {
+		return respond(http.StatusUnauthorized,
+			`{"status": 401, "code": "expired_auth_token"}`)
+	}
+
+	return respond(http.StatusOK, `{"files": []}`)
+}
+
+// expire invalidates the current authorization token
+func (e *expiringTransport) expire() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.auths += 1
+}
+
+func TestLocalReauthorize(t *testing.T) {
+	transport := &expiringTransport{}
+	b2, _, err := AuthorizeAccount(
+		"key-id",
+		"key",
+		WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatalf("Failed to authorize account: %v", err)
+	}
+
+	transport.expire()
+
+	// Concurrent requests should only reauthorize the account once
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := b2.ListAllFiles("bucket"); err != nil {
+				t.Errorf("Failed to list files after expiration: %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if transport.auths != 3 {
+		t.Fatalf("Expected 3 authorizations, got %d", transport.auths)
+	} else if b2.AuthorizationToken != "token-3" {
+		t.Fatalf("Token was not updated: %s", b2.AuthorizationToken)
+	} else if b2.APIURL != "https://api3.b2.invalid" {
+		t.Fatalf("API URL was not updated: %s", b2.APIURL)
+	}
+}
+
+func TestLocalReauthorizeProvider(t *testing.T) {
+	transport := &expiringTransport{}
+	provided := 0
+	b2, _, err := AuthorizeAccount(
+		"key-id",
+		"key",
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithCredentialProvider(func(context.Context) (string, string, error) {
+			provided += 1
+			return "rotated-key-id", "rotated-key", nil
+		}))
+	if err != nil {
+		t.Fatalf("Failed to authorize account: %v", err)
+	}
+
+	transport.expire()
+
+	if _, err = b2.ListAllFiles("bucket"); err != nil {
+		t.Fatalf("Failed to list files after expiration: %v", err)
+	} else if provided != 1 {
+		t.Fatalf("Expected credentials to be provided once, got %d", provided)
+	}
+}
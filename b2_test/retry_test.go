@@ -0,0 +1,131 @@
+package b2_test
+
+import (
+	"crypto/sha1"
+	"fmt"
+	. "github.com/benbusby/b2"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     10 * time.Millisecond,
+}
+
+// failingTransport is an http.RoundTripper that responds with a 503 to the
+// first `failures` requests whose URL contains `match`, and sends all other
+// requests through `next`.
+type failingTransport struct {
+	match    string
+	failures int
+	next     http.RoundTripper
+	urls     []string
+}
+
+func (f *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.urls = append(f.urls, req.URL.String())
+	if f.failures > 0 && strings.Contains(req.URL.String(), f.match) {
+		f.failures -= 1
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{"Retry-After": {"0"}},
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	}
+
+	return f.next.RoundTrip(req)
+}
+
+func TestRetry(t *testing.T) {
+	b2, _, err := AuthorizeAccount(
+		os.Getenv("B2_TEST_KEY_ID"),
+		os.Getenv("B2_TEST_KEY"),
+		WithRetryPolicy(testRetryPolicy))
+	if err != nil {
+		t.Fatalf("Failed to authorize account: %v", err)
+	}
+
+	info, err := b2.GetUploadURL(os.Getenv("B2_TEST_BUCKET_ID"))
+	if err != nil {
+		t.Fatalf("Failed to get upload URL: %v", err)
+	}
+
+	transport := &failingTransport{
+		match:    info.UploadURL,
+		failures: 1,
+		next:     http.DefaultTransport,
+	}
+	b2.HTTPClient = &http.Client{Transport: transport}
+
+	data := []byte(testString)
+	checksum := fmt.Sprintf("%x", sha1.Sum(data))
+	file, err := UploadFile(info, "retry.txt", checksum, data)
+	if err != nil {
+		t.Fatalf("Failed to upload file after retrying: %v", err)
+	} else if len(file.FileID) == 0 {
+		t.Fatal("Missing file ID after retrying upload")
+	}
+
+	// Failed upload, new upload URL, successful upload
+	if len(transport.urls) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(transport.urls))
+	}
+}
+
+func TestLocalRetry(t *testing.T) {
+	transport := &failingTransport{
+		match:    "b2_list_file_versions",
+		failures: 2,
+		next: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(`{"files":[]}`)),
+				Request:    req,
+			}, nil
+		}),
+	}
+
+	b2 := &Service{
+		APIURL:      "https://b2.invalid",
+		APIVersion:  "v3",
+		HTTPClient:  &http.Client{Transport: transport},
+		RetryPolicy: &testRetryPolicy,
+	}
+
+	_, err := b2.ListAllFiles("bucket")
+	if err != nil {
+		t.Fatalf("Failed to list files after retrying: %v", err)
+	} else if len(transport.urls) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(transport.urls))
+	}
+
+	// Requests fail once all attempts have been used
+	transport.urls = nil
+	transport.failures = testRetryPolicy.MaxAttempts
+	_, err = b2.ListAllFiles("bucket")
+	if err == nil {
+		t.Fatal("Expected error after exhausting retry attempts")
+	} else if len(transport.urls) != testRetryPolicy.MaxAttempts {
+		t.Fatalf("Expected %d requests, got %d",
+			testRetryPolicy.MaxAttempts, len(transport.urls))
+	}
+}
+
+// roundTripperFunc allows using a function as an http.RoundTripper
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
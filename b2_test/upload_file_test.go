@@ -1,8 +1,10 @@
 package b2_test
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/sha1"
+	"errors"
 	"fmt"
 	. "github.com/benbusby/b2"
 	"os"
@@ -72,4 +74,202 @@ func TestUploadLocalFile(t *testing.T) {
 	} else if _, err := os.Stat(path); err != nil {
 		t.Fatal("Local file does not exist after writing")
 	}
+
+	// Data that doesn't match the provided checksum is rejected like in B2
+	badPath := fmt.Sprintf("%s/local-bad-checksum.txt",
+		strings.TrimSuffix(dummyAccount.LocalPath, "/"))
+	_, err = UploadFile(info, "local-bad-checksum.txt", "abc123", data)
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request for incorrect checksum, got %v", err)
+	} else if _, err = os.Stat(badPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("Local file with incorrect checksum was not removed")
+	}
+
+	// A failed upload leaves the existing version of the file in place
+	_, err = UploadFile(info, filename, "abc123", []byte(testString))
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request for incorrect checksum, got %v", err)
+	}
+
+	contents, err := dummyAccount.DownloadById(filename)
+	if err != nil || !bytes.Equal(contents, data) {
+		t.Fatalf("Failed upload replaced the existing local file: %v", err)
+	}
+
+	// Names outside of LocalPath, or within the dummy account's metadata
+	// directory, are rejected
+	for _, name := range []string{"", "../escaped.txt", "a/../../escaped.txt",
+		".b2/keys.json", "./.b2/buckets/x.json"} {
+		if _, err = UploadFile(info, name, "", data); !errors.Is(err, badRequest) {
+			t.Fatalf("Expected bad request for %q, got %v", name, err)
+		}
+
+		_, err = dummyAccount.StartLargeFile(name, "")
+		if !errors.Is(err, badRequest) {
+			t.Fatalf("Expected bad request for large file %q, got %v", name, err)
+		}
+	}
+
+	escaped := fmt.Sprintf("%s/../escaped.txt",
+		strings.TrimSuffix(dummyAccount.LocalPath, "/"))
+	if _, err = os.Stat(escaped); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("Local file was written outside of LocalPath")
+	}
+}
+
+func TestUploadFileFromReader(t *testing.T) {
+	data := make([]byte, 10)
+	_, _ = rand.Read(data)
+
+	checksum := fmt.Sprintf("%x", sha1.Sum(data))
+	filename := "reader-file.txt"
+
+	test := func(service *Service) {
+		fmt.Printf("%s-- version %s\n", logPadding, service.APIVersion)
+		info, _ := service.GetUploadURL(os.Getenv("B2_TEST_BUCKET_ID"))
+
+		file, err := UploadFileFromReader(
+			info,
+			filename,
+			bytes.NewReader(data),
+			int64(len(data)),
+			UploadOptions{ContentType: "text/plain"})
+
+		if err != nil {
+			t.Fatalf("Failed to upload file from reader to B2: %v", err)
+		} else if file.ContentSha1 != checksum {
+			t.Fatalf("Invalid checksum: expected=%s, received=%s",
+				checksum, file.ContentSha1)
+		} else if file.ContentType != "text/plain" {
+			t.Fatalf("Invalid content type: expected=%s, received=%s",
+				"text/plain", file.ContentType)
+		}
+	}
+
+	test(accountV2)
+	test(accountV3)
+}
+
+func TestUploadLocalFileFromReader(t *testing.T) {
+	info, _ := dummyAccount.GetUploadURL("")
+	filename := "local-reader-file.txt"
+
+	file, err := UploadFileFromReader(
+		info,
+		filename,
+		strings.NewReader(testString),
+		int64(len(testString)),
+		UploadOptions{})
+	if err != nil {
+		t.Fatalf("Failed to \"upload\" file locally from reader: %v", err)
+	} else if file.ContentLength != int64(len(testString)) {
+		t.Fatalf("Incorrect local file size: expected=%d, received=%d",
+			len(testString), file.ContentLength)
+	}
+
+	_, err = UploadFileFromReader(
+		info,
+		filename,
+		strings.NewReader(testString),
+		int64(len(testString)+1),
+		UploadOptions{})
+	if err == nil {
+		t.Fatal("Uploaded local file from reader shorter than its size")
+	}
+
+	contents, err := dummyAccount.DownloadById(file.FileID)
+	if err != nil || string(contents) != testString {
+		t.Fatalf("Failed upload replaced the existing local file: %v", err)
+	}
+}
+
+func TestUploadFileOptions(t *testing.T) {
+	info, _ := accountV3.GetUploadURL(os.Getenv("B2_TEST_BUCKET_ID"))
+	opts := UploadOptions{
+		ContentType: "text/plain",
+		FileInfo: map[string]string{
+			FileInfoLastModified:       "1700000000000",
+			FileInfoContentDisposition: "attachment; filename=\"with options.txt\"",
+		},
+	}
+
+	file, err := UploadFileFromReader(
+		info,
+		"with options.txt",
+		strings.NewReader(testString),
+		int64(len(testString)),
+		opts)
+	if err != nil {
+		t.Fatalf("Failed to upload file with options: %v", err)
+	} else if file.ContentType != opts.ContentType {
+		t.Fatalf("Incorrect content type: %s", file.ContentType)
+	}
+
+	for key, value := range opts.FileInfo {
+		if file.FileInfo[key] != value {
+			t.Fatalf("Incorrect file info %s: expected=%s, received=%s",
+				key, value, file.FileInfo[key])
+		}
+	}
+}
+
+func TestUploadLocalFileOptions(t *testing.T) {
+	info, _ := dummyAccount.GetUploadURL("")
+	opts := UploadOptions{
+		ContentType: "text/plain",
+		FileInfo: map[string]string{
+			FileInfoLastModified: "1700000000000",
+			FileInfoCacheControl: "max-age=3600",
+		},
+	}
+
+	file, err := UploadFileFromReader(
+		info,
+		"local-options.txt",
+		strings.NewReader(testString),
+		int64(len(testString)),
+		opts)
+	if err != nil {
+		t.Fatalf("Failed to upload local file with options: %v", err)
+	}
+
+	// The stored metadata should round-trip through other functions
+	fileInfo, err := dummyAccount.GetFileInfo(file.FileID)
+	if err != nil {
+		t.Fatalf("Failed to get local file info: %v", err)
+	} else if fileInfo.ContentType != opts.ContentType {
+		t.Fatalf("Incorrect content type: %s", fileInfo.ContentType)
+	} else if !reflect.DeepEqual(fileInfo.FileInfo, opts.FileInfo) {
+		t.Fatalf("Incorrect file info: expected=%v, received=%v",
+			opts.FileInfo, fileInfo.FileInfo)
+	}
+
+	head, err := dummyAccount.HeadById(file.FileID)
+	if err != nil {
+		t.Fatalf("Failed to get local file headers: %v", err)
+	} else if head.FileInfo[FileInfoCacheControl] != "max-age=3600" {
+		t.Fatalf("Incorrect downloaded file info: %v", head.FileInfo)
+	}
+
+	auto, err := UploadFileFromReader(
+		info,
+		"local-options.html",
+		strings.NewReader(testString),
+		int64(len(testString)),
+		UploadOptions{ContentType: ContentTypeAuto})
+	if err != nil {
+		t.Fatalf("Failed to upload local file with automatic type: %v", err)
+	} else if !strings.HasPrefix(auto.ContentType, "text/html") {
+		t.Fatalf("Incorrect automatic content type: %s", auto.ContentType)
+	}
+
+	_, err = UploadFileFromReader(
+		info,
+		"local-invalid-options.txt",
+		strings.NewReader(testString),
+		int64(len(testString)),
+		UploadOptions{FileInfo: map[string]string{"invalid name": "value"}})
+	if !errors.Is(err, &APIError{Status: 400}) {
+		t.Fatalf("Expected bad request for invalid file info, got %v", err)
+	}
 }
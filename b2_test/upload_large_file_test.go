@@ -3,11 +3,14 @@ package b2_test
 import (
 	"crypto/rand"
 	"crypto/sha1"
+	"errors"
 	"fmt"
 	. "github.com/benbusby/b2"
 	"log"
+	"net/url"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -131,3 +134,65 @@ func TestUploadLocalLargeFile(t *testing.T) {
 			"expected=%d, actual=%d", largeUploadSize, largeFile.ContentLength)
 	}
 }
+
+func TestUploadLocalLargeFileOptions(t *testing.T) {
+	existing := uploadLocalTestFile("local-large-options.html")
+
+	startFile, err := dummyAccount.StartLargeFileWithOptions(
+		"local-large-options.html", "", UploadOptions{
+			Checksum: "abc123",
+			FileInfo: map[string]string{FileInfoLastModified: "1700000000000"},
+		})
+	if err != nil {
+		t.Fatalf("Failed to start local large file with options: %v", err)
+	} else if !strings.HasPrefix(startFile.ContentType, "text/html") {
+		t.Fatalf("Incorrect automatic content type: %s", startFile.ContentType)
+	}
+
+	partInfo, _ := dummyAccount.GetUploadPartURL(startFile.FileID)
+	var checksums []string
+	for i, data := range [][]byte{[]byte(testString), []byte("part 2")} {
+		checksum := fmt.Sprintf("%x", sha1.Sum(data))
+		if err = UploadFilePart(partInfo, i+1, checksum, data); err != nil {
+			t.Fatalf("Failed to upload local part: %v", err)
+		}
+
+		checksums = append(checksums, checksum)
+	}
+
+	// Checksums that don't match their parts are rejected like in B2
+	_, err = dummyAccount.FinishLargeFile(
+		startFile.FileID, []string{checksums[1], checksums[0]})
+	if !errors.Is(err, badRequest) {
+		t.Fatalf("Expected bad request for out of order checksums, got %v", err)
+	}
+
+	// A large file that fails to finish doesn't replace the existing file
+	metadataPath := fmt.Sprintf("%s/.b2/parts/%s.json",
+		localUploadsPath, url.PathEscape(startFile.FileID))
+	metadata, err := os.ReadFile(metadataPath)
+	if err != nil {
+		t.Fatalf("Failed to read local large file metadata: %v", err)
+	} else if err = os.WriteFile(metadataPath, []byte("{"), 0600); err != nil {
+		t.Fatalf("Failed to write local large file metadata: %v", err)
+	}
+
+	if _, err = dummyAccount.FinishLargeFile(startFile.FileID, checksums); err == nil {
+		t.Fatal("Finished local large file with invalid metadata")
+	}
+
+	contents, err := dummyAccount.DownloadById(existing.FileID)
+	if err != nil || string(contents) != testString {
+		t.Fatalf("Failed large file replaced the existing local file: %v", err)
+	} else if err = os.WriteFile(metadataPath, metadata, 0600); err != nil {
+		t.Fatalf("Failed to restore local large file metadata: %v", err)
+	}
+
+	largeFile, err := dummyAccount.FinishLargeFile(startFile.FileID, checksums)
+	if err != nil {
+		t.Fatalf("Failed to finish local large file: %v", err)
+	} else if largeFile.FileInfo[FileInfoLargeFileSha1] != "abc123" ||
+		largeFile.FileInfo[FileInfoLastModified] != "1700000000000" {
+		t.Fatalf("Incorrect large file info: %v", largeFile.FileInfo)
+	}
+}
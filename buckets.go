@@ -0,0 +1,494 @@
+package b2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/benbusby/b2/utils"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const APICreateBucket = "b2_create_bucket"
+const APIListBuckets = "b2_list_buckets"
+const APIUpdateBucket = "b2_update_bucket"
+const APIDeleteBucket = "b2_delete_bucket"
+
+const BucketTypeAllPrivate = "allPrivate"
+const BucketTypeAllPublic = "allPublic"
+
+var bucketNameRegex = regexp.MustCompile(`^[A-Za-z0-9-]{6,50}$`)
+
+// Bucket represents the data returned by CreateBucket, UpdateBucket,
+// DeleteBucket, and ListBuckets
+type Bucket struct {
+	AccountID                   string            `json:"accountId"`
+	BucketID                    string            `json:"bucketId"`
+	BucketInfo                  map[string]string `json:"bucketInfo"`
+	BucketName                  string            `json:"bucketName"`
+	BucketType                  string            `json:"bucketType"`
+	CORSRules                   []CORSRule        `json:"corsRules"`
+	DefaultServerSideEncryption struct {
+		IsClientAuthorizedToRead bool `json:"isClientAuthorizedToRead"`
+		Value                    any  `json:"value"`
+	} `json:"defaultServerSideEncryption"`
+	FileLockConfiguration struct {
+		IsClientAuthorizedToRead bool `json:"isClientAuthorizedToRead"`
+		Value                    struct {
+			DefaultRetention struct {
+				Mode   string `json:"mode"`
+				Period struct {
+					Duration int    `json:"duration"`
+					Unit     string `json:"unit"`
+				} `json:"period"`
+			} `json:"defaultRetention"`
+			IsFileLockEnabled bool `json:"isFileLockEnabled"`
+		} `json:"value"`
+	} `json:"fileLockConfiguration"`
+	LifecycleRules []LifecycleRule `json:"lifecycleRules"`
+	Options        []string        `json:"options"`
+	Revision       int             `json:"revision"`
+}
+
+// BucketList represents the data returned by ListBuckets
+type BucketList struct {
+	Buckets []Bucket `json:"buckets"`
+}
+
+// BucketOptions contains the optional settings for creating or updating a
+// bucket. Fields left empty are not sent to B2, and will either use B2's
+// default value (when creating) or remain unchanged (when updating).
+type BucketOptions struct {
+	// BucketType is either BucketTypeAllPrivate or BucketTypeAllPublic.
+	// New buckets default to BucketTypeAllPrivate.
+	BucketType string
+
+	// BucketInfo is a map of user-defined metadata for the bucket, and
+	// replaces any existing bucket info when updating.
+	BucketInfo map[string]string
+
+	// LifecycleRules automatically hide and delete files in the bucket, and
+	// replace any existing rules when updating. A nil slice leaves the
+	// existing rules unchanged, while an empty slice removes them.
+	LifecycleRules []LifecycleRule
+
+	// CORSRules allow browsers on other origins to access the bucket's files,
+	// and replace any existing rules when updating. Like LifecycleRules, a
+	// nil slice leaves the existing rules unchanged, while an empty slice
+	// removes them. See EvaluateCORSPreflight for testing rules offline.
+	CORSRules []CORSRule
+
+	// IfRevisionIs, when updating a bucket, causes the update to fail if
+	// the bucket's current revision doesn't match.
+	IfRevisionIs int
+}
+
+// bucketRequest is the request body shared by each bucket endpoint
+type bucketRequest struct {
+	AccountID      string            `json:"accountId"`
+	BucketID       string            `json:"bucketId,omitempty"`
+	BucketName     string            `json:"bucketName,omitempty"`
+	BucketType     string            `json:"bucketType,omitempty"`
+	BucketInfo     map[string]string `json:"bucketInfo,omitempty"`
+	LifecycleRules *[]LifecycleRule  `json:"lifecycleRules,omitempty"`
+	CORSRules      *[]CORSRule       `json:"corsRules,omitempty"`
+	IfRevisionIs   int               `json:"ifRevisionIs,omitempty"`
+}
+
+// lifecycleRules returns the bucket's lifecycle rules for a request, or nil
+// if they shouldn't be sent.
+func (opts BucketOptions) lifecycleRules() *[]LifecycleRule {
+	if opts.LifecycleRules == nil {
+		return nil
+	}
+
+	return &opts.LifecycleRules
+}
+
+// corsRules returns the bucket's CORS rules for a request, or nil if they
+// shouldn't be sent.
+func (opts BucketOptions) corsRules() *[]CORSRule {
+	if opts.CORSRules == nil {
+		return nil
+	}
+
+	return &opts.CORSRules
+}
+
+// CreateBucket creates a new bucket with the provided name, which must be
+// globally unique among all B2 buckets.
+func (b2Service *Service) CreateBucket(
+	name string,
+	opts BucketOptions,
+) (Bucket, error) {
+	return b2Service.CreateBucketContext(context.Background(), name, opts)
+}
+
+// CreateBucketContext is the same as CreateBucket, but uses the provided
+// context for the request.
+func (b2Service *Service) CreateBucketContext(
+	ctx context.Context,
+	name string,
+	opts BucketOptions,
+) (Bucket, error) {
+	if len(opts.BucketType) == 0 {
+		opts.BucketType = BucketTypeAllPrivate
+	}
+
+	if err := validateCORSRules(opts.CORSRules, APICreateBucket); err != nil {
+		return Bucket{}, err
+	}
+
+	if b2Service.Dummy {
+		_, err := b2Service.checkLocalKeyBucket(APICreateBucket, "writeBuckets", "")
+		if err != nil {
+			return Bucket{}, err
+		}
+
+		return createLocalBucket(ctx, b2Service.LocalPath, name, opts)
+	}
+
+	var bucket Bucket
+	err := b2Service.postJSON(ctx, APICreateBucket, bucketRequest{
+		AccountID:      b2Service.AccountID,
+		BucketName:     name,
+		BucketType:     opts.BucketType,
+		BucketInfo:     opts.BucketInfo,
+		LifecycleRules: opts.lifecycleRules(),
+		CORSRules:      opts.corsRules(),
+	}, &bucket)
+
+	return bucket, err
+}
+
+// ListAllBuckets is a helper function for fetching all buckets available to
+// the account. Keys restricted to a single bucket must use ListBuckets with
+// that bucket's ID or name instead.
+func (b2Service *Service) ListAllBuckets() (BucketList, error) {
+	return b2Service.ListBuckets("", "")
+}
+
+// ListBuckets lists the buckets in the account, optionally filtered to the
+// single bucket matching `bucketID` and/or `bucketName`.
+func (b2Service *Service) ListBuckets(
+	bucketID string,
+	bucketName string,
+) (BucketList, error) {
+	return b2Service.ListBucketsContext(
+		context.Background(), bucketID, bucketName)
+}
+
+// ListBucketsContext is the same as ListBuckets, but uses the provided
+// context for the request.
+func (b2Service *Service) ListBucketsContext(
+	ctx context.Context,
+	bucketID string,
+	bucketName string,
+) (BucketList, error) {
+	if b2Service.Dummy {
+		// Dummy bucket IDs and names are the same, so either can be used to
+		// check that a restricted key is listing its own bucket
+		scope := bucketID
+		if len(scope) == 0 {
+			scope = bucketName
+		}
+
+		_, err := b2Service.checkLocalKeyBucket(APIListBuckets, "listBuckets", scope)
+		if err != nil {
+			return BucketList{}, err
+		}
+
+		return listLocalBuckets(ctx, b2Service.LocalPath, bucketID, bucketName)
+	}
+
+	var bucketList BucketList
+	err := b2Service.postJSON(ctx, APIListBuckets, bucketRequest{
+		AccountID:  b2Service.AccountID,
+		BucketID:   bucketID,
+		BucketName: bucketName,
+	}, &bucketList)
+
+	return bucketList, err
+}
+
+// UpdateBucket modifies the type, info, lifecycle rules, and/or CORS rules of
+// an existing bucket. The returned Bucket contains the bucket's new revision
+// number.
+func (b2Service *Service) UpdateBucket(
+	bucketID string,
+	opts BucketOptions,
+) (Bucket, error) {
+	return b2Service.UpdateBucketContext(context.Background(), bucketID, opts)
+}
+
+// UpdateBucketContext is the same as UpdateBucket, but uses the provided
+// context for the request.
+func (b2Service *Service) UpdateBucketContext(
+	ctx context.Context,
+	bucketID string,
+	opts BucketOptions,
+) (Bucket, error) {
+	if err := validateCORSRules(opts.CORSRules, APIUpdateBucket); err != nil {
+		return Bucket{}, err
+	}
+
+	if b2Service.Dummy {
+		_, err := b2Service.checkLocalKeyBucket(
+			APIUpdateBucket, "writeBuckets", bucketID)
+		if err != nil {
+			return Bucket{}, err
+		}
+
+		return updateLocalBucket(ctx, b2Service.LocalPath, bucketID, opts)
+	}
+
+	var bucket Bucket
+	err := b2Service.postJSON(ctx, APIUpdateBucket, bucketRequest{
+		AccountID:      b2Service.AccountID,
+		BucketID:       bucketID,
+		BucketType:     opts.BucketType,
+		BucketInfo:     opts.BucketInfo,
+		LifecycleRules: opts.lifecycleRules(),
+		CORSRules:      opts.corsRules(),
+		IfRevisionIs:   opts.IfRevisionIs,
+	}, &bucket)
+
+	return bucket, err
+}
+
+// DeleteBucket deletes an empty bucket, returning the bucket as it was
+// before being deleted.
+func (b2Service *Service) DeleteBucket(bucketID string) (Bucket, error) {
+	return b2Service.DeleteBucketContext(context.Background(), bucketID)
+}
+
+// DeleteBucketContext is the same as DeleteBucket, but uses the provided
+// context for the request.
+func (b2Service *Service) DeleteBucketContext(
+	ctx context.Context,
+	bucketID string,
+) (Bucket, error) {
+	if b2Service.Dummy {
+		_, err := b2Service.checkLocalKeyBucket(
+			APIDeleteBucket, "deleteBuckets", bucketID)
+		if err != nil {
+			return Bucket{}, err
+		}
+
+		return deleteLocalBucket(ctx, b2Service.LocalPath, bucketID)
+	}
+
+	var bucket Bucket
+	err := b2Service.postJSON(ctx, APIDeleteBucket, bucketRequest{
+		AccountID: b2Service.AccountID,
+		BucketID:  bucketID,
+	}, &bucket)
+
+	return bucket, err
+}
+
+// localBucketPath returns the path to the metadata file for a bucket created
+// by a dummy account.
+func localBucketPath(root string, bucketID string) string {
+	return localMetadataPath(root, "buckets", bucketID+".json")
+}
+
+// localBucketExists checks if a bucket has been created by a dummy account.
+func localBucketExists(root string, bucketID string) bool {
+	if len(bucketID) == 0 {
+		return false
+	}
+
+	_, err := os.Stat(localBucketPath(root, bucketID))
+	return err == nil
+}
+
+// readLocalBucket reads the metadata for a bucket created by a dummy account.
+// The endpoint is included in the error returned if the bucket doesn't exist.
+func readLocalBucket(
+	root string,
+	bucketID string,
+	endpoint string,
+) (Bucket, error) {
+	if !localBucketExists(root, bucketID) {
+		return Bucket{}, localError(http.StatusBadRequest, "bad_bucket_id",
+			endpoint, "bucket %s does not exist", bucketID)
+	}
+
+	var bucket Bucket
+	err := utils.ReadJSONFile(localBucketPath(root, bucketID), &bucket)
+	return bucket, err
+}
+
+// createLocalBucket creates a bucket as a subdirectory of the dummy account's
+// path. Dummy buckets use the bucket name as the bucket ID.
+func createLocalBucket(
+	ctx context.Context,
+	root string,
+	name string,
+	opts BucketOptions,
+) (Bucket, error) {
+	if err := ctx.Err(); err != nil {
+		return Bucket{}, err
+	} else if !bucketNameRegex.MatchString(name) || strings.HasPrefix(name, "b2-") {
+		return Bucket{}, localError(http.StatusBadRequest, "bad_request",
+			APICreateBucket, "invalid bucket name %s", name)
+	} else if localBucketExists(root, name) {
+		return Bucket{}, localError(http.StatusBadRequest,
+			"duplicate_bucket_name", APICreateBucket,
+			"bucket %s already exists", name)
+	} else if err := validateLifecycleRules(
+		opts.LifecycleRules, APICreateBucket); err != nil {
+		return Bucket{}, err
+	}
+
+	bucketPath := fmt.Sprintf("%s/%s", strings.TrimSuffix(root, "/"), name)
+	if err := os.MkdirAll(bucketPath, 0755); err != nil {
+		return Bucket{}, err
+	}
+
+	bucket := Bucket{
+		BucketID:       name,
+		BucketInfo:     opts.BucketInfo,
+		BucketName:     name,
+		BucketType:     opts.BucketType,
+		CORSRules:      opts.CORSRules,
+		LifecycleRules: opts.LifecycleRules,
+		Options:        []string{},
+		Revision:       1,
+	}
+
+	if bucket.BucketInfo == nil {
+		bucket.BucketInfo = map[string]string{}
+	}
+
+	if bucket.CORSRules == nil {
+		bucket.CORSRules = []CORSRule{}
+	}
+
+	if bucket.LifecycleRules == nil {
+		bucket.LifecycleRules = []LifecycleRule{}
+	}
+
+	return bucket, utils.WriteJSONFile(localBucketPath(root, name), bucket)
+}
+
+// listLocalBuckets returns all buckets created by a dummy account, sorted
+// by name.
+func listLocalBuckets(
+	ctx context.Context,
+	root string,
+	bucketID string,
+	bucketName string,
+) (BucketList, error) {
+	if err := ctx.Err(); err != nil {
+		return BucketList{}, err
+	}
+
+	bucketList := BucketList{Buckets: []Bucket{}}
+
+	dir, err := os.ReadDir(localMetadataPath(root, "buckets"))
+	if errors.Is(err, os.ErrNotExist) {
+		return bucketList, nil
+	} else if err != nil {
+		return BucketList{}, err
+	}
+
+	for _, entry := range dir {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if (len(bucketID) > 0 && id != bucketID) ||
+			(len(bucketName) > 0 && id != bucketName) {
+			continue
+		}
+
+		bucket, err := readLocalBucket(root, id, APIListBuckets)
+		if err != nil {
+			return BucketList{}, err
+		}
+
+		bucketList.Buckets = append(bucketList.Buckets, bucket)
+	}
+
+	sort.Slice(bucketList.Buckets, func(i, j int) bool {
+		return bucketList.Buckets[i].BucketName < bucketList.Buckets[j].BucketName
+	})
+
+	return bucketList, nil
+}
+
+// updateLocalBucket updates the metadata for a bucket created by a dummy
+// account.
+func updateLocalBucket(
+	ctx context.Context,
+	root string,
+	bucketID string,
+	opts BucketOptions,
+) (Bucket, error) {
+	if err := ctx.Err(); err != nil {
+		return Bucket{}, err
+	} else if err = validateLifecycleRules(
+		opts.LifecycleRules, APIUpdateBucket); err != nil {
+		return Bucket{}, err
+	}
+
+	bucket, err := readLocalBucket(root, bucketID, APIUpdateBucket)
+	if err != nil {
+		return Bucket{}, err
+	} else if opts.IfRevisionIs > 0 && opts.IfRevisionIs != bucket.Revision {
+		return Bucket{}, localError(http.StatusConflict, "conflict",
+			APIUpdateBucket, "bucket revision is %d, not %d",
+			bucket.Revision, opts.IfRevisionIs)
+	}
+
+	if len(opts.BucketType) > 0 {
+		bucket.BucketType = opts.BucketType
+	}
+
+	if opts.BucketInfo != nil {
+		bucket.BucketInfo = opts.BucketInfo
+	}
+
+	if opts.LifecycleRules != nil {
+		bucket.LifecycleRules = opts.LifecycleRules
+	}
+
+	if opts.CORSRules != nil {
+		bucket.CORSRules = opts.CORSRules
+	}
+
+	bucket.Revision += 1
+	return bucket, utils.WriteJSONFile(localBucketPath(root, bucketID), bucket)
+}
+
+// deleteLocalBucket removes an empty bucket created by a dummy account.
+func deleteLocalBucket(
+	ctx context.Context,
+	root string,
+	bucketID string,
+) (Bucket, error) {
+	if err := ctx.Err(); err != nil {
+		return Bucket{}, err
+	}
+
+	bucket, err := readLocalBucket(root, bucketID, APIDeleteBucket)
+	if err != nil {
+		return Bucket{}, err
+	}
+
+	bucketPath := fmt.Sprintf("%s/%s", strings.TrimSuffix(root, "/"), bucketID)
+	if err = os.Remove(bucketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Bucket{}, localError(http.StatusBadRequest,
+			"cannot_delete_non_empty_bucket", APIDeleteBucket,
+			"bucket %s is not empty", bucketID)
+	}
+
+	err = os.Remove(localNotificationRulesPath(root, bucketID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Bucket{}, err
+	}
+
+	return bucket, os.Remove(localBucketPath(root, bucketID))
+}
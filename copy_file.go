@@ -0,0 +1,383 @@
+package b2
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const APICopyFile = "b2_copy_file"
+const APICopyPart = "b2_copy_part"
+
+const MetadataDirectiveCopy = "COPY"
+const MetadataDirectiveReplace = "REPLACE"
+
+// ByteRange is an inclusive range of bytes within a file, i.e. a Begin of 0
+// and an End of 99 is the first 100 bytes of the file.
+type ByteRange struct {
+	Begin int64
+	End   int64
+}
+
+// String formats the range as an HTTP "Range" value. An End of -1 is
+// formatted as an open-ended range.
+func (byteRange ByteRange) String() string {
+	if byteRange.End < 0 {
+		return fmt.Sprintf("bytes=%d-", byteRange.Begin)
+	}
+
+	return fmt.Sprintf("bytes=%d-%d", byteRange.Begin, byteRange.End)
+}
+
+// bounds returns the beginning and end of the range, or the bounds of the
+// entire file if the range is nil.
+func (byteRange *ByteRange) bounds() (int64, int64) {
+	if byteRange == nil {
+		return 0, -1
+	}
+
+	return byteRange.Begin, byteRange.End
+}
+
+// Part represents the data returned by CopyPart
+type Part struct {
+	FileID          string `json:"fileId"`
+	PartNumber      int    `json:"partNumber"`
+	ContentLength   int64  `json:"contentLength"`
+	ContentSha1     string `json:"contentSha1"`
+	ContentMd5      string `json:"contentMd5"`
+	UploadTimestamp int64  `json:"uploadTimestamp"`
+}
+
+// CopyFileOptions contains optional settings for CopyFile.
+type CopyFileOptions struct {
+	// DestinationBucketID is the ID of the bucket the new file is created
+	// in. Defaults to the bucket of the source file.
+	DestinationBucketID string
+
+	// Range is the portion of the source file to copy. Defaults to the
+	// entire file.
+	Range *ByteRange
+
+	// MetadataDirective is either MetadataDirectiveCopy (the default), which
+	// copies the content type and file info of the source file, or
+	// MetadataDirectiveReplace, which uses ContentType and FileInfo instead.
+	MetadataDirective string
+
+	// ContentType is the MIME type of the new file, and is required when
+	// using MetadataDirectiveReplace.
+	ContentType string
+
+	// FileInfo contains custom info stored with the new file when using
+	// MetadataDirectiveReplace.
+	FileInfo map[string]string
+
+	// SourceEncryption contains the customer key of the source file, if it
+	// was encrypted with SSEModeC.
+	SourceEncryption *ServerSideEncryption
+
+	// DestinationEncryption sets the server-side encryption used for storing
+	// the new file. Defaults to the destination bucket's default encryption.
+	DestinationEncryption *ServerSideEncryption
+}
+
+// CopyPartOptions contains optional settings for CopyPartWithOptions.
+type CopyPartOptions struct {
+	// Range is the portion of the source file to copy. Defaults to the
+	// entire file.
+	Range *ByteRange
+
+	// SourceEncryption contains the customer key of the source file, if it
+	// was encrypted with SSEModeC.
+	SourceEncryption *ServerSideEncryption
+
+	// DestinationEncryption contains the customer key of the large file, if
+	// it was started with SSEModeC.
+	DestinationEncryption *ServerSideEncryption
+}
+
+// copyFileRequest is the request body for b2_copy_file
+type copyFileRequest struct {
+	SourceFileID        string            `json:"sourceFileId"`
+	DestinationBucketID string            `json:"destinationBucketId,omitempty"`
+	FileName            string            `json:"fileName"`
+	Range               string            `json:"range,omitempty"`
+	MetadataDirective   string            `json:"metadataDirective,omitempty"`
+	ContentType         string            `json:"contentType,omitempty"`
+	FileInfo            map[string]string `json:"fileInfo,omitempty"`
+
+	SourceEncryption      *sseRequest `json:"sourceServerSideEncryption,omitempty"`
+	DestinationEncryption *sseRequest `json:"destinationServerSideEncryption,omitempty"`
+}
+
+// copyPartRequest is the request body for b2_copy_part
+type copyPartRequest struct {
+	SourceFileID string `json:"sourceFileId"`
+	LargeFileID  string `json:"largeFileId"`
+	PartNumber   int    `json:"partNumber"`
+	Range        string `json:"range,omitempty"`
+
+	SourceEncryption      *sseRequest `json:"sourceServerSideEncryption,omitempty"`
+	DestinationEncryption *sseRequest `json:"destinationServerSideEncryption,omitempty"`
+}
+
+// CopyFile creates a new file named `destName` from the contents of an
+// existing file, without needing to download and upload the contents again.
+// The source file can be up to 5 GB; larger files should be copied in parts
+// using StartLargeFile, CopyPart, and FinishLargeFile.
+func (b2Service *Service) CopyFile(
+	sourceFileID string,
+	destName string,
+	opts CopyFileOptions,
+) (File, error) {
+	return b2Service.CopyFileContext(
+		context.Background(), sourceFileID, destName, opts)
+}
+
+// CopyFileContext is the same as CopyFile, but uses the provided context for
+// the request.
+func (b2Service *Service) CopyFileContext(
+	ctx context.Context,
+	sourceFileID string,
+	destName string,
+	opts CopyFileOptions,
+) (File, error) {
+	if opts.MetadataDirective == MetadataDirectiveReplace &&
+		len(opts.ContentType) == 0 {
+		return File{}, localError(http.StatusBadRequest, "bad_request",
+			APICopyFile, "contentType is required for the REPLACE directive")
+	}
+
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFileID(APICopyFile, "readFiles", sourceFileID)
+		if err != nil {
+			return File{}, err
+		}
+
+		file, err := b2Service.copyLocalFile(ctx, sourceFileID, destName, opts)
+		if err == nil {
+			b2Service.notifyLocalEvent(ctx,
+				b2Service.LocalPath, file.event(EventObjectCreatedCopy))
+		}
+
+		return file, err
+	}
+
+	reqBody := copyFileRequest{
+		SourceFileID:        sourceFileID,
+		DestinationBucketID: opts.DestinationBucketID,
+		FileName:            destName,
+		MetadataDirective:   opts.MetadataDirective,
+
+		SourceEncryption:      opts.SourceEncryption.request(),
+		DestinationEncryption: opts.DestinationEncryption.request(),
+	}
+
+	if opts.Range != nil {
+		reqBody.Range = opts.Range.String()
+	}
+
+	if opts.MetadataDirective == MetadataDirectiveReplace {
+		reqBody.ContentType = opts.ContentType
+		reqBody.FileInfo = opts.FileInfo
+	}
+
+	var file File
+	err := b2Service.postJSON(ctx, APICopyFile, reqBody, &file)
+	return file, err
+}
+
+// CopyPart copies the contents of an existing file (or the portion in
+// `byteRange`, if not nil) into a part of a large file started with
+// StartLargeFile. The returned Part's ContentSha1 should be included in the
+// checksums passed to FinishLargeFile.
+func (b2Service *Service) CopyPart(
+	sourceFileID string,
+	largeFileID string,
+	partNumber int,
+	byteRange *ByteRange,
+) (Part, error) {
+	return b2Service.CopyPartContext(
+		context.Background(), sourceFileID, largeFileID, partNumber, byteRange)
+}
+
+// CopyPartContext is the same as CopyPart, but uses the provided context for
+// the request.
+func (b2Service *Service) CopyPartContext(
+	ctx context.Context,
+	sourceFileID string,
+	largeFileID string,
+	partNumber int,
+	byteRange *ByteRange,
+) (Part, error) {
+	return b2Service.CopyPartWithOptionsContext(
+		ctx, sourceFileID, largeFileID, partNumber,
+		CopyPartOptions{Range: byteRange})
+}
+
+// CopyPartWithOptions is the same as CopyPart, but allows copying from or to
+// a file encrypted with a customer key.
+func (b2Service *Service) CopyPartWithOptions(
+	sourceFileID string,
+	largeFileID string,
+	partNumber int,
+	opts CopyPartOptions,
+) (Part, error) {
+	return b2Service.CopyPartWithOptionsContext(
+		context.Background(), sourceFileID, largeFileID, partNumber, opts)
+}
+
+// CopyPartWithOptionsContext is the same as CopyPartWithOptions, but uses the
+// provided context for the request.
+func (b2Service *Service) CopyPartWithOptionsContext(
+	ctx context.Context,
+	sourceFileID string,
+	largeFileID string,
+	partNumber int,
+	opts CopyPartOptions,
+) (Part, error) {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFileID(APICopyPart, "readFiles", sourceFileID)
+		if err != nil {
+			return Part{}, err
+		}
+
+		return b2Service.copyLocalPart(
+			ctx, sourceFileID, largeFileID, partNumber, opts)
+	}
+
+	reqBody := copyPartRequest{
+		SourceFileID: sourceFileID,
+		LargeFileID:  largeFileID,
+		PartNumber:   partNumber,
+
+		SourceEncryption:      opts.SourceEncryption.request(),
+		DestinationEncryption: opts.DestinationEncryption.request(),
+	}
+
+	if opts.Range != nil {
+		reqBody.Range = opts.Range.String()
+	}
+
+	var part Part
+	err := b2Service.postJSON(ctx, APICopyPart, reqBody, &part)
+	return part, err
+}
+
+// openLocalRange opens the portion of a dummy account's local file within
+// `byteRange`, or the entire file if `byteRange` is nil.
+func openLocalRange(
+	ctx context.Context,
+	root string,
+	id string,
+	byteRange *ByteRange,
+	sse *ServerSideEncryption,
+	endpoint string,
+) (io.ReadCloser, DownloadInfo, error) {
+	begin, end := byteRange.bounds()
+	reader, info, err := openLocalFile(ctx, id, root, begin, end, sse)
+	return reader, info, withEndpoint(err, endpoint)
+}
+
+// copyLocalFile copies a local file rather than copying it within B2. If no
+// destination bucket is provided, the file is copied within the source
+// file's bucket.
+func (b2Service *Service) copyLocalFile(
+	ctx context.Context,
+	sourceFileID string,
+	destName string,
+	opts CopyFileOptions,
+) (File, error) {
+	reader, info, err := openLocalRange(
+		ctx, b2Service.LocalPath, sourceFileID, opts.Range,
+		opts.SourceEncryption, APICopyFile)
+	if err != nil {
+		return File{}, err
+	}
+
+	defer func(reader io.ReadCloser) {
+		_ = reader.Close()
+	}(reader)
+
+	bucketID := opts.DestinationBucketID
+	if len(bucketID) == 0 {
+		bucketID, _ = splitLocalFileID(b2Service.LocalPath, sourceFileID)
+	}
+
+	uploadInfo, err := b2Service.GetUploadURLContext(ctx, bucketID)
+	if err != nil {
+		return File{}, withEndpoint(err, APICopyFile)
+	}
+
+	// Like B2, the source file's metadata is copied unless it's replaced
+	uploadOpts := UploadOptions{
+		ContentType: info.ContentType,
+		FileInfo:    info.FileInfo,
+	}
+
+	if opts.MetadataDirective == MetadataDirectiveReplace {
+		uploadOpts = UploadOptions{
+			ContentType: opts.ContentType,
+			FileInfo:    opts.FileInfo,
+		}
+	}
+
+	// The source can be copied onto its own name, since the upload only
+	// replaces the existing file after all of the source has been read
+	uploadOpts.Encryption = opts.DestinationEncryption
+	file, err := uploadLocalFile(
+		ctx, uploadInfo, destName, reader, info.ContentLength, uploadOpts)
+	if err != nil {
+		return File{}, withEndpoint(err, APICopyFile)
+	}
+
+	file.Action = ActionCopy
+	return file, nil
+}
+
+// copyLocalPart copies a local file into a part of a large file started by a
+// dummy account.
+func (b2Service *Service) copyLocalPart(
+	ctx context.Context,
+	sourceFileID string,
+	largeFileID string,
+	partNumber int,
+	opts CopyPartOptions,
+) (Part, error) {
+	reader, _, err := openLocalRange(
+		ctx, b2Service.LocalPath, sourceFileID, opts.Range,
+		opts.SourceEncryption, APICopyPart)
+	if err != nil {
+		return Part{}, err
+	}
+
+	defer func(reader io.ReadCloser) {
+		_ = reader.Close()
+	}(reader)
+
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return Part{}, err
+	}
+
+	partInfo, err := b2Service.GetUploadPartURLContext(ctx, largeFileID)
+	if err != nil {
+		return Part{}, withEndpoint(err, APICopyPart)
+	}
+
+	checksum := fmt.Sprintf("%x", sha1.Sum(contents))
+	err = uploadLocalFilePart(ctx, partInfo, partNumber, checksum, contents,
+		PartOptions{Encryption: opts.DestinationEncryption})
+	if err != nil {
+		return Part{}, withEndpoint(err, APICopyPart)
+	}
+
+	return Part{
+		FileID:        largeFileID,
+		PartNumber:    partNumber,
+		ContentLength: int64(len(contents)),
+		ContentSha1:   checksum,
+	}, nil
+}
@@ -0,0 +1,194 @@
+package b2
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Operations that can be allowed by a CORS rule
+const (
+	CORSOperationDownloadFileByName = "b2_download_file_by_name"
+	CORSOperationDownloadFileById   = "b2_download_file_by_id"
+	CORSOperationUploadFile         = "b2_upload_file"
+	CORSOperationUploadPart         = "b2_upload_part"
+	CORSOperationS3Delete           = "s3_delete"
+	CORSOperationS3Get              = "s3_get"
+	CORSOperationS3Head             = "s3_head"
+	CORSOperationS3Post             = "s3_post"
+	CORSOperationS3Put              = "s3_put"
+)
+
+// corsOperations contains each operation name accepted by B2
+var corsOperations = map[string]bool{
+	CORSOperationDownloadFileByName: true,
+	CORSOperationDownloadFileById:   true,
+	CORSOperationUploadFile:         true,
+	CORSOperationUploadPart:         true,
+	CORSOperationS3Delete:           true,
+	CORSOperationS3Get:              true,
+	CORSOperationS3Head:             true,
+	CORSOperationS3Post:             true,
+	CORSOperationS3Put:              true,
+}
+
+// Limits on CORS rules enforced by B2
+const (
+	maxCORSRules         = 100
+	maxCORSMaxAgeSeconds = 86400
+)
+
+// CORSRule allows browsers on other origins to access a bucket's files. B2
+// uses the first rule that matches a request, so rules should be ordered
+// from most to least specific.
+type CORSRule struct {
+	// CORSRuleName is a unique name for the rule, using the same format as
+	// bucket names.
+	CORSRuleName string `json:"corsRuleName"`
+
+	// AllowedOrigins contains the origins that the rule applies to, such as
+	// "https://example.com". Each origin can contain one "*" wildcard, and
+	// an origin of "*" matches every origin.
+	AllowedOrigins []string `json:"allowedOrigins"`
+
+	// AllowedOperations contains the operations that the rule applies to,
+	// using the CORSOperation constants.
+	AllowedOperations []string `json:"allowedOperations"`
+
+	// AllowedHeaders contains the headers that browsers are allowed to send
+	// in requests, and can use "*" wildcards (e.g. "x-bz-info-*").
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+
+	// ExposeHeaders contains the response headers that browsers are allowed
+	// to read.
+	ExposeHeaders []string `json:"exposeHeaders,omitempty"`
+
+	// MaxAgeSeconds is how long browsers can cache the result of a preflight
+	// request, up to one day.
+	MaxAgeSeconds int `json:"maxAgeSeconds"`
+}
+
+// validateCORSRules checks that each CORS rule is valid before it's sent
+func validateCORSRules(rules []CORSRule, endpoint string) error {
+	invalid := func(format string, v ...any) error {
+		return localError(http.StatusBadRequest, "bad_request", endpoint,
+			format, v...)
+	}
+
+	if len(rules) > maxCORSRules {
+		return invalid("buckets can't have more than %d CORS rules",
+			maxCORSRules)
+	}
+
+	names := map[string]bool{}
+	for _, rule := range rules {
+		name := rule.CORSRuleName
+		if !bucketNameRegex.MatchString(name) || strings.HasPrefix(name, "b2-") {
+			return invalid("invalid CORS rule name %q", name)
+		} else if names[name] {
+			return invalid("duplicate CORS rule name %q", name)
+		} else if len(rule.AllowedOrigins) == 0 {
+			return invalid("CORS rule %s has no allowed origins", name)
+		} else if len(rule.AllowedOperations) == 0 {
+			return invalid("CORS rule %s has no allowed operations", name)
+		} else if rule.MaxAgeSeconds < 0 ||
+			rule.MaxAgeSeconds > maxCORSMaxAgeSeconds {
+			return invalid("CORS rule %s maxAgeSeconds must be between 0 "+
+				"and %d", name, maxCORSMaxAgeSeconds)
+		}
+
+		names[name] = true
+
+		for _, origin := range rule.AllowedOrigins {
+			if len(origin) == 0 || strings.Count(origin, "*") > 1 {
+				return invalid("CORS rule %s has invalid origin %q",
+					name, origin)
+			}
+		}
+
+		for _, operation := range rule.AllowedOperations {
+			if !corsOperations[operation] {
+				return invalid("CORS rule %s has invalid operation %q",
+					name, operation)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CORSPreflight contains the details of a browser's preflight (OPTIONS)
+// request, which is checked against a bucket's CORS rules before the actual
+// request is sent.
+type CORSPreflight struct {
+	// Origin is the value of the request's Origin header
+	Origin string
+
+	// Operation is the B2 operation the browser wants to use, using the
+	// CORSOperation constants.
+	Operation string
+
+	// Headers contains the values of the request's
+	// Access-Control-Request-Headers header.
+	Headers []string
+}
+
+// EvaluateCORSPreflight checks a preflight request against a set of CORS
+// rules in the same way as B2, returning the first rule that allows the
+// request. If none of the rules allow the request, false is returned and the
+// browser would block the request.
+func EvaluateCORSPreflight(
+	rules []CORSRule,
+	preflight CORSPreflight,
+) (CORSRule, bool) {
+	for _, rule := range rules {
+		if matchesCORSRule(rule, preflight) {
+			return rule, true
+		}
+	}
+
+	return CORSRule{}, false
+}
+
+// matchesCORSRule checks if a single CORS rule allows a preflight request
+func matchesCORSRule(rule CORSRule, preflight CORSPreflight) bool {
+	if !matchesAnyCORSPattern(rule.AllowedOrigins, preflight.Origin) {
+		return false
+	}
+
+	allowed := false
+	for _, operation := range rule.AllowedOperations {
+		allowed = allowed || operation == preflight.Operation
+	}
+
+	if !allowed {
+		return false
+	}
+
+	for _, header := range preflight.Headers {
+		header = strings.TrimSpace(header)
+		if len(header) > 0 && !matchesAnyCORSPattern(rule.AllowedHeaders, header) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesAnyCORSPattern checks if a value matches at least one of the
+// patterns, ignoring case. Each pattern can contain a single "*" wildcard.
+func matchesAnyCORSPattern(patterns []string, value string) bool {
+	value = strings.ToLower(value)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		prefix, suffix, wildcard := strings.Cut(pattern, "*")
+		if !wildcard && pattern == value {
+			return true
+		} else if wildcard && len(value) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(value, prefix) &&
+			strings.HasSuffix(value, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,12 +1,12 @@
 package b2
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"github.com/benbusby/b2/utils"
 	"net/http"
-	"net/http/httputil"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -15,51 +15,158 @@ const APIDeleteFile = "b2_delete_file_version"
 // DeleteFile removes a file from B2 using the file's ID and name. Both fields
 // are required, and are provided when a file finishes uploading.
 func (b2Service *Service) DeleteFile(b2ID string, name string) (bool, error) {
-	if b2Service.Dummy {
-		return deleteLocalFile(b2ID, b2Service.LocalPath)
-	}
+	return b2Service.DeleteFileContext(context.Background(), b2ID, name)
+}
 
-	reqBody := bytes.NewBuffer([]byte(fmt.Sprintf(`{
-		"fileId": "%s",
-		"fileName": "%s"
-	}`, b2ID, name)))
+// DeleteFileContext is the same as DeleteFile, but uses the provided context
+// for the request.
+func (b2Service *Service) DeleteFileContext(
+	ctx context.Context,
+	b2ID string,
+	name string,
+) (bool, error) {
+	return b2Service.DeleteFileWithOptionsContext(
+		ctx, b2ID, name, DeleteOptions{})
+}
 
-	reqURL := utils.FormatB2URL(
-		b2Service.APIURL, b2Service.APIVersion, APIDeleteFile)
+// DeleteOptions contains optional settings for DeleteFileWithOptions.
+type DeleteOptions struct {
+	// BypassGovernance allows deleting a file with governance mode retention
+	// that hasn't expired yet, and requires a key with the
+	// "bypassGovernance" capability.
+	BypassGovernance bool
+}
 
-	req, err := http.NewRequest("POST", reqURL, reqBody)
-	if err != nil {
-		b2Service.Logf("B2Error creating new HTTP request: %v\n", err)
-		return false, err
-	}
+// deleteFileRequest is the request body for b2_delete_file_version
+type deleteFileRequest struct {
+	FileID           string `json:"fileId"`
+	FileName         string `json:"fileName"`
+	BypassGovernance bool   `json:"bypassGovernance,omitempty"`
+}
 
-	req.Header = http.Header{
-		"Authorization": {b2Service.AuthorizationToken},
+// DeleteFileWithOptions is the same as DeleteFile, but allows bypassing the
+// governance mode retention of a file.
+func (b2Service *Service) DeleteFileWithOptions(
+	b2ID string,
+	name string,
+	opts DeleteOptions,
+) (bool, error) {
+	return b2Service.DeleteFileWithOptionsContext(
+		context.Background(), b2ID, name, opts)
+}
+
+// DeleteFileWithOptionsContext is the same as DeleteFileWithOptions, but uses
+// the provided context for the request.
+func (b2Service *Service) DeleteFileWithOptionsContext(
+	ctx context.Context,
+	b2ID string,
+	name string,
+	opts DeleteOptions,
+) (bool, error) {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFileID(APIDeleteFile, "deleteFiles", b2ID)
+		if err == nil && opts.BypassGovernance {
+			err = b2Service.checkLocalKeyFileID(
+				APIDeleteFile, "bypassGovernance", b2ID)
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		deleted, err := deleteLocalFile(
+			ctx, b2ID, b2Service.LocalPath, opts.BypassGovernance)
+		if deleted && err == nil {
+			b2Service.notifyLocalDelete(ctx, b2ID, EventObjectDeletedDelete)
+		}
+
+		return deleted, err
 	}
 
-	res, err := utils.Client.Do(req)
+	var res struct{}
+	err := b2Service.postJSON(ctx, APIDeleteFile, deleteFileRequest{
+		FileID:           b2ID,
+		FileName:         name,
+		BypassGovernance: opts.BypassGovernance,
+	}, &res)
 	if err != nil {
-		b2Service.Logf("%s error: %v\n", APIDeleteFile, err)
 		return false, err
-	} else if res.StatusCode >= 400 {
-		b2Service.Logf("%s err: %d\n", APIDeleteFile, res.StatusCode)
-		resp, _ := httputil.DumpResponse(res, true)
-		return false, utils.NewB2Error(nil, string(resp))
 	}
 
 	return true, nil
 }
 
-// deleteLocalFile removes a file from the local machine
-func deleteLocalFile(id string, path string) (bool, error) {
-	if len(id) == 0 {
+// deleteLocalFile removes a file from the local machine, unless the file is
+// locked by a legal hold or retention.
+func deleteLocalFile(
+	ctx context.Context,
+	id string,
+	path string,
+	bypassGovernance bool,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	} else if len(id) == 0 {
 		return false, nil
 	}
 
+	// Deleting a hide marker makes the hidden file visible again
+	if fileID, ok := strings.CutPrefix(id, localHideMarkerPrefix); ok {
+		unhidden, err := unhideLocalFile(path, fileID)
+		if err != nil {
+			return false, err
+		} else if !unhidden {
+			return false, localError(http.StatusBadRequest, "file_not_present",
+				APIDeleteFile, "file %s does not exist", id)
+		}
+
+		return true, nil
+	}
+
+	err := checkLocalFileLock(path, id, bypassGovernance, APIDeleteFile)
+	if err != nil {
+		return false, err
+	}
+
 	fullPath := fmt.Sprintf("%s/%s", strings.TrimSuffix(path, "/"), id)
-	if err := os.Remove(fullPath); err != nil {
+	if err = os.Remove(fullPath); errors.Is(err, os.ErrNotExist) {
+		return false, localError(http.StatusBadRequest, "file_not_present",
+			APIDeleteFile, "file %s does not exist", id)
+	} else if err != nil {
 		return false, err
 	}
 
-	return true, nil
+	if err := removeEmptyLocalDirs(path, id); err != nil {
+		return false, err
+	} else if err = removeLocalFileMetadata(path, id); err != nil {
+		return false, err
+	}
+
+	_, err = unhideLocalFile(path, id)
+	return true, err
+}
+
+// removeEmptyLocalDirs removes the subdirectories that were created for a
+// deleted file's name, as long as no other files are stored in them. Like B2,
+// folders only exist while they contain at least one file.
+func removeEmptyLocalDirs(root string, id string) error {
+	bucketID, _ := splitLocalFileID(root, id)
+	stop := filepath.Join(root, bucketID)
+
+	dir := filepath.Dir(filepath.Join(root, id))
+	for {
+		rel, err := filepath.Rel(stop, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return err
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			return err
+		} else if err = os.Remove(dir); err != nil {
+			return err
+		}
+
+		dir = filepath.Dir(dir)
+	}
 }
@@ -0,0 +1,324 @@
+package b2
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const APIGetDownloadAuthorization = "b2_get_download_authorization"
+
+// localDownloadTokenPrefix is prepended to download authorization tokens
+// created by dummy accounts.
+const localDownloadTokenPrefix = "dummy"
+
+// DownloadAuthorization represents the data returned by
+// GetDownloadAuthorization
+type DownloadAuthorization struct {
+	BucketID           string `json:"bucketId"`
+	FileNamePrefix     string `json:"fileNamePrefix"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+// DownloadOverrides contains optional values that B2 returns in place of the
+// file's stored headers when downloading the file. If any are set when
+// calling GetDownloadAuthorization, downloads using the authorization token
+// must include the same values.
+type DownloadOverrides struct {
+	ContentDisposition string `json:"b2ContentDisposition,omitempty"`
+	ContentLanguage    string `json:"b2ContentLanguage,omitempty"`
+	Expires            string `json:"b2Expires,omitempty"`
+	CacheControl       string `json:"b2CacheControl,omitempty"`
+	ContentEncoding    string `json:"b2ContentEncoding,omitempty"`
+	ContentType        string `json:"b2ContentType,omitempty"`
+}
+
+// values returns the overrides as URL query values
+func (overrides DownloadOverrides) values() url.Values {
+	values := url.Values{}
+	for name, value := range map[string]string{
+		"b2ContentDisposition": overrides.ContentDisposition,
+		"b2ContentLanguage":    overrides.ContentLanguage,
+		"b2Expires":            overrides.Expires,
+		"b2CacheControl":       overrides.CacheControl,
+		"b2ContentEncoding":    overrides.ContentEncoding,
+		"b2ContentType":        overrides.ContentType,
+	} {
+		if len(value) > 0 {
+			values.Set(name, value)
+		}
+	}
+
+	return values
+}
+
+// downloadAuthorizationRequest is the request body for
+// b2_get_download_authorization
+type downloadAuthorizationRequest struct {
+	BucketID               string `json:"bucketId"`
+	FileNamePrefix         string `json:"fileNamePrefix"`
+	ValidDurationInSeconds int64  `json:"validDurationInSeconds"`
+	DownloadOverrides
+}
+
+// GetDownloadAuthorization creates a token that can be used to download
+// files in a private bucket whose names begin with `prefix`, without needing
+// the account's authorization token. The token expires after
+// `validDuration`, which B2 limits to between one second and one week.
+func (b2Service *Service) GetDownloadAuthorization(
+	bucketID string,
+	prefix string,
+	validDuration time.Duration,
+	opts DownloadOverrides,
+) (DownloadAuthorization, error) {
+	return b2Service.GetDownloadAuthorizationContext(
+		context.Background(), bucketID, prefix, validDuration, opts)
+}
+
+// GetDownloadAuthorizationContext is the same as GetDownloadAuthorization,
+// but uses the provided context for the request.
+func (b2Service *Service) GetDownloadAuthorizationContext(
+	ctx context.Context,
+	bucketID string,
+	prefix string,
+	validDuration time.Duration,
+	opts DownloadOverrides,
+) (DownloadAuthorization, error) {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFile(
+			APIGetDownloadAuthorization, "shareFiles", bucketID, prefix)
+		if err != nil {
+			return DownloadAuthorization{}, err
+		}
+
+		return getLocalDownloadAuthorization(
+			ctx, b2Service.LocalPath, bucketID, prefix, validDuration, opts)
+	}
+
+	var auth DownloadAuthorization
+	err := b2Service.postJSON(ctx, APIGetDownloadAuthorization,
+		downloadAuthorizationRequest{
+			BucketID:               bucketID,
+			FileNamePrefix:         prefix,
+			ValidDurationInSeconds: int64(validDuration / time.Second),
+			DownloadOverrides:      opts,
+		}, &auth)
+
+	return auth, err
+}
+
+// SignedDownloadURL returns a URL for downloading a file by name using a
+// download authorization token from GetDownloadAuthorization, which can be
+// handed to a browser without exposing the account's authorization token.
+// The overrides must match the ones used when creating the token, if any
+// were provided.
+//
+// Dummy accounts without a DownloadURL return a URL relative to the root of
+// the server, which can be checked with ValidateSignedDownloadURL.
+func (b2Service *Service) SignedDownloadURL(
+	bucketName string,
+	fileName string,
+	auth DownloadAuthorization,
+	overrides DownloadOverrides,
+) (string, error) {
+	req, err := setupDownloadByName(
+		context.Background(), b2Service.downloadURL(), bucketName, fileName)
+	if err != nil {
+		return "", err
+	}
+
+	query := overrides.values()
+	query.Set("Authorization", auth.AuthorizationToken)
+	req.URL.RawQuery = query.Encode()
+
+	return req.URL.String(), nil
+}
+
+// localDownloadClaims are the values signed in a dummy account's download
+// authorization token
+type localDownloadClaims struct {
+	BucketID       string `json:"bucketId"`
+	FileNamePrefix string `json:"fileNamePrefix"`
+	Expires        int64  `json:"expires"`
+	DownloadOverrides
+}
+
+// ValidateSignedDownloadURL checks that a URL returned by SignedDownloadURL
+// for a dummy account has a valid, unexpired authorization token for the
+// file, and that any overrides included in the token are present in the URL.
+// The bucket and file name from the URL are returned, and can be passed to
+// DownloadByName.
+//
+// Only URLs created by dummy accounts can be validated, since B2 validates
+// its own download authorization tokens.
+func (b2Service *Service) ValidateSignedDownloadURL(
+	signedURL string,
+) (string, string, error) {
+	if !b2Service.Dummy {
+		return "", "", errors.New(
+			"signed download URLs can only be validated by dummy accounts")
+	}
+
+	invalid := func(format string, v ...any) error {
+		return localError(http.StatusUnauthorized, "unauthorized",
+			APIDownloadByName, format, v...)
+	}
+
+	parsedURL, err := url.Parse(signedURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, path, found := strings.Cut(parsedURL.Path, "/file/")
+	bucketName, fileName, _ := strings.Cut(path, "/")
+	if !found || len(bucketName) == 0 || len(fileName) == 0 {
+		return "", "", localError(http.StatusBadRequest, "bad_request",
+			APIDownloadByName, "invalid download URL %s", signedURL)
+	}
+
+	query := parsedURL.Query()
+	claims, err := parseLocalDownloadToken(
+		b2Service.LocalPath, query.Get("Authorization"))
+	if err != nil {
+		return "", "", err
+	} else if time.Now().Unix() > claims.Expires {
+		return "", "", invalid("download authorization has expired")
+	} else if claims.BucketID != bucketName ||
+		!strings.HasPrefix(fileName, claims.FileNamePrefix) {
+		return "", "", invalid("download authorization is not valid for %s",
+			fileName)
+	}
+
+	for name, values := range claims.DownloadOverrides.values() {
+		if query.Get(name) != values[0] {
+			return "", "", invalid("%s does not match download authorization",
+				name)
+		}
+	}
+
+	return bucketName, fileName, nil
+}
+
+// localDownloadSecret returns the key used by a dummy account to sign
+// download authorization tokens, creating it if it doesn't exist yet.
+func localDownloadSecret(root string) ([]byte, error) {
+	secretPath := localMetadataPath(root, "download_secret")
+	secret, err := os.ReadFile(secretPath)
+	if err == nil {
+		return hex.DecodeString(string(secret))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	secret = make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	} else if err = os.MkdirAll(localMetadataPath(root), 0755); err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(secretPath, []byte(hex.EncodeToString(secret)), 0600)
+	return secret, err
+}
+
+// signLocalDownloadToken returns the HMAC-SHA256 signature of an encoded
+// download authorization token payload.
+func signLocalDownloadToken(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getLocalDownloadAuthorization creates a download authorization token for a
+// dummy account, in the format "dummy.<payload>.<signature>".
+func getLocalDownloadAuthorization(
+	ctx context.Context,
+	root string,
+	bucketID string,
+	prefix string,
+	validDuration time.Duration,
+	opts DownloadOverrides,
+) (DownloadAuthorization, error) {
+	if err := ctx.Err(); err != nil {
+		return DownloadAuthorization{}, err
+	} else if validDuration < time.Second || validDuration > 7*24*time.Hour {
+		return DownloadAuthorization{}, localError(http.StatusBadRequest,
+			"bad_request", APIGetDownloadAuthorization,
+			"validDurationInSeconds must be between 1 and 604800")
+	}
+
+	secret, err := localDownloadSecret(root)
+	if err != nil {
+		return DownloadAuthorization{}, err
+	}
+
+	claims, err := json.Marshal(localDownloadClaims{
+		BucketID:          bucketID,
+		FileNamePrefix:    prefix,
+		Expires:           time.Now().Add(validDuration).Unix(),
+		DownloadOverrides: opts,
+	})
+	if err != nil {
+		return DownloadAuthorization{}, err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	token := fmt.Sprintf("%s.%s.%s",
+		localDownloadTokenPrefix,
+		payload,
+		signLocalDownloadToken(secret, payload))
+
+	return DownloadAuthorization{
+		BucketID:           bucketID,
+		FileNamePrefix:     prefix,
+		AuthorizationToken: token,
+	}, nil
+}
+
+// parseLocalDownloadToken verifies the signature of a dummy account's
+// download authorization token, and returns the claims stored in it.
+func parseLocalDownloadToken(
+	root string,
+	token string,
+) (localDownloadClaims, error) {
+	invalid := localError(http.StatusUnauthorized, "bad_auth_token",
+		APIDownloadByName, "invalid download authorization token")
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != localDownloadTokenPrefix {
+		return localDownloadClaims{}, invalid
+	}
+
+	secret, err := localDownloadSecret(root)
+	if err != nil {
+		return localDownloadClaims{}, err
+	}
+
+	expected := signLocalDownloadToken(secret, parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return localDownloadClaims{}, invalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return localDownloadClaims{}, invalid
+	}
+
+	var claims localDownloadClaims
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return localDownloadClaims{}, invalid
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,227 @@
+package b2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const APIDownloadByName string = "b2_download_file_by_name"
+
+// escapeB2Value percent-encodes a file name or file info value for use in a
+// URL or header. Each segment of the value is escaped separately, since B2
+// expects the "/" separators to be left as-is. B2 decodes "+" as a space, so
+// it needs to be escaped as well.
+func escapeB2Value(value string) string {
+	segments := strings.Split(value, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// setupDownloadByName creates an http.Request with the URL for downloading a
+// file by its bucket name and file name.
+func setupDownloadByName(
+	ctx context.Context,
+	downloadURL string,
+	bucketName string,
+	fileName string,
+) (*http.Request, error) {
+	reqURL := fmt.Sprintf(
+		"%s/file/%s/%s",
+		strings.TrimSuffix(downloadURL, "/"),
+		url.PathEscape(bucketName),
+		escapeB2Value(fileName))
+
+	return http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+}
+
+// DownloadByName downloads an entire file from B2 using the name of the
+// bucket it's stored in and the name of the file, rather than the file ID.
+func (b2Service *Service) DownloadByName(
+	bucketName string,
+	fileName string,
+) ([]byte, error) {
+	return b2Service.DownloadByNameContext(
+		context.Background(), bucketName, fileName)
+}
+
+// DownloadByNameContext is the same as DownloadByName, but uses the provided
+// context for the request.
+func (b2Service *Service) DownloadByNameContext(
+	ctx context.Context,
+	bucketName string,
+	fileName string,
+) ([]byte, error) {
+	return b2Service.PartialDownloadByNameContext(
+		ctx, bucketName, fileName, 0, -1)
+}
+
+// PartialDownloadByName is the same as DownloadByName, but only downloads the
+// file from the `begin` byte to the `end` byte (inclusive).
+func (b2Service *Service) PartialDownloadByName(
+	bucketName string,
+	fileName string,
+	begin int64,
+	end int64,
+) ([]byte, error) {
+	return b2Service.PartialDownloadByNameContext(
+		context.Background(), bucketName, fileName, begin, end)
+}
+
+// PartialDownloadByNameContext is the same as PartialDownloadByName, but uses
+// the provided context for the request.
+func (b2Service *Service) PartialDownloadByNameContext(
+	ctx context.Context,
+	bucketName string,
+	fileName string,
+	begin int64,
+	end int64,
+) ([]byte, error) {
+	reader, _, err := b2Service.PartialDownloadReaderByNameContext(
+		ctx, bucketName, fileName, begin, end)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(reader io.ReadCloser) {
+		_ = reader.Close()
+	}(reader)
+
+	return io.ReadAll(reader)
+}
+
+// DownloadReaderByName is the same as DownloadByName, but returns the
+// response body as an io.ReadCloser instead of reading the full file into
+// memory. The caller is responsible for closing the returned reader.
+func (b2Service *Service) DownloadReaderByName(
+	bucketName string,
+	fileName string,
+) (io.ReadCloser, DownloadInfo, error) {
+	return b2Service.DownloadReaderByNameContext(
+		context.Background(), bucketName, fileName)
+}
+
+// DownloadReaderByNameContext is the same as DownloadReaderByName, but uses
+// the provided context for the request.
+func (b2Service *Service) DownloadReaderByNameContext(
+	ctx context.Context,
+	bucketName string,
+	fileName string,
+) (io.ReadCloser, DownloadInfo, error) {
+	return b2Service.PartialDownloadReaderByNameContext(
+		ctx, bucketName, fileName, 0, -1)
+}
+
+// PartialDownloadReaderByName is the same as DownloadReaderByName, but only
+// downloads the file from the `begin` byte to the `end` byte (inclusive). An
+// `end` value of -1 downloads until the end of the file.
+func (b2Service *Service) PartialDownloadReaderByName(
+	bucketName string,
+	fileName string,
+	begin int64,
+	end int64,
+) (io.ReadCloser, DownloadInfo, error) {
+	return b2Service.PartialDownloadReaderByNameContext(
+		context.Background(), bucketName, fileName, begin, end)
+}
+
+// PartialDownloadReaderByNameContext is the same as
+// PartialDownloadReaderByName, but uses the provided context for the request.
+func (b2Service *Service) PartialDownloadReaderByNameContext(
+	ctx context.Context,
+	bucketName string,
+	fileName string,
+	begin int64,
+	end int64,
+) (io.ReadCloser, DownloadInfo, error) {
+	var opts DownloadOptions
+	if begin > 0 || end >= 0 {
+		opts.Range = &ByteRange{Begin: begin, End: end}
+	}
+
+	return b2Service.DownloadReaderByNameWithOptionsContext(
+		ctx, bucketName, fileName, opts)
+}
+
+// DownloadReaderByNameWithOptions is the same as DownloadReaderByName, but
+// allows downloading a range of the file, or a file encrypted with a customer
+// key.
+func (b2Service *Service) DownloadReaderByNameWithOptions(
+	bucketName string,
+	fileName string,
+	opts DownloadOptions,
+) (io.ReadCloser, DownloadInfo, error) {
+	return b2Service.DownloadReaderByNameWithOptionsContext(
+		context.Background(), bucketName, fileName, opts)
+}
+
+// DownloadReaderByNameWithOptionsContext is the same as
+// DownloadReaderByNameWithOptions, but uses the provided context for the
+// request.
+func (b2Service *Service) DownloadReaderByNameWithOptionsContext(
+	ctx context.Context,
+	bucketName string,
+	fileName string,
+	opts DownloadOptions,
+) (io.ReadCloser, DownloadInfo, error) {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFile(
+			APIDownloadByName, "readFiles", bucketName, fileName)
+		if err != nil {
+			return nil, DownloadInfo{}, err
+		}
+
+		begin, end := opts.Range.bounds()
+		return openLocalFileByName(ctx, b2Service.LocalPath, bucketName,
+			fileName, begin, end, opts.Encryption)
+	}
+
+	req, err := setupDownloadByName(
+		ctx, b2Service.downloadURL(), bucketName, fileName)
+	if err != nil {
+		b2Service.Logf("B2Error setting up download: %v", err)
+		return nil, DownloadInfo{}, err
+	}
+
+	req.Header = http.Header{
+		"Authorization": {b2Service.token()},
+	}
+
+	if opts.Range != nil {
+		req.Header.Set("Range", opts.Range.String())
+	}
+
+	opts.Encryption.setCustomerHeaders(req.Header)
+
+	return b2Service.downloadReader(req, APIDownloadByName)
+}
+
+// openLocalFileByName opens a local file using the name of the dummy bucket
+// it's stored in. Names of buckets that weren't created by the dummy account
+// are ignored, and the file is read directly from the account's path.
+func openLocalFileByName(
+	ctx context.Context,
+	path string,
+	bucketName string,
+	fileName string,
+	begin int64,
+	end int64,
+	sse *ServerSideEncryption,
+) (io.ReadCloser, DownloadInfo, error) {
+	id := localFileID(path, bucketName, fileName)
+	if hidden, err := isLocalFileHidden(path, id); err != nil {
+		return nil, DownloadInfo{}, err
+	} else if hidden {
+		return nil, DownloadInfo{}, localError(http.StatusNotFound, "not_found",
+			APIDownloadByName, "file %s is hidden", fileName)
+	}
+
+	reader, info, err := openLocalFile(ctx, id, path, begin, end, sse)
+	return reader, info, withEndpoint(err, APIDownloadByName)
+}
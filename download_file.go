@@ -1,12 +1,15 @@
 package b2
 
 import (
+	"context"
+	"crypto/sha1"
 	"fmt"
 	"github.com/benbusby/b2/utils"
 	"io"
 	"net/http"
-	"net/http/httputil"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -14,11 +17,16 @@ const APIDownloadById string = "b2_download_file_by_id"
 
 // setupDownload creates an http.Request with the URL for downloading a file,
 // as well as the file ID included in the query.
-func setupDownload(apiURL, apiVersion, fileID string) (*http.Request, error) {
+func setupDownload(
+	ctx context.Context,
+	apiURL string,
+	apiVersion string,
+	fileID string,
+) (*http.Request, error) {
 	reqURL := utils.FormatB2URL(
 		apiURL, apiVersion, APIDownloadById)
 
-	req, err := http.NewRequest("GET", reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -30,31 +38,89 @@ func setupDownload(apiURL, apiVersion, fileID string) (*http.Request, error) {
 	return req, nil
 }
 
+// DownloadInfo contains the file metadata returned alongside downloaded
+// file contents, parsed from the download response headers.
+type DownloadInfo struct {
+	ContentLength   int64
+	ContentType     string
+	ContentSha1     string
+	FileID          string
+	FileName        string
+	UploadTimestamp int64
+
+	// FileInfo contains any custom "X-Bz-Info-*" values stored with the
+	// file, keyed by the lowercase name following the "X-Bz-Info-" prefix.
+	FileInfo map[string]string
+}
+
+// newDownloadInfo parses file metadata from the headers of a download
+// response.
+func newDownloadInfo(res *http.Response) DownloadInfo {
+	info := DownloadInfo{
+		ContentLength: res.ContentLength,
+		ContentType:   res.Header.Get("Content-Type"),
+		ContentSha1:   res.Header.Get("X-Bz-Content-Sha1"),
+		FileID:        res.Header.Get("X-Bz-File-Id"),
+		FileInfo:      map[string]string{},
+	}
+
+	info.FileName, _ = url.QueryUnescape(res.Header.Get("X-Bz-File-Name"))
+	info.UploadTimestamp, _ = strconv.ParseInt(
+		res.Header.Get("X-Bz-Upload-Timestamp"), 10, 64)
+
+	for key, values := range res.Header {
+		if !strings.HasPrefix(key, "X-Bz-Info-") || len(values) == 0 {
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimPrefix(key, "X-Bz-Info-"))
+		value, err := url.QueryUnescape(values[0])
+		if err != nil {
+			value = values[0]
+		}
+
+		info.FileInfo[name] = value
+	}
+
+	return info
+}
+
+// downloadReader uses the http.Request returned by setupDownload to execute
+// the request and return the response body from B2 without reading it. The
+// caller is responsible for closing the returned io.ReadCloser.
+func (b2Service *Service) downloadReader(
+	req *http.Request,
+	endpoint string,
+) (io.ReadCloser, DownloadInfo, error) {
+	res, err := b2Service.do(req)
+	if err != nil {
+		return nil, DownloadInfo{}, err
+	} else if res.StatusCode >= 400 {
+		return nil, DownloadInfo{}, b2Service.apiError(res, endpoint)
+	}
+
+	return res.Body, newDownloadInfo(res), nil
+}
+
 // download uses the http.Request returned by setupDownload to execute the
 // request and return the []byte file content from B2.
-func download(req *http.Request) ([]byte, error) {
-	res, err := utils.Client.Do(req)
+func (b2Service *Service) download(
+	req *http.Request,
+	endpoint string,
+) ([]byte, error) {
+	body, _, err := b2Service.downloadReader(req, endpoint)
 	if err != nil {
 		return nil, err
-	} else if res.StatusCode >= 400 {
-		resp, _ := httputil.DumpResponse(res, true)
-		fmt.Println(fmt.Sprintf("%s", resp))
-		return nil, utils.B2Error
 	}
 
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			fmt.Println("B2Error reading response body")
+			b2Service.Logf("B2Error closing response body: %v", err)
 		}
-	}(res.Body)
-
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
+	}(body)
 
-	return body, nil
+	return io.ReadAll(body)
 }
 
 // PartialDownloadById downloads a file from B2 with a specified begin and end
@@ -64,16 +130,35 @@ func (b2Service *Service) PartialDownloadById(
 	id string,
 	begin int64,
 	end int64,
+) ([]byte, error) {
+	return b2Service.PartialDownloadByIdContext(
+		context.Background(), id, begin, end)
+}
+
+// PartialDownloadByIdContext is the same as PartialDownloadById, but uses the
+// provided context for the request.
+func (b2Service *Service) PartialDownloadByIdContext(
+	ctx context.Context,
+	id string,
+	begin int64,
+	end int64,
 ) ([]byte, error) {
 	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFileID(APIDownloadById, "readFiles", id)
+		if err != nil {
+			return nil, err
+		}
+
 		return partiallyDownloadLocalFile(
+			ctx,
 			id,
 			b2Service.LocalPath,
 			begin,
 			end)
 	}
 
-	req, err := setupDownload(b2Service.APIURL, b2Service.APIVersion, id)
+	req, err := setupDownload(
+		ctx, b2Service.apiURL(), b2Service.APIVersion, id)
 	if err != nil {
 		b2Service.Logf("B2Error setting up download: %v", err)
 		return nil, err
@@ -82,63 +167,293 @@ func (b2Service *Service) PartialDownloadById(
 	byteRange := fmt.Sprintf("bytes=%d-%d", begin, end)
 
 	req.Header = http.Header{
-		"Authorization": {b2Service.AuthorizationToken},
+		"Authorization": {b2Service.token()},
 		"Range":         {byteRange},
 	}
 
-	return download(req)
+	return b2Service.download(req, APIDownloadById)
 }
 
 // DownloadById downloads an entire file (regardless of size) from B2.
 func (b2Service *Service) DownloadById(id string) ([]byte, error) {
+	return b2Service.DownloadByIdContext(context.Background(), id)
+}
+
+// DownloadByIdContext is the same as DownloadById, but uses the provided
+// context for the request.
+func (b2Service *Service) DownloadByIdContext(
+	ctx context.Context,
+	id string,
+) ([]byte, error) {
 	if b2Service.Dummy {
-		return downloadLocalFile(id, b2Service.LocalPath)
+		err := b2Service.checkLocalKeyFileID(APIDownloadById, "readFiles", id)
+		if err != nil {
+			return nil, err
+		}
+
+		return downloadLocalFile(ctx, id, b2Service.LocalPath)
 	}
 
-	req, err := setupDownload(b2Service.APIURL, b2Service.APIVersion, id)
+	req, err := setupDownload(
+		ctx, b2Service.apiURL(), b2Service.APIVersion, id)
 	if err != nil {
 		b2Service.Logf("B2Error setting up download: %v", err)
 		return nil, err
 	}
 
 	req.Header = http.Header{
-		"Authorization": {b2Service.AuthorizationToken},
+		"Authorization": {b2Service.token()},
 	}
 
-	return download(req)
+	return b2Service.download(req, APIDownloadById)
+}
+
+// DownloadOptions contains optional settings for DownloadReaderByIdWithOptions
+// and DownloadReaderByNameWithOptions.
+type DownloadOptions struct {
+	// Range is the portion of the file to download. Defaults to the entire
+	// file. An End of -1 downloads until the end of the file.
+	Range *ByteRange
+
+	// Encryption contains the customer key for downloading a file that was
+	// encrypted with SSEModeC. It isn't needed for other files.
+	Encryption *ServerSideEncryption
+}
+
+// DownloadReaderById downloads an entire file from B2, returning the response
+// body as an io.ReadCloser that can be streamed elsewhere (i.e. to an HTTP
+// response) without reading the full file into memory. The caller is
+// responsible for closing the returned reader.
+func (b2Service *Service) DownloadReaderById(
+	id string,
+) (io.ReadCloser, DownloadInfo, error) {
+	return b2Service.DownloadReaderByIdContext(context.Background(), id)
+}
+
+// DownloadReaderByIdContext is the same as DownloadReaderById, but uses the
+// provided context for the request. Canceling the context also stops reading
+// from the returned io.ReadCloser.
+func (b2Service *Service) DownloadReaderByIdContext(
+	ctx context.Context,
+	id string,
+) (io.ReadCloser, DownloadInfo, error) {
+	return b2Service.DownloadReaderByIdWithOptionsContext(
+		ctx, id, DownloadOptions{})
+}
+
+// PartialDownloadReaderById is the same as DownloadReaderById, but only
+// downloads the file from the `begin` byte to the `end` byte (inclusive).
+func (b2Service *Service) PartialDownloadReaderById(
+	id string,
+	begin int64,
+	end int64,
+) (io.ReadCloser, DownloadInfo, error) {
+	return b2Service.PartialDownloadReaderByIdContext(
+		context.Background(), id, begin, end)
+}
+
+// PartialDownloadReaderByIdContext is the same as PartialDownloadReaderById,
+// but uses the provided context for the request.
+func (b2Service *Service) PartialDownloadReaderByIdContext(
+	ctx context.Context,
+	id string,
+	begin int64,
+	end int64,
+) (io.ReadCloser, DownloadInfo, error) {
+	return b2Service.DownloadReaderByIdWithOptionsContext(
+		ctx, id, DownloadOptions{Range: &ByteRange{Begin: begin, End: end}})
+}
+
+// DownloadReaderByIdWithOptions is the same as DownloadReaderById, but allows
+// downloading a range of the file, or a file encrypted with a customer key.
+func (b2Service *Service) DownloadReaderByIdWithOptions(
+	id string,
+	opts DownloadOptions,
+) (io.ReadCloser, DownloadInfo, error) {
+	return b2Service.DownloadReaderByIdWithOptionsContext(
+		context.Background(), id, opts)
+}
+
+// DownloadReaderByIdWithOptionsContext is the same as
+// DownloadReaderByIdWithOptions, but uses the provided context for the
+// request.
+func (b2Service *Service) DownloadReaderByIdWithOptionsContext(
+	ctx context.Context,
+	id string,
+	opts DownloadOptions,
+) (io.ReadCloser, DownloadInfo, error) {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFileID(APIDownloadById, "readFiles", id)
+		if err != nil {
+			return nil, DownloadInfo{}, err
+		}
+
+		begin, end := opts.Range.bounds()
+		return openLocalFile(
+			ctx, id, b2Service.LocalPath, begin, end, opts.Encryption)
+	}
+
+	req, err := setupDownload(
+		ctx, b2Service.apiURL(), b2Service.APIVersion, id)
+	if err != nil {
+		b2Service.Logf("B2Error setting up download: %v", err)
+		return nil, DownloadInfo{}, err
+	}
+
+	req.Header = http.Header{
+		"Authorization": {b2Service.token()},
+	}
+
+	if opts.Range != nil {
+		req.Header.Set("Range", opts.Range.String())
+	}
+
+	opts.Encryption.setCustomerHeaders(req.Header)
+
+	return b2Service.downloadReader(req, APIDownloadById)
 }
 
 // downloadLocalFile "downloads" a local file from the specified path + ID
 // rather than fetching from B2.
-func downloadLocalFile(id string, path string) ([]byte, error) {
-	fullPath := fmt.Sprintf("%s/%s", strings.TrimSuffix(path, "/"), id)
-	return os.ReadFile(fullPath)
+func downloadLocalFile(ctx context.Context, id string, path string) ([]byte, error) {
+	return partiallyDownloadLocalFile(ctx, id, path, 0, -1)
 }
 
 // partiallyDownloadLocalFile retrieves a portion of a local file rather than
 // fetching it from B2.
 func partiallyDownloadLocalFile(
+	ctx context.Context,
 	id string,
 	path string,
 	begin int64,
 	end int64,
 ) ([]byte, error) {
+	reader, _, err := openLocalFile(ctx, id, path, begin, end, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(reader io.ReadCloser) {
+		_ = reader.Close()
+	}(reader)
+
+	return io.ReadAll(reader)
+}
+
+// localFileReader is an io.ReadCloser for reading a section of a local file
+type localFileReader struct {
+	io.Reader
+	io.Closer
+}
+
+// openLocalFile opens a local file for reading from the `begin` byte to the
+// `end` byte (inclusive), rather than fetching it from B2. An `end` value of
+// -1 reads until the end of the file. Files encrypted with a customer key are
+// decrypted while reading, and can only be opened with the same key.
+func openLocalFile(
+	ctx context.Context,
+	id string,
+	path string,
+	begin int64,
+	end int64,
+	sse *ServerSideEncryption,
+) (io.ReadCloser, DownloadInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, DownloadInfo{}, err
+	}
+
 	fullPath := fmt.Sprintf("%s/%s", strings.TrimSuffix(path, "/"), id)
 	file, err := os.Open(fullPath)
 	if err != nil {
-		return nil, err
+		return nil, DownloadInfo{}, localFileError(err, APIDownloadById, id)
+	}
+
+	info, metadata, err := statLocalFile(file, path, id, APIDownloadById)
+	if err != nil {
+		_ = file.Close()
+		return nil, DownloadInfo{}, err
 	}
 
-	// B2 downloads encapsulate the end byte as well, whereas local reads
-	// stop at the end byte. Modifying the end by +1 accounts for this
-	// difference in order to get the download behavior to act the same.
-	end += 1
+	err = metadata.Encryption.checkKey(sse, APIDownloadById, id)
+	if err != nil {
+		_ = file.Close()
+		return nil, DownloadInfo{}, err
+	}
 
-	contents := make([]byte, end-begin)
-	_, err = file.ReadAt(contents, begin)
+	r, err := newLocalCipherReaderAt(file, metadata.Encryption, sse)
 	if err != nil {
-		return nil, err
+		_ = file.Close()
+		return nil, DownloadInfo{}, err
+	}
+
+	// Files stored before checksums were kept in the metadata are hashed
+	// instead
+	size := info.ContentLength
+	if len(info.ContentSha1) == 0 {
+		h := sha1.New()
+		if _, err = io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+			_ = file.Close()
+			return nil, DownloadInfo{}, err
+		}
+
+		info.ContentSha1 = fmt.Sprintf("%x", h.Sum(nil))
+	}
+
+	// Like B2, a range has to start within the file, although the end is
+	// allowed to go past the end of the file
+	if begin < 0 || (end >= 0 && end < begin) ||
+		(begin >= size && (begin > 0 || end >= 0)) {
+		_ = file.Close()
+		return nil, DownloadInfo{}, localError(
+			http.StatusRequestedRangeNotSatisfiable, "range_not_satisfiable",
+			APIDownloadById, "range %d-%d is not satisfiable for %s (%d bytes)",
+			begin, end, id, size)
+	}
+
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+
+	info.ContentLength = end - begin + 1
+	return localFileReader{
+		Reader: utils.NewContextReader(
+			ctx,
+			io.NewSectionReader(r, begin, info.ContentLength)),
+		Closer: file,
+	}, info, nil
+}
+
+// statLocalFile returns the metadata for an open local file, without reading
+// any of its contents. The returned ContentSha1 is empty if the checksum
+// wasn't stored when the file was uploaded.
+func statLocalFile(
+	file *os.File,
+	path string,
+	id string,
+	endpoint string,
+) (DownloadInfo, localFileMetadata, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return DownloadInfo{}, localFileMetadata{}, err
+	} else if stat.IsDir() {
+		// Directories are only virtual folders, which aren't files in B2
+		return DownloadInfo{}, localFileMetadata{},
+			localFileError(os.ErrNotExist, endpoint, id)
+	}
+
+	metadata, err := readLocalFileMetadata(path, id)
+	if err != nil {
+		return DownloadInfo{}, localFileMetadata{}, err
 	}
 
-	return contents, err
+	_, filename := splitLocalFileID(path, id)
+	return DownloadInfo{
+		ContentLength:   stat.Size(),
+		ContentType:     metadata.ContentType,
+		ContentSha1:     metadata.ContentSha1,
+		FileID:          id,
+		FileName:        filename,
+		UploadTimestamp: stat.ModTime().UnixMilli(),
+		FileInfo:        metadata.FileInfo,
+	}, metadata, nil
 }
@@ -0,0 +1,374 @@
+package b2
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+)
+
+// Server-side encryption modes supported by B2
+const (
+	// SSEModeB2 encrypts files at rest using keys managed by B2
+	SSEModeB2 = "SSE-B2"
+
+	// SSEModeC encrypts files at rest using a key provided by the customer,
+	// which must be included when downloading or copying the file.
+	SSEModeC = "SSE-C"
+)
+
+// SSEAlgorithmAES256 is the only encryption algorithm supported by B2
+const SSEAlgorithmAES256 = "AES256"
+
+// sseCustomerKeySize is the size of an SSE-C key in bytes
+const sseCustomerKeySize = 32
+
+// ServerSideEncryption contains the settings for encrypting a file in B2.
+// NewSSEB2 and NewSSEC can be used to create settings for each mode.
+type ServerSideEncryption struct {
+	// Mode is either SSEModeB2 or SSEModeC
+	Mode string
+
+	// Algorithm is the encryption algorithm. Defaults to SSEAlgorithmAES256.
+	Algorithm string
+
+	// CustomerKey is the 256-bit key used to encrypt the file with SSEModeC.
+	// B2 doesn't store the key, so the same key is required to download or
+	// copy the file later on.
+	CustomerKey []byte
+}
+
+// NewSSEB2 returns settings for encrypting a file with keys managed by B2.
+func NewSSEB2() *ServerSideEncryption {
+	return &ServerSideEncryption{
+		Mode:      SSEModeB2,
+		Algorithm: SSEAlgorithmAES256,
+	}
+}
+
+// NewSSEC returns settings for encrypting a file with a 256-bit key provided
+// by the customer.
+func NewSSEC(customerKey []byte) *ServerSideEncryption {
+	return &ServerSideEncryption{
+		Mode:        SSEModeC,
+		Algorithm:   SSEAlgorithmAES256,
+		CustomerKey: customerKey,
+	}
+}
+
+// isCustomerKey checks if the settings use a customer-provided key
+func (sse *ServerSideEncryption) isCustomerKey() bool {
+	return sse != nil && sse.Mode == SSEModeC
+}
+
+// algorithm returns the encryption algorithm, or the default if not set
+func (sse *ServerSideEncryption) algorithm() string {
+	if len(sse.Algorithm) == 0 {
+		return SSEAlgorithmAES256
+	}
+
+	return sse.Algorithm
+}
+
+// customerKeyMd5 returns the base64 encoded MD5 digest of the customer key,
+// which B2 uses to verify that the key wasn't corrupted in transit.
+func (sse *ServerSideEncryption) customerKeyMd5() string {
+	digest := md5.Sum(sse.CustomerKey)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// validate checks that the settings can be used for a request to `endpoint`.
+// Nil settings are always valid, and mean that no encryption is requested.
+func (sse *ServerSideEncryption) validate(endpoint string) error {
+	if sse == nil {
+		return nil
+	} else if sse.Mode != SSEModeB2 && sse.Mode != SSEModeC {
+		return localError(http.StatusBadRequest, "bad_request", endpoint,
+			"invalid server-side encryption mode: %q", sse.Mode)
+	} else if sse.algorithm() != SSEAlgorithmAES256 {
+		return localError(http.StatusBadRequest, "bad_request", endpoint,
+			"invalid server-side encryption algorithm: %q", sse.Algorithm)
+	} else if sse.isCustomerKey() && len(sse.CustomerKey) != sseCustomerKeySize {
+		return localError(http.StatusBadRequest, "bad_request", endpoint,
+			"SSE-C customer key must be %d bytes", sseCustomerKeySize)
+	}
+
+	return nil
+}
+
+// setUploadHeaders adds the headers for uploading a file with the settings.
+func (sse *ServerSideEncryption) setUploadHeaders(header http.Header) {
+	if sse == nil {
+		return
+	} else if sse.Mode == SSEModeB2 {
+		header.Set("X-Bz-Server-Side-Encryption", sse.algorithm())
+		return
+	}
+
+	sse.setCustomerHeaders(header)
+}
+
+// setCustomerHeaders adds the SSE-C headers required for uploading parts of
+// a large file and for downloading a file encrypted with a customer key. No
+// headers are needed for other modes.
+func (sse *ServerSideEncryption) setCustomerHeaders(header http.Header) {
+	if !sse.isCustomerKey() {
+		return
+	}
+
+	header.Set("X-Bz-Server-Side-Encryption-Customer-Algorithm",
+		sse.algorithm())
+	header.Set("X-Bz-Server-Side-Encryption-Customer-Key",
+		base64.StdEncoding.EncodeToString(sse.CustomerKey))
+	header.Set("X-Bz-Server-Side-Encryption-Customer-Key-Md5",
+		sse.customerKeyMd5())
+}
+
+// sseRequest is the JSON form of ServerSideEncryption used in request bodies
+type sseRequest struct {
+	Mode           string `json:"mode"`
+	Algorithm      string `json:"algorithm"`
+	CustomerKey    string `json:"customerKey,omitempty"`
+	CustomerKeyMd5 string `json:"customerKeyMd5,omitempty"`
+}
+
+// request returns the settings in the form used in request bodies, or nil if
+// no encryption is requested.
+func (sse *ServerSideEncryption) request() *sseRequest {
+	if sse == nil {
+		return nil
+	}
+
+	req := &sseRequest{Mode: sse.Mode, Algorithm: sse.algorithm()}
+	if sse.isCustomerKey() {
+		req.CustomerKey = base64.StdEncoding.EncodeToString(sse.CustomerKey)
+		req.CustomerKeyMd5 = sse.customerKeyMd5()
+	}
+
+	return req
+}
+
+// localEncryption is the encryption metadata stored with a dummy account's
+// file. The customer key isn't stored, only its MD5 digest, so that files
+// encrypted with SSE-C can only be read with the same key.
+type localEncryption struct {
+	Mode           string `json:"mode"`
+	Algorithm      string `json:"algorithm"`
+	CustomerKeyMd5 string `json:"customerKeyMd5,omitempty"`
+
+	// Segments are the sections of the file encrypted with AES-CTR, each
+	// with its own IV. Files have a single segment, while large files have
+	// one segment per part.
+	Segments []localCipherSegment `json:"segments,omitempty"`
+}
+
+// localCipherSegment is a section of a dummy account's file, starting at
+// Offset, that was encrypted with the IV.
+type localCipherSegment struct {
+	Offset int64  `json:"offset"`
+	IV     []byte `json:"iv"`
+}
+
+// newLocalEncryption returns the metadata stored for a file encrypted with
+// the settings, or nil if the file isn't encrypted.
+func newLocalEncryption(sse *ServerSideEncryption) *localEncryption {
+	if sse == nil {
+		return nil
+	}
+
+	encryption := &localEncryption{Mode: sse.Mode, Algorithm: sse.algorithm()}
+	if sse.isCustomerKey() {
+		encryption.CustomerKeyMd5 = sse.customerKeyMd5()
+	}
+
+	return encryption
+}
+
+// isCustomerKey checks if a dummy account's file was encrypted with SSE-C
+func (encryption *localEncryption) isCustomerKey() bool {
+	return encryption != nil && encryption.Mode == SSEModeC
+}
+
+// mode returns the encryption mode of a dummy account's file, or an empty
+// string if the file isn't encrypted.
+func (encryption *localEncryption) mode() string {
+	if encryption == nil {
+		return ""
+	}
+
+	return encryption.Mode
+}
+
+// algorithm returns the encryption algorithm of a dummy account's file, or an
+// empty string if the file isn't encrypted.
+func (encryption *localEncryption) algorithm() string {
+	if encryption == nil {
+		return ""
+	}
+
+	return encryption.Algorithm
+}
+
+// checkKey verifies that the settings provided for reading or writing a dummy
+// account's file match the ones the file was encrypted with, in the same way
+// that B2 rejects requests with a missing, incorrect, or unnecessary SSE-C
+// key.
+func (encryption *localEncryption) checkKey(
+	sse *ServerSideEncryption,
+	endpoint string,
+	id string,
+) error {
+	if err := sse.validate(endpoint); err != nil {
+		return err
+	} else if !encryption.isCustomerKey() && sse.isCustomerKey() {
+		return localError(http.StatusBadRequest, "bad_request", endpoint,
+			"file %s is not encrypted with SSE-C", id)
+	} else if !encryption.isCustomerKey() {
+		return nil
+	} else if !sse.isCustomerKey() {
+		return localError(http.StatusBadRequest, "bad_request", endpoint,
+			"file %s is encrypted with SSE-C, and requires the customer key",
+			id)
+	} else if sse.customerKeyMd5() != encryption.CustomerKeyMd5 {
+		return localError(http.StatusBadRequest, "bad_request", endpoint,
+			"the SSE-C customer key does not match the key for file %s", id)
+	}
+
+	return nil
+}
+
+// localCipherStream returns an AES-CTR stream for the byte at `offset` within
+// a segment encrypted with `iv`.
+func localCipherStream(
+	block cipher.Block,
+	iv []byte,
+	offset int64,
+) cipher.Stream {
+	// The counter for the block containing the offset is the IV plus the
+	// number of blocks before it, wrapping around like the CTR counter does
+	counter := new(big.Int).SetBytes(iv)
+	counter.Add(counter, big.NewInt(offset/aes.BlockSize))
+
+	counterBytes := make([]byte, aes.BlockSize)
+	raw := counter.Bytes()
+	if len(raw) > aes.BlockSize {
+		raw = raw[len(raw)-aes.BlockSize:]
+	}
+
+	copy(counterBytes[aes.BlockSize-len(raw):], raw)
+
+	stream := cipher.NewCTR(block, counterBytes)
+	skip := make([]byte, offset%aes.BlockSize)
+	stream.XORKeyStream(skip, skip)
+
+	return stream
+}
+
+// errLocalCipherSegments is returned when the segments stored for a dummy
+// account's file encrypted with SSE-C are missing or out of order.
+var errLocalCipherSegments = errors.New(
+	"local file metadata has invalid encryption segments")
+
+// localCipherReaderAt decrypts a dummy account's file encrypted with SSE-C,
+// and supports reading from any offset for ranged downloads.
+type localCipherReaderAt struct {
+	r        io.ReaderAt
+	block    cipher.Block
+	segments []localCipherSegment
+}
+
+func (c localCipherReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(c.segments) == 0 {
+		return 0, errLocalCipherSegments
+	}
+
+	total := 0
+	for len(p) > 0 {
+		// Find the last segment starting at or before the offset
+		i := len(c.segments) - 1
+		for i > 0 && c.segments[i].Offset > off {
+			i -= 1
+		}
+
+		segment := c.segments[i]
+		chunk := p
+		if i+1 < len(c.segments) &&
+			off+int64(len(chunk)) > c.segments[i+1].Offset {
+			chunk = p[:c.segments[i+1].Offset-off]
+		}
+
+		n, err := c.r.ReadAt(chunk, off)
+		localCipherStream(c.block, segment.IV, off-segment.Offset).
+			XORKeyStream(chunk[:n], chunk[:n])
+
+		total += n
+		if err != nil {
+			return total, err
+		}
+
+		off += int64(n)
+		p = p[n:]
+	}
+
+	return total, nil
+}
+
+// newLocalCipherReaderAt returns an io.ReaderAt that decrypts a dummy
+// account's file if it was encrypted with SSE-C, or reads it as-is if not.
+func newLocalCipherReaderAt(
+	r io.ReaderAt,
+	encryption *localEncryption,
+	sse *ServerSideEncryption,
+) (io.ReaderAt, error) {
+	if !encryption.isCustomerKey() {
+		return r, nil
+	}
+
+	block, err := aes.NewCipher(sse.CustomerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// The segments are read from the file's metadata, which could have been
+	// modified, so they're checked before being used for decrypting
+	segments := encryption.Segments
+	if len(segments) == 0 || segments[0].Offset != 0 {
+		return nil, errLocalCipherSegments
+	}
+
+	for i := 1; i < len(segments); i++ {
+		if segments[i].Offset <= segments[i-1].Offset {
+			return nil, errLocalCipherSegments
+		}
+	}
+
+	return localCipherReaderAt{
+		r:        r,
+		block:    block,
+		segments: encryption.Segments,
+	}, nil
+}
+
+// newLocalCipherWriter returns an io.Writer that encrypts everything written
+// to `w` with a customer key and a random IV, which is also returned.
+func newLocalCipherWriter(
+	w io.Writer,
+	sse *ServerSideEncryption,
+) (io.Writer, []byte, error) {
+	block, err := aes.NewCipher(sse.CustomerKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, nil, err
+	}
+
+	return cipher.StreamWriter{S: cipher.NewCTR(block, iv), W: w}, iv, nil
+}
@@ -0,0 +1,173 @@
+package b2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/benbusby/b2/utils"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is returned when B2 responds to a request with an error, and
+// contains the details parsed from B2's JSON error response. Dummy accounts
+// return the same errors for equivalent failures.
+//
+// All APIErrors match utils.B2Error when using errors.Is, as well as any
+// *APIError target with a matching Status and Code (zero values in the
+// target are ignored).
+type APIError struct {
+	Status     int           `json:"status"`
+	Code       string        `json:"code"`
+	Message    string        `json:"message"`
+	Endpoint   string        `json:"-"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (apiErr *APIError) Error() string {
+	msg := fmt.Sprintf("b2 error: %d %s", apiErr.Status, apiErr.Code)
+	if len(apiErr.Endpoint) > 0 {
+		msg = fmt.Sprintf("%s (%s)", msg, apiErr.Endpoint)
+	}
+
+	if len(apiErr.Message) > 0 {
+		msg = fmt.Sprintf("%s: %s", msg, apiErr.Message)
+	}
+
+	return msg
+}
+
+func (apiErr *APIError) Is(target error) bool {
+	if target == utils.B2Error {
+		return true
+	}
+
+	t, ok := target.(*APIError)
+	if !ok {
+		return false
+	}
+
+	return (t.Status == 0 || t.Status == apiErr.Status) &&
+		(len(t.Code) == 0 || t.Code == apiErr.Code)
+}
+
+// IsNotFound reports whether err is an APIError for a file, bucket, or key
+// that doesn't exist.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.Code {
+	case "not_found", "no_such_file", "file_not_present", "bad_bucket_id":
+		return true
+	}
+
+	return apiErr.Status == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether err is an APIError caused by missing,
+// invalid, or expired authorization.
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.Status == http.StatusUnauthorized ||
+		apiErr.Code == "unauthorized"
+}
+
+// IsCapExceeded reports whether err is an APIError caused by exceeding one
+// of the account's storage, download, or transaction caps. The
+// utils.StorageError returned by limited dummy accounts is also considered a
+// cap being exceeded.
+func IsCapExceeded(err error) bool {
+	if errors.Is(err, utils.StorageError) {
+		return true
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return strings.HasSuffix(apiErr.Code, "cap_exceeded")
+}
+
+// newAPIError parses the error returned by B2 in response to a request made
+// to `endpoint`. The response body can still be read afterwards.
+func newAPIError(res *http.Response, endpoint string) *APIError {
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	apiErr := &APIError{}
+	if err := json.Unmarshal(body, apiErr); err != nil {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	if apiErr.Status == 0 {
+		apiErr.Status = res.StatusCode
+	}
+
+	apiErr.Endpoint = endpoint
+
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err == nil && seconds >= 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	return apiErr
+}
+
+// apiError logs the response to a failed request (if logging is enabled)
+// and returns the APIError parsed from it.
+func (b2Service *Service) apiError(res *http.Response, endpoint string) error {
+	if b2Service != nil && b2Service.Logging {
+		resp, _ := httputil.DumpResponse(res, true)
+		b2Service.Logf("%s\n", resp)
+	}
+
+	return newAPIError(res, endpoint)
+}
+
+// localError returns an APIError for a failed request to `endpoint` made by
+// a dummy account.
+func localError(status int, code string, endpoint string, format string, v ...any) error {
+	return &APIError{
+		Status:   status,
+		Code:     code,
+		Message:  fmt.Sprintf(format, v...),
+		Endpoint: endpoint,
+	}
+}
+
+// withEndpoint sets the endpoint of an APIError returned by a dummy account's
+// helper that's shared between multiple endpoints.
+func withEndpoint(err error, endpoint string) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		apiErr.Endpoint = endpoint
+	}
+
+	return err
+}
+
+// localFileError converts errors from reading or removing a dummy account's
+// local files into the APIError B2 would return for a missing file.
+func localFileError(err error, endpoint string, id string) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return localError(http.StatusNotFound, "not_found", endpoint,
+			"file %s does not exist", id)
+	}
+
+	return err
+}
@@ -0,0 +1,213 @@
+package b2
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/benbusby/b2/utils"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultMaxEventAge is the default EventHandler.MaxEventAge
+const DefaultMaxEventAge = time.Hour
+
+// maxEventNotificationSize limits the size of the request bodies read by an
+// EventHandler.
+const maxEventNotificationSize = 1 << 20
+
+// ParseEventNotification verifies the signature of an event notification's
+// request body using the rule's signing secret, and decodes the body. The
+// signature is the value of the request's EventSignatureHeader.
+//
+// utils.SignatureError is returned if the signature doesn't match, and an
+// error is also returned if the body isn't a valid event notification. Use
+// EventHandler to also reject replayed events.
+func ParseEventNotification(
+	body []byte,
+	signature string,
+	secret string,
+) (EventNotification, error) {
+	if len(secret) == 0 {
+		return EventNotification{}, errors.New(
+			"a signing secret is required to verify event notifications")
+	} else if !hmac.Equal(
+		[]byte(signature), []byte(signEventNotification(secret, body))) {
+		return EventNotification{}, utils.SignatureError
+	}
+
+	var notification EventNotification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return EventNotification{}, fmt.Errorf(
+			"malformed event notification: %w", err)
+	} else if len(notification.Events) == 0 {
+		return EventNotification{}, errors.New(
+			"malformed event notification: no events")
+	}
+
+	for _, event := range notification.Events {
+		if len(event.EventID) == 0 || len(event.EventType) == 0 ||
+			event.EventTimestamp <= 0 {
+			return EventNotification{}, fmt.Errorf(
+				"malformed event notification: incomplete event %q",
+				event.EventID)
+		}
+	}
+
+	return notification, nil
+}
+
+// EventHandler is an http.Handler for receiving B2 event notifications. Each
+// request's signature is verified before its events are passed to the
+// callback, one at a time.
+//
+// Events are only passed to the callback once: events that have already been
+// handled are acknowledged without calling the callback again, and events
+// older than MaxEventAge are rejected, so captured requests can't be
+// replayed. If the callback returns an error, the request fails so that B2
+// sends the event again later.
+type EventHandler struct {
+	// MaxEventAge is how long after an event occurs that it's accepted.
+	// Defaults to DefaultMaxEventAge if zero.
+	MaxEventAge time.Duration
+
+	secret   string
+	callback func(ctx context.Context, event Event) error
+
+	// mu guards handled, which maps the IDs of recently handled events to
+	// their timestamps
+	mu      sync.Mutex
+	handled map[string]int64
+}
+
+// NewEventHandler creates an EventHandler that verifies event notifications
+// using the rule's signing secret (see EventNotificationTarget), and passes
+// each event to `callback`. The callback receives the request's context.
+//
+//	http.Handle("/b2-webhook", b2.NewEventHandler(secret,
+//		func(ctx context.Context, event b2.Event) error {
+//			log.Printf("%s: %s", event.EventType, event.FileName)
+//			return nil
+//		}))
+func NewEventHandler(
+	secret string,
+	callback func(ctx context.Context, event Event) error,
+) *EventHandler {
+	return &EventHandler{
+		secret:   secret,
+		callback: callback,
+		handled:  map[string]int64{},
+	}
+}
+
+func (handler *EventHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(
+		http.MaxBytesReader(w, r.Body, maxEventNotificationSize))
+	if err != nil {
+		http.Error(w, "unable to read request body", http.StatusBadRequest)
+		return
+	}
+
+	notification, err := ParseEventNotification(
+		body, r.Header.Get(EventSignatureHeader), handler.secret)
+	if errors.Is(err, utils.SignatureError) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	for _, event := range notification.Events {
+		if !handler.isRecent(event, now) {
+			http.Error(w, fmt.Sprintf("event %s is too old", event.EventID),
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	for _, event := range notification.Events {
+		if !handler.reserve(event, now) {
+			continue
+		}
+
+		if err = handler.callback(r.Context(), event); err != nil {
+			handler.release(event)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// maxEventAge returns the MaxEventAge, or the default if it isn't set
+func (handler *EventHandler) maxEventAge() time.Duration {
+	if handler.MaxEventAge <= 0 {
+		return DefaultMaxEventAge
+	}
+
+	return handler.MaxEventAge
+}
+
+// isRecent checks if an event occurred within MaxEventAge of `now`, allowing
+// for the same amount of clock skew in the other direction.
+func (handler *EventHandler) isRecent(event Event, now time.Time) bool {
+	age := now.Sub(time.UnixMilli(event.EventTimestamp))
+	if age < 0 {
+		age = -age
+	}
+
+	return age <= handler.maxEventAge()
+}
+
+// reserve marks an event as handled, returning false if it already has been.
+// Events old enough to be rejected by isRecent are forgotten along the way.
+func (handler *EventHandler) reserve(event Event, now time.Time) bool {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	if handler.handled == nil {
+		handler.handled = map[string]int64{}
+	}
+
+	oldest := now.Add(-handler.maxEventAge()).UnixMilli()
+	for id, timestamp := range handler.handled {
+		if timestamp < oldest {
+			delete(handler.handled, id)
+		}
+	}
+
+	if _, ok := handler.handled[eventKey(event)]; ok {
+		return false
+	}
+
+	handler.handled[eventKey(event)] = event.EventTimestamp
+	return true
+}
+
+// release forgets that an event was handled, so that it can be handled again
+// after the callback fails.
+func (handler *EventHandler) release(event Event) {
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	delete(handler.handled, eventKey(event))
+}
+
+// eventKey identifies an event that has been handled. The rule name is
+// included so that an event sent for multiple rules is handled for each.
+func eventKey(event Event) string {
+	return event.MatchedRuleName + "/" + event.EventID
+}
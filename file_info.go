@@ -0,0 +1,257 @@
+package b2
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const APIGetFileInfo = "b2_get_file_info"
+
+// getFileInfoRequest is the request body for b2_get_file_info
+type getFileInfoRequest struct {
+	FileID string `json:"fileId"`
+}
+
+// GetFileInfo fetches the metadata for a single file (or hide marker) using
+// its ID, without needing to list or download the file.
+func (b2Service *Service) GetFileInfo(fileID string) (File, error) {
+	return b2Service.GetFileInfoContext(context.Background(), fileID)
+}
+
+// GetFileInfoContext is the same as GetFileInfo, but uses the provided context
+// for the request.
+func (b2Service *Service) GetFileInfoContext(
+	ctx context.Context,
+	fileID string,
+) (File, error) {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFileID(APIGetFileInfo, "readFiles", fileID)
+		if err != nil {
+			return File{}, err
+		}
+
+		return getLocalFileInfo(ctx, b2Service.LocalPath, fileID)
+	}
+
+	var file File
+	err := b2Service.postJSON(
+		ctx, APIGetFileInfo, getFileInfoRequest{FileID: fileID}, &file)
+
+	return file, err
+}
+
+// HeadById fetches the metadata for a file using its ID by sending a HEAD
+// request to the download endpoint. The returned DownloadInfo is the same as
+// the one returned when downloading the file, but without the file contents.
+func (b2Service *Service) HeadById(id string) (DownloadInfo, error) {
+	return b2Service.HeadByIdContext(context.Background(), id)
+}
+
+// HeadByIdContext is the same as HeadById, but uses the provided context for
+// the request.
+func (b2Service *Service) HeadByIdContext(
+	ctx context.Context,
+	id string,
+) (DownloadInfo, error) {
+	return b2Service.headById(ctx, id, nil)
+}
+
+// headById sends a HEAD request for a file using its ID, including the
+// customer key needed for files encrypted with SSEModeC (if provided).
+func (b2Service *Service) headById(
+	ctx context.Context,
+	id string,
+	sse *ServerSideEncryption,
+) (DownloadInfo, error) {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFileID(APIDownloadById, "readFiles", id)
+		if err != nil {
+			return DownloadInfo{}, err
+		}
+
+		return headLocalFile(
+			openLocalFile(ctx, id, b2Service.LocalPath, 0, -1, sse))
+	}
+
+	req, err := setupDownload(
+		ctx, b2Service.apiURL(), b2Service.APIVersion, id)
+	if err != nil {
+		b2Service.Logf("B2Error setting up HEAD request: %v", err)
+		return DownloadInfo{}, err
+	}
+
+	req.Method = http.MethodHead
+	req.Header = http.Header{
+		"Authorization": {b2Service.token()},
+	}
+
+	sse.setCustomerHeaders(req.Header)
+
+	return b2Service.head(req, APIDownloadById)
+}
+
+// HeadByName is the same as HeadById, but uses the name of the bucket the
+// file is stored in and the name of the file, rather than the file ID.
+func (b2Service *Service) HeadByName(
+	bucketName string,
+	fileName string,
+) (DownloadInfo, error) {
+	return b2Service.HeadByNameContext(
+		context.Background(), bucketName, fileName)
+}
+
+// HeadByNameContext is the same as HeadByName, but uses the provided context
+// for the request.
+func (b2Service *Service) HeadByNameContext(
+	ctx context.Context,
+	bucketName string,
+	fileName string,
+) (DownloadInfo, error) {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFile(
+			APIDownloadByName, "readFiles", bucketName, fileName)
+		if err != nil {
+			return DownloadInfo{}, err
+		}
+
+		return headLocalFile(openLocalFileByName(
+			ctx, b2Service.LocalPath, bucketName, fileName, 0, -1, nil))
+	}
+
+	req, err := setupDownloadByName(
+		ctx, b2Service.downloadURL(), bucketName, fileName)
+	if err != nil {
+		b2Service.Logf("B2Error setting up HEAD request: %v", err)
+		return DownloadInfo{}, err
+	}
+
+	req.Method = http.MethodHead
+	req.Header = http.Header{
+		"Authorization": {b2Service.token()},
+	}
+
+	return b2Service.head(req, APIDownloadByName)
+}
+
+// head executes a HEAD request created from one of the download setup
+// functions, and parses the file metadata from the response headers.
+func (b2Service *Service) head(
+	req *http.Request,
+	endpoint string,
+) (DownloadInfo, error) {
+	res, err := b2Service.do(req)
+	if err != nil {
+		b2Service.Logf("%s HEAD error: %v\n", endpoint, err)
+		return DownloadInfo{}, err
+	}
+
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+
+	if res.StatusCode >= 400 {
+		return DownloadInfo{}, b2Service.apiError(res, endpoint)
+	}
+
+	return newDownloadInfo(res), nil
+}
+
+// headLocalFile closes a local file opened by one of the dummy account's
+// download functions, returning only the file's metadata.
+func headLocalFile(
+	reader io.ReadCloser,
+	info DownloadInfo,
+	err error,
+) (DownloadInfo, error) {
+	if err != nil {
+		return DownloadInfo{}, err
+	}
+
+	return info, reader.Close()
+}
+
+// getLocalFileInfo returns the metadata for a file stored by a dummy account,
+// based on the local file's size, checksum, and modification time, along with
+// the content type and file info stored with it. Hide markers created by the
+// dummy account are supported as well.
+func getLocalFileInfo(
+	ctx context.Context,
+	root string,
+	id string,
+) (File, error) {
+	if err := ctx.Err(); err != nil {
+		return File{}, err
+	}
+
+	if fileID, ok := strings.CutPrefix(id, localHideMarkerPrefix); ok {
+		hidden, err := readLocalHidden(root)
+		if err != nil {
+			return File{}, err
+		}
+
+		timestamp, ok := hidden[fileID]
+		if !ok {
+			return File{}, localError(http.StatusNotFound, "not_found",
+				APIGetFileInfo, "file %s does not exist", id)
+		}
+
+		bucketID, filename := splitLocalFileID(root, fileID)
+		return File{
+			Action:          ActionHide,
+			BucketID:        bucketID,
+			FileID:          id,
+			FileName:        filename,
+			UploadTimestamp: timestamp,
+		}, nil
+	}
+
+	// The file isn't decrypted, since B2 doesn't require the customer key
+	// for fetching the metadata of a file encrypted with SSE-C
+	fullPath := fmt.Sprintf("%s/%s", strings.TrimSuffix(root, "/"), id)
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return File{}, localFileError(err, APIGetFileInfo, id)
+	}
+
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(file)
+
+	info, metadata, err := statLocalFile(file, root, id, APIGetFileInfo)
+	if err != nil {
+		return File{}, err
+	}
+
+	if len(info.ContentSha1) == 0 && metadata.Encryption.isCustomerKey() {
+		info.ContentSha1 = "none"
+	} else if len(info.ContentSha1) == 0 {
+		h := sha1.New()
+		if _, err = io.Copy(h, file); err != nil {
+			return File{}, err
+		}
+
+		info.ContentSha1 = fmt.Sprintf("%x", h.Sum(nil))
+	}
+
+	bucketID, _ := splitLocalFileID(root, id)
+	b2File := File{
+		Action:          ActionUpload,
+		BucketID:        bucketID,
+		ContentLength:   info.ContentLength,
+		ContentSha1:     info.ContentSha1,
+		ContentType:     info.ContentType,
+		FileID:          info.FileID,
+		FileInfo:        info.FileInfo,
+		FileName:        info.FileName,
+		UploadTimestamp: info.UploadTimestamp,
+	}
+
+	b2File.ServerSideEncryption, b2File.FileRetention, b2File.LegalHold =
+		metadata.fileFields()
+	return b2File, nil
+}
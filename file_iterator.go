@@ -0,0 +1,136 @@
+package b2
+
+import "context"
+
+// FileIterator pages through the files in a bucket, requesting the next page
+// from B2 only once the previous one has been used up. Iterators are created
+// with IterateFileVersions or IterateFileNames, and are used like this:
+//
+//	iterator := b2.IterateFileNames(bucketID, b2.ListOptions{})
+//	for iterator.Next() {
+//		file := iterator.File()
+//		// do something with `file`
+//	}
+//
+//	if err := iterator.Err(); err != nil {
+//		// handle error
+//	}
+//
+// Breaking out of the loop early stops the iterator without requesting any
+// more pages.
+type FileIterator struct {
+	ctx      context.Context
+	list     func(context.Context, string, ListOptions) (FileList, error)
+	bucketID string
+	opts     ListOptions
+
+	page  []FileListItem
+	index int
+	file  FileListItem
+	done  bool
+	err   error
+}
+
+// IterateFileVersions returns a FileIterator over every version of each file
+// in the bucket, in the same order as ListFileVersions. The Count in `opts`
+// sets the number of files requested per page, and the remaining options are
+// applied to every page.
+func (b2Service *Service) IterateFileVersions(
+	bucketID string,
+	opts ListOptions,
+) *FileIterator {
+	return b2Service.IterateFileVersionsContext(
+		context.Background(), bucketID, opts)
+}
+
+// IterateFileVersionsContext is the same as IterateFileVersions, but uses the
+// provided context for each request.
+func (b2Service *Service) IterateFileVersionsContext(
+	ctx context.Context,
+	bucketID string,
+	opts ListOptions,
+) *FileIterator {
+	return &FileIterator{
+		ctx:      ctx,
+		list:     b2Service.ListFileVersionsContext,
+		bucketID: bucketID,
+		opts:     opts,
+	}
+}
+
+// IterateFileNames returns a FileIterator over the current version of each
+// file in the bucket, in the same order as ListFileNames. The Count in `opts`
+// sets the number of files requested per page, and the remaining options are
+// applied to every page.
+func (b2Service *Service) IterateFileNames(
+	bucketID string,
+	opts ListOptions,
+) *FileIterator {
+	return b2Service.IterateFileNamesContext(
+		context.Background(), bucketID, opts)
+}
+
+// IterateFileNamesContext is the same as IterateFileNames, but uses the
+// provided context for each request.
+func (b2Service *Service) IterateFileNamesContext(
+	ctx context.Context,
+	bucketID string,
+	opts ListOptions,
+) *FileIterator {
+	return &FileIterator{
+		ctx:      ctx,
+		list:     b2Service.ListFileNamesContext,
+		bucketID: bucketID,
+		opts:     opts,
+	}
+}
+
+// Next advances the iterator to the next file, requesting the next page of
+// files if needed. It returns false once there are no files left, or if a
+// request fails, in which case the error is returned by Err.
+func (iterator *FileIterator) Next() bool {
+	for iterator.index >= len(iterator.page) {
+		if iterator.done || iterator.err != nil {
+			return false
+		}
+
+		iterator.fetch()
+	}
+
+	iterator.file = iterator.page[iterator.index]
+	iterator.index += 1
+	return true
+}
+
+// File returns the file that the iterator is currently on, which is only
+// valid after Next has returned true.
+func (iterator *FileIterator) File() FileListItem {
+	return iterator.file
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (iterator *FileIterator) Err() error {
+	return iterator.err
+}
+
+// fetch requests the next page of files, and updates the iterator's starting
+// point for the page after that.
+func (iterator *FileIterator) fetch() {
+	fileList, err := iterator.list(
+		iterator.ctx, iterator.bucketID, iterator.opts)
+	if err != nil {
+		iterator.err = err
+		return
+	}
+
+	iterator.page = fileList.Files
+	iterator.index = 0
+
+	if len(fileList.NextFileName) == 0 {
+		iterator.done = true
+		return
+	}
+
+	iterator.opts.StartFileName = fileList.NextFileName
+	iterator.opts.StartFileID = fileList.NextFileID
+}
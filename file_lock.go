@@ -0,0 +1,347 @@
+package b2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const APIUpdateFileRetention = "b2_update_file_retention"
+const APIUpdateFileLegalHold = "b2_update_file_legal_hold"
+
+// Object Lock retention modes
+const (
+	// RetentionModeGovernance prevents a file from being deleted or having
+	// its retention shortened, unless BypassGovernance is set by a key with
+	// the "bypassGovernance" capability.
+	RetentionModeGovernance = "governance"
+
+	// RetentionModeCompliance prevents a file from being deleted or having
+	// its retention shortened by anyone until RetainUntilTimestamp.
+	RetentionModeCompliance = "compliance"
+)
+
+// Object Lock legal hold values
+const (
+	LegalHoldOn  = "on"
+	LegalHoldOff = "off"
+)
+
+// FileRetention is the Object Lock retention of a file, which prevents the
+// file from being deleted until RetainUntilTimestamp (in milliseconds). An
+// empty Mode means that the file has no retention. Retention can only be set
+// on files in buckets with Object Lock enabled.
+type FileRetention struct {
+	Mode                 string `json:"mode"`
+	RetainUntilTimestamp int64  `json:"retainUntilTimestamp"`
+}
+
+// MarshalJSON sends a retention without a Mode as null values, which is how
+// B2 expects the retention of a file to be removed.
+func (retention FileRetention) MarshalJSON() ([]byte, error) {
+	if len(retention.Mode) == 0 {
+		return []byte(`{"mode":null,"retainUntilTimestamp":null}`), nil
+	}
+
+	type fileRetention FileRetention
+	return json.Marshal(fileRetention(retention))
+}
+
+// isActive checks if the retention still protects the file at `now`
+func (retention *FileRetention) isActive(now time.Time) bool {
+	return retention != nil && len(retention.Mode) > 0 &&
+		retention.RetainUntilTimestamp > now.UnixMilli()
+}
+
+// setHeaders adds the headers for uploading a file with the retention.
+func (retention *FileRetention) setHeaders(header http.Header) {
+	if retention == nil || len(retention.Mode) == 0 {
+		return
+	}
+
+	header.Set("X-Bz-File-Retention-Mode", retention.Mode)
+	header.Set("X-Bz-File-Retention-Retain-Until-Timestamp",
+		fmt.Sprint(retention.RetainUntilTimestamp))
+}
+
+// validate checks that the retention has a valid mode and retain until time
+func (retention *FileRetention) validate(endpoint string, now time.Time) error {
+	if retention == nil {
+		return nil
+	}
+
+	switch retention.Mode {
+	case "":
+		if retention.RetainUntilTimestamp != 0 {
+			return localError(http.StatusBadRequest, "bad_request", endpoint,
+				"retainUntilTimestamp requires a retention mode")
+		}
+	case RetentionModeGovernance, RetentionModeCompliance:
+		if retention.RetainUntilTimestamp <= now.UnixMilli() {
+			return localError(http.StatusBadRequest, "bad_request", endpoint,
+				"retainUntilTimestamp must be in the future")
+		}
+	default:
+		return localError(http.StatusBadRequest, "bad_request", endpoint,
+			"invalid retention mode: %q", retention.Mode)
+	}
+
+	return nil
+}
+
+// validateLegalHold checks that a legal hold value is either empty (for
+// uploads without a legal hold), LegalHoldOn, or LegalHoldOff.
+func validateLegalHold(legalHold string, endpoint string) error {
+	switch legalHold {
+	case "", LegalHoldOn, LegalHoldOff:
+		return nil
+	}
+
+	return localError(http.StatusBadRequest, "bad_request", endpoint,
+		"invalid legal hold: %q", legalHold)
+}
+
+// updateFileRetentionRequest is the request body for b2_update_file_retention
+type updateFileRetentionRequest struct {
+	FileID           string        `json:"fileId"`
+	FileName         string        `json:"fileName"`
+	FileRetention    FileRetention `json:"fileRetention"`
+	BypassGovernance bool          `json:"bypassGovernance,omitempty"`
+}
+
+// updateFileLegalHoldRequest is the request body for b2_update_file_legal_hold
+type updateFileLegalHoldRequest struct {
+	FileID    string `json:"fileId"`
+	FileName  string `json:"fileName"`
+	LegalHold string `json:"legalHold"`
+}
+
+// UpdateFileRetention sets the Object Lock retention of a file. Retention can
+// always be extended, or changed from governance to compliance mode. Removing
+// or shortening governance retention requires `bypassGovernance`, while
+// compliance retention can't be removed or shortened at all.
+func (b2Service *Service) UpdateFileRetention(
+	fileID string,
+	fileName string,
+	retention FileRetention,
+	bypassGovernance bool,
+) error {
+	return b2Service.UpdateFileRetentionContext(
+		context.Background(), fileID, fileName, retention, bypassGovernance)
+}
+
+// UpdateFileRetentionContext is the same as UpdateFileRetention, but uses the
+// provided context for the request.
+func (b2Service *Service) UpdateFileRetentionContext(
+	ctx context.Context,
+	fileID string,
+	fileName string,
+	retention FileRetention,
+	bypassGovernance bool,
+) error {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFileID(
+			APIUpdateFileRetention, "writeFileRetentions", fileID)
+		if err == nil && bypassGovernance {
+			err = b2Service.checkLocalKeyFileID(
+				APIUpdateFileRetention, "bypassGovernance", fileID)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return updateLocalFileRetention(
+			ctx, b2Service.LocalPath, fileID, retention, bypassGovernance)
+	}
+
+	var res struct{}
+	return b2Service.postJSON(ctx, APIUpdateFileRetention,
+		updateFileRetentionRequest{
+			FileID:           fileID,
+			FileName:         fileName,
+			FileRetention:    retention,
+			BypassGovernance: bypassGovernance,
+		}, &res)
+}
+
+// UpdateFileLegalHold turns the legal hold of a file on or off, using either
+// LegalHoldOn or LegalHoldOff. A file with a legal hold can't be deleted,
+// regardless of its retention.
+func (b2Service *Service) UpdateFileLegalHold(
+	fileID string,
+	fileName string,
+	legalHold string,
+) error {
+	return b2Service.UpdateFileLegalHoldContext(
+		context.Background(), fileID, fileName, legalHold)
+}
+
+// UpdateFileLegalHoldContext is the same as UpdateFileLegalHold, but uses the
+// provided context for the request.
+func (b2Service *Service) UpdateFileLegalHoldContext(
+	ctx context.Context,
+	fileID string,
+	fileName string,
+	legalHold string,
+) error {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFileID(
+			APIUpdateFileLegalHold, "writeFileLegalHolds", fileID)
+		if err != nil {
+			return err
+		}
+
+		return updateLocalFileLegalHold(
+			ctx, b2Service.LocalPath, fileID, legalHold)
+	}
+
+	var res struct{}
+	return b2Service.postJSON(ctx, APIUpdateFileLegalHold,
+		updateFileLegalHoldRequest{
+			FileID:    fileID,
+			FileName:  fileName,
+			LegalHold: legalHold,
+		}, &res)
+}
+
+// setLock stores the retention and legal hold that a dummy account's file was
+// uploaded with.
+func (metadata *localFileMetadata) setLock(
+	retention *FileRetention,
+	legalHold string,
+) {
+	metadata.Retention = nil
+	if retention != nil && len(retention.Mode) > 0 {
+		metadata.Retention = retention
+	}
+
+	metadata.LegalHold = legalHold
+}
+
+// retention returns the retention of a dummy account's file, or an empty
+// FileRetention if the file has none.
+func (metadata localFileMetadata) retention() FileRetention {
+	if metadata.Retention == nil {
+		return FileRetention{}
+	}
+
+	return *metadata.Retention
+}
+
+// checkLocalFileLock returns an error if a dummy account's file is protected
+// by a legal hold or by retention that hasn't expired yet. Governance
+// retention is ignored when `bypassGovernance` is set. Files that don't exist
+// aren't locked.
+func checkLocalFileLock(
+	root string,
+	id string,
+	bypassGovernance bool,
+	endpoint string,
+) error {
+	path := fmt.Sprintf("%s/%s", strings.TrimSuffix(root, "/"), id)
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	metadata, err := readLocalFileMetadata(root, id)
+	if err != nil {
+		return err
+	}
+
+	retention := metadata.Retention
+	if metadata.LegalHold == LegalHoldOn {
+		return localError(http.StatusForbidden, "access_denied", endpoint,
+			"file %s has a legal hold", id)
+	} else if retention.isActive(time.Now()) &&
+		(retention.Mode == RetentionModeCompliance || !bypassGovernance) {
+		return localError(http.StatusForbidden, "access_denied", endpoint,
+			"file %s is retained in %s mode until %d",
+			id, retention.Mode, retention.RetainUntilTimestamp)
+	}
+
+	return nil
+}
+
+// updateLocalFileRetention sets the retention stored with a dummy account's
+// file, following the same rules as B2 for shortening or removing retention.
+func updateLocalFileRetention(
+	ctx context.Context,
+	root string,
+	id string,
+	retention FileRetention,
+	bypassGovernance bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := retention.validate(APIUpdateFileRetention, now); err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("%s/%s", strings.TrimSuffix(root, "/"), id)
+	if _, err := os.Stat(path); err != nil {
+		return localFileError(err, APIUpdateFileRetention, id)
+	}
+
+	metadata, err := readLocalFileMetadata(root, id)
+	if err != nil {
+		return err
+	}
+
+	// Retention that's still active can only be made stricter, unless it's
+	// governance retention and the governance mode is being bypassed
+	if current := metadata.Retention; current.isActive(now) {
+		stricter := len(retention.Mode) > 0 &&
+			retention.RetainUntilTimestamp >= current.RetainUntilTimestamp &&
+			(retention.Mode == RetentionModeCompliance ||
+				current.Mode == RetentionModeGovernance)
+		if !stricter &&
+			(current.Mode == RetentionModeCompliance || !bypassGovernance) {
+			return localError(http.StatusForbidden, "access_denied",
+				APIUpdateFileRetention,
+				"file %s is retained in %s mode until %d",
+				id, current.Mode, current.RetainUntilTimestamp)
+		}
+	}
+
+	metadata.setLock(&retention, metadata.LegalHold)
+	return writeLocalFileMetadata(root, id, metadata)
+}
+
+// updateLocalFileLegalHold sets the legal hold stored with a dummy account's
+// file.
+func updateLocalFileLegalHold(
+	ctx context.Context,
+	root string,
+	id string,
+	legalHold string,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	} else if len(legalHold) == 0 {
+		return localError(http.StatusBadRequest, "bad_request",
+			APIUpdateFileLegalHold, "legalHold is required")
+	} else if err = validateLegalHold(legalHold, APIUpdateFileLegalHold); err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("%s/%s", strings.TrimSuffix(root, "/"), id)
+	if _, err := os.Stat(path); err != nil {
+		return localFileError(err, APIUpdateFileLegalHold, id)
+	}
+
+	metadata, err := readLocalFileMetadata(root, id)
+	if err != nil {
+		return err
+	}
+
+	metadata.LegalHold = legalHold
+	return writeLocalFileMetadata(root, id, metadata)
+}
@@ -0,0 +1,155 @@
+package b2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const APIHideFile = "b2_hide_file"
+
+// localHideMarkerPrefix is prepended to a dummy account's file ID to create
+// the ID of the file's hide marker. Files can't be stored in the metadata
+// directory, so a hide marker's ID can't be mistaken for a file's ID.
+const localHideMarkerPrefix = localMetadataDir + "/hidden/"
+
+// hideFileRequest is the request body for b2_hide_file
+type hideFileRequest struct {
+	BucketID string `json:"bucketId"`
+	FileName string `json:"fileName"`
+}
+
+// HideFile hides a file so that it's no longer returned by ListFileNames or
+// downloadable by name. The file's contents aren't removed; instead, B2 adds a
+// new version of the file with an Action of ActionHide. Deleting the returned
+// hide marker with DeleteFile makes the file visible again.
+func (b2Service *Service) HideFile(bucketID string, name string) (File, error) {
+	return b2Service.HideFileContext(context.Background(), bucketID, name)
+}
+
+// HideFileContext is the same as HideFile, but uses the provided context for
+// the request.
+func (b2Service *Service) HideFileContext(
+	ctx context.Context,
+	bucketID string,
+	name string,
+) (File, error) {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFile(APIHideFile, "writeFiles", bucketID, name)
+		if err != nil {
+			return File{}, err
+		}
+
+		file, err := hideLocalFile(ctx, b2Service.LocalPath, bucketID, name)
+		if err == nil {
+			b2Service.notifyLocalEvent(ctx,
+				b2Service.LocalPath, file.event(EventHideMarkerCreatedHide))
+		}
+
+		return file, err
+	}
+
+	var file File
+	err := b2Service.postJSON(ctx, APIHideFile, hideFileRequest{
+		BucketID: bucketID,
+		FileName: name,
+	}, &file)
+
+	return file, err
+}
+
+// localHiddenPath returns the path to the registry of files hidden by a dummy
+// account.
+func localHiddenPath(root string) string {
+	return localMetadataPath(root, "hidden.json")
+}
+
+// readLocalHidden reads the registry of files hidden by a dummy account,
+// which maps each hidden file's ID to the time (in milliseconds) it was
+// hidden.
+func readLocalHidden(root string) (map[string]int64, error) {
+	hidden := map[string]int64{}
+	if err := readLocalRegistry(localHiddenPath(root), &hidden); err != nil {
+		return nil, err
+	}
+
+	return hidden, nil
+}
+
+// isLocalFileHidden checks if a dummy account's file has been hidden
+func isLocalFileHidden(root string, id string) (bool, error) {
+	hidden, err := readLocalHidden(root)
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := hidden[id]
+	return ok, nil
+}
+
+// unhideLocalFile removes a file from the dummy account's registry of hidden
+// files, which happens when the hide marker is deleted or a new version of
+// the file is uploaded. Returns true if the file was hidden.
+func unhideLocalFile(root string, id string) (bool, error) {
+	var unhidden bool
+	hidden := map[string]int64{}
+	err := updateLocalRegistry(localHiddenPath(root), &hidden,
+		func() (bool, error) {
+			if _, unhidden = hidden[id]; unhidden {
+				delete(hidden, id)
+			}
+
+			return unhidden, nil
+		})
+
+	return unhidden, err
+}
+
+// hideLocalFileAt adds a file to the dummy account's registry of hidden files,
+// using the provided timestamp (in milliseconds) as the time it was hidden.
+func hideLocalFileAt(root string, id string, timestamp int64) error {
+	hidden := map[string]int64{}
+	return updateLocalRegistry(localHiddenPath(root), &hidden,
+		func() (bool, error) {
+			hidden[id] = timestamp
+			return true, nil
+		})
+}
+
+// hideLocalFile adds a file to the dummy account's registry of hidden files.
+func hideLocalFile(
+	ctx context.Context,
+	root string,
+	bucketID string,
+	name string,
+) (File, error) {
+	if err := ctx.Err(); err != nil {
+		return File{}, err
+	}
+
+	id := localFileID(root, bucketID, name)
+	path := fmt.Sprintf("%s/%s", strings.TrimSuffix(root, "/"), id)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return File{}, localError(http.StatusBadRequest, "no_such_file",
+			APIHideFile, "file %s does not exist", name)
+	} else if err != nil {
+		return File{}, err
+	}
+
+	timestamp := time.Now().UnixMilli()
+	if err := hideLocalFileAt(root, id, timestamp); err != nil {
+		return File{}, err
+	}
+
+	return File{
+		Action:          ActionHide,
+		BucketID:        bucketID,
+		FileID:          localHideMarkerPrefix + id,
+		FileName:        name,
+		UploadTimestamp: timestamp,
+	}, nil
+}
@@ -0,0 +1,474 @@
+package b2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const APICreateKey = "b2_create_key"
+const APIListKeys = "b2_list_keys"
+const APIDeleteKey = "b2_delete_key"
+
+// Key represents an application key returned by CreateKey, ListKeys, and
+// DeleteKey. The secret ApplicationKey value is only ever returned by
+// CreateKey, and cannot be retrieved again afterwards.
+type Key struct {
+	AccountID           string   `json:"accountId"`
+	ApplicationKey      string   `json:"applicationKey,omitempty"`
+	ApplicationKeyID    string   `json:"applicationKeyId"`
+	BucketID            string   `json:"bucketId"`
+	Capabilities        []string `json:"capabilities"`
+	ExpirationTimestamp int64    `json:"expirationTimestamp"`
+	KeyName             string   `json:"keyName"`
+	NamePrefix          string   `json:"namePrefix"`
+	Options             []string `json:"options"`
+}
+
+// KeyList represents the data returned by ListKeys
+type KeyList struct {
+	Keys                 []Key  `json:"keys"`
+	NextApplicationKeyID string `json:"nextApplicationKeyId"`
+}
+
+// KeyOptions contains the optional restrictions for a new application key.
+type KeyOptions struct {
+	// ValidDuration sets how long the key remains valid after being
+	// created. Keys created without a duration never expire.
+	ValidDuration time.Duration
+
+	// BucketID restricts the key to a single bucket.
+	BucketID string
+
+	// NamePrefix restricts the key to files with names starting with the
+	// prefix. Requires BucketID to also be set.
+	NamePrefix string
+}
+
+// keyRequest is the request body shared by each key endpoint
+type keyRequest struct {
+	AccountID              string   `json:"accountId,omitempty"`
+	ApplicationKeyID       string   `json:"applicationKeyId,omitempty"`
+	BucketID               string   `json:"bucketId,omitempty"`
+	Capabilities           []string `json:"capabilities,omitempty"`
+	KeyName                string   `json:"keyName,omitempty"`
+	MaxKeyCount            int      `json:"maxKeyCount,omitempty"`
+	NamePrefix             string   `json:"namePrefix,omitempty"`
+	StartApplicationKeyID  string   `json:"startApplicationKeyId,omitempty"`
+	ValidDurationInSeconds int64    `json:"validDurationInSeconds,omitempty"`
+}
+
+// CreateKey creates a new application key with the provided name and list of
+// capabilities (i.e. "listFiles", "readFiles", "writeFiles"). The returned Key
+// is the only time that the key's secret ApplicationKey value is available.
+func (b2Service *Service) CreateKey(
+	name string,
+	capabilities []string,
+	opts KeyOptions,
+) (Key, error) {
+	return b2Service.CreateKeyContext(
+		context.Background(), name, capabilities, opts)
+}
+
+// CreateKeyContext is the same as CreateKey, but uses the provided context
+// for the request.
+func (b2Service *Service) CreateKeyContext(
+	ctx context.Context,
+	name string,
+	capabilities []string,
+	opts KeyOptions,
+) (Key, error) {
+	if len(opts.NamePrefix) > 0 && len(opts.BucketID) == 0 {
+		return Key{}, localError(http.StatusBadRequest, "bad_request",
+			APICreateKey, "namePrefix requires a bucketId")
+	}
+
+	if b2Service.Dummy {
+		if _, err := b2Service.checkLocalKey(APICreateKey, "writeKeys"); err != nil {
+			return Key{}, err
+		}
+
+		return createLocalKey(
+			ctx, b2Service.LocalPath, name, capabilities, opts)
+	}
+
+	var key Key
+	err := b2Service.postJSON(ctx, APICreateKey, keyRequest{
+		AccountID:              b2Service.AccountID,
+		BucketID:               opts.BucketID,
+		Capabilities:           capabilities,
+		KeyName:                name,
+		NamePrefix:             opts.NamePrefix,
+		ValidDurationInSeconds: int64(opts.ValidDuration / time.Second),
+	}, &key)
+
+	return key, err
+}
+
+// ListAllKeys is a helper function for fetching every application key in the
+// account, using NextApplicationKeyID to list each page of 100 keys until none
+// are left.
+func (b2Service *Service) ListAllKeys() (KeyList, error) {
+	return b2Service.ListAllKeysContext(context.Background())
+}
+
+// ListAllKeysContext is the same as ListAllKeys, but uses the provided context
+// for each request.
+func (b2Service *Service) ListAllKeysContext(ctx context.Context) (KeyList, error) {
+	allKeys := KeyList{Keys: []Key{}}
+	startKeyID := ""
+	for {
+		keyList, err := b2Service.ListKeysContext(ctx, 100, startKeyID)
+		if err != nil {
+			return KeyList{}, err
+		}
+
+		allKeys.Keys = append(allKeys.Keys, keyList.Keys...)
+		if len(keyList.NextApplicationKeyID) == 0 {
+			return allKeys, nil
+		}
+
+		startKeyID = keyList.NextApplicationKeyID
+	}
+}
+
+// ListKeys lists up to `count` application keys in the account, starting with
+// the key ID `startKeyID` (if provided). If count is set to an invalid or
+// negative value, the default number of keys returned is 100.
+func (b2Service *Service) ListKeys(count int, startKeyID string) (KeyList, error) {
+	return b2Service.ListKeysContext(context.Background(), count, startKeyID)
+}
+
+// ListKeysContext is the same as ListKeys, but uses the provided context for
+// the request.
+func (b2Service *Service) ListKeysContext(
+	ctx context.Context,
+	count int,
+	startKeyID string,
+) (KeyList, error) {
+	if count <= 0 {
+		count = 100
+	}
+
+	if b2Service.Dummy {
+		if _, err := b2Service.checkLocalKey(APIListKeys, "listKeys"); err != nil {
+			return KeyList{}, err
+		}
+
+		return listLocalKeys(ctx, b2Service.LocalPath, count, startKeyID)
+	}
+
+	var keyList KeyList
+	err := b2Service.postJSON(ctx, APIListKeys, keyRequest{
+		AccountID:             b2Service.AccountID,
+		MaxKeyCount:           count,
+		StartApplicationKeyID: startKeyID,
+	}, &keyList)
+
+	return keyList, err
+}
+
+// DeleteKey deletes an application key, returning the key as it was before
+// being deleted.
+func (b2Service *Service) DeleteKey(keyID string) (Key, error) {
+	return b2Service.DeleteKeyContext(context.Background(), keyID)
+}
+
+// DeleteKeyContext is the same as DeleteKey, but uses the provided context
+// for the request.
+func (b2Service *Service) DeleteKeyContext(
+	ctx context.Context,
+	keyID string,
+) (Key, error) {
+	if b2Service.Dummy {
+		if _, err := b2Service.checkLocalKey(APIDeleteKey, "deleteKeys"); err != nil {
+			return Key{}, err
+		}
+
+		return deleteLocalKey(ctx, b2Service.LocalPath, keyID)
+	}
+
+	var key Key
+	err := b2Service.postJSON(ctx, APIDeleteKey, keyRequest{
+		ApplicationKeyID: keyID,
+	}, &key)
+
+	return key, err
+}
+
+// localKeysPath returns the path to the registry of keys created by a dummy
+// account.
+func localKeysPath(root string) string {
+	return localMetadataPath(root, "keys.json")
+}
+
+// localKey is a key stored in a dummy account's key registry. Like B2, the
+// secret itself isn't stored, only a hash of it for authorizing with the key.
+type localKey struct {
+	Key
+	ApplicationKeyHash string `json:"applicationKeyHash"`
+}
+
+// hashLocalKey returns the hash stored for a dummy account key's secret.
+func hashLocalKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// readLocalKeys reads the registry of keys created by a dummy account.
+func readLocalKeys(root string) (map[string]localKey, error) {
+	keys := map[string]localKey{}
+	if err := readLocalRegistry(localKeysPath(root), &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// createLocalKey adds a new key with a random ID and secret to the dummy
+// account's key registry.
+func createLocalKey(
+	ctx context.Context,
+	root string,
+	name string,
+	capabilities []string,
+	opts KeyOptions,
+) (Key, error) {
+	if err := ctx.Err(); err != nil {
+		return Key{}, err
+	} else if len(opts.BucketID) > 0 && !localBucketExists(root, opts.BucketID) {
+		return Key{}, localError(http.StatusBadRequest, "bad_bucket_id",
+			APICreateKey, "bucket %s does not exist", opts.BucketID)
+	}
+
+	id := make([]byte, 12)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, err
+	} else if _, err = rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+
+	key := Key{
+		ApplicationKey:   base64.RawURLEncoding.EncodeToString(secret),
+		ApplicationKeyID: hex.EncodeToString(id),
+		BucketID:         opts.BucketID,
+		Capabilities:     capabilities,
+		KeyName:          name,
+		NamePrefix:       opts.NamePrefix,
+		Options:          []string{"s3"},
+	}
+
+	if opts.ValidDuration > 0 {
+		key.ExpirationTimestamp = time.Now().Add(opts.ValidDuration).UnixMilli()
+	}
+
+	// Like B2, the secret is returned once and never stored
+	stored := localKey{
+		Key:                key,
+		ApplicationKeyHash: hashLocalKey(key.ApplicationKey),
+	}
+	stored.ApplicationKey = ""
+
+	keys := map[string]localKey{}
+	err := updateLocalRegistry(localKeysPath(root), &keys,
+		func() (bool, error) {
+			keys[key.ApplicationKeyID] = stored
+			return true, nil
+		})
+
+	return key, err
+}
+
+// listLocalKeys lists keys from the dummy account's key registry, sorted by
+// key ID in the same way that B2 paginates keys.
+func listLocalKeys(
+	ctx context.Context,
+	root string,
+	count int,
+	startKeyID string,
+) (KeyList, error) {
+	if err := ctx.Err(); err != nil {
+		return KeyList{}, err
+	}
+
+	keys, err := readLocalKeys(root)
+	if err != nil {
+		return KeyList{}, err
+	}
+
+	var ids []string
+	for id := range keys {
+		if id >= startKeyID {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+
+	keyList := KeyList{Keys: []Key{}}
+	for i, id := range ids {
+		if i == count {
+			keyList.NextApplicationKeyID = id
+			break
+		}
+
+		keyList.Keys = append(keyList.Keys, keys[id].Key)
+	}
+
+	return keyList, nil
+}
+
+// deleteLocalKey removes a key from the dummy account's key registry.
+func deleteLocalKey(
+	ctx context.Context,
+	root string,
+	keyID string,
+) (Key, error) {
+	if err := ctx.Err(); err != nil {
+		return Key{}, err
+	}
+
+	var key localKey
+	keys := map[string]localKey{}
+	err := updateLocalRegistry(localKeysPath(root), &keys,
+		func() (bool, error) {
+			var ok bool
+			if key, ok = keys[keyID]; !ok {
+				return false, localError(http.StatusNotFound, "not_found",
+					APIDeleteKey, "key %s does not exist", keyID)
+			}
+
+			delete(keys, keyID)
+			return true, nil
+		})
+
+	return key.Key, err
+}
+
+// authorizeLocalKey checks a key ID and secret against the dummy account's
+// key registry, in the same way that B2 checks them when authorizing.
+func authorizeLocalKey(root string, keyID string, secret string) error {
+	keys, err := readLocalKeys(root)
+	if err != nil {
+		return err
+	}
+
+	key, ok := keys[keyID]
+	if !ok || subtle.ConstantTimeCompare(
+		[]byte(key.ApplicationKeyHash), []byte(hashLocalKey(secret))) != 1 {
+		return localError(http.StatusUnauthorized, "unauthorized",
+			APIAuthorizeAccount, "invalid application key")
+	} else if key.expired() {
+		return localError(http.StatusUnauthorized, "unauthorized",
+			APIAuthorizeAccount, "application key %s has expired", keyID)
+	}
+
+	return nil
+}
+
+// expired checks if a key's expiration timestamp has passed.
+func (key Key) expired() bool {
+	return key.ExpirationTimestamp > 0 &&
+		time.Now().UnixMilli() >= key.ExpirationTimestamp
+}
+
+// checkLocalKey checks that the key a dummy account was authorized with still
+// exists, hasn't expired, and has the capability needed for an endpoint. The
+// key is returned for checking its bucket and name prefix, or nil if the
+// account wasn't authorized with a key from the registry.
+func (b2Service *Service) checkLocalKey(
+	endpoint string,
+	capability string,
+) (*Key, error) {
+	if b2Service == nil || len(b2Service.localKeyID) == 0 {
+		return nil, nil
+	}
+
+	keys, err := readLocalKeys(b2Service.LocalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := keys[b2Service.localKeyID]
+	if !ok {
+		return nil, localError(http.StatusUnauthorized, "bad_auth_token",
+			endpoint, "application key %s has been deleted",
+			b2Service.localKeyID)
+	} else if key.expired() {
+		return nil, localError(http.StatusUnauthorized, "unauthorized",
+			endpoint, "application key %s has expired", b2Service.localKeyID)
+	}
+
+	for _, allowed := range key.Capabilities {
+		if allowed == capability {
+			return &key.Key, nil
+		}
+	}
+
+	return nil, localError(http.StatusUnauthorized, "unauthorized", endpoint,
+		"application key is missing the %s capability", capability)
+}
+
+// checkLocalKeyBucket is the same as checkLocalKey, but also checks that the
+// key isn't restricted to a bucket other than `bucketID`.
+func (b2Service *Service) checkLocalKeyBucket(
+	endpoint string,
+	capability string,
+	bucketID string,
+) (*Key, error) {
+	key, err := b2Service.checkLocalKey(endpoint, capability)
+	if err != nil || key == nil {
+		return key, err
+	} else if len(key.BucketID) > 0 && key.BucketID != bucketID {
+		return nil, localError(http.StatusUnauthorized, "unauthorized",
+			endpoint, "application key is restricted to bucket %s",
+			key.BucketID)
+	}
+
+	return key, nil
+}
+
+// checkLocalKeyFile is the same as checkLocalKeyBucket, but also checks that
+// `name` (a file name, or the prefix of the files being listed) starts with
+// the key's name prefix.
+func (b2Service *Service) checkLocalKeyFile(
+	endpoint string,
+	capability string,
+	bucketID string,
+	name string,
+) error {
+	key, err := b2Service.checkLocalKeyBucket(endpoint, capability, bucketID)
+	if err != nil || key == nil {
+		return err
+	} else if !strings.HasPrefix(name, key.NamePrefix) {
+		return localError(http.StatusUnauthorized, "unauthorized", endpoint,
+			"application key is restricted to names starting with %q",
+			key.NamePrefix)
+	}
+
+	return nil
+}
+
+// checkLocalKeyFileID is the same as checkLocalKeyFile, but for a file
+// stored by the dummy account with the ID `fileID`.
+func (b2Service *Service) checkLocalKeyFileID(
+	endpoint string,
+	capability string,
+	fileID string,
+) error {
+	if b2Service == nil || len(b2Service.localKeyID) == 0 {
+		return nil
+	}
+
+	bucketID, name := splitLocalFileID(
+		b2Service.LocalPath, strings.TrimPrefix(fileID, localHideMarkerPrefix))
+	return b2Service.checkLocalKeyFile(endpoint, capability, bucketID, name)
+}
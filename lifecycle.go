@@ -0,0 +1,213 @@
+package b2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LifecycleRule automatically hides and/or deletes the files in a bucket
+// whose names start with FileNamePrefix (an empty prefix matches every file).
+// A zero value for either number of days disables that part of the rule, but
+// at least one of them must be set.
+type LifecycleRule struct {
+	// DaysFromUploadingToHiding hides a file the given number of days after
+	// it was uploaded.
+	DaysFromUploadingToHiding int `json:"daysFromUploadingToHiding"`
+
+	// DaysFromHidingToDeleting deletes a file the given number of days after
+	// it was hidden, either by HideFile, DaysFromUploadingToHiding, or a
+	// newer version of the file being uploaded.
+	DaysFromHidingToDeleting int `json:"daysFromHidingToDeleting"`
+
+	FileNamePrefix string `json:"fileNamePrefix"`
+}
+
+// MarshalJSON sends the disabled parts of a rule as null values, which is how
+// B2 expects them to be provided.
+func (rule LifecycleRule) MarshalJSON() ([]byte, error) {
+	days := func(n int) *int {
+		if n == 0 {
+			return nil
+		}
+
+		return &n
+	}
+
+	return json.Marshal(struct {
+		DaysFromUploadingToHiding *int   `json:"daysFromUploadingToHiding"`
+		DaysFromHidingToDeleting  *int   `json:"daysFromHidingToDeleting"`
+		FileNamePrefix            string `json:"fileNamePrefix"`
+	}{
+		DaysFromUploadingToHiding: days(rule.DaysFromUploadingToHiding),
+		DaysFromHidingToDeleting:  days(rule.DaysFromHidingToDeleting),
+		FileNamePrefix:            rule.FileNamePrefix,
+	})
+}
+
+// validateLifecycleRules checks that each lifecycle rule is valid
+func validateLifecycleRules(rules []LifecycleRule, endpoint string) error {
+	prefixes := map[string]bool{}
+	for _, rule := range rules {
+		if rule.DaysFromUploadingToHiding < 0 || rule.DaysFromHidingToDeleting < 0 {
+			return localError(http.StatusBadRequest, "bad_request", endpoint,
+				"lifecycle rule days must be positive")
+		} else if rule.DaysFromUploadingToHiding == 0 &&
+			rule.DaysFromHidingToDeleting == 0 {
+			return localError(http.StatusBadRequest, "bad_request", endpoint,
+				"lifecycle rule for prefix %q has no days set",
+				rule.FileNamePrefix)
+		} else if prefixes[rule.FileNamePrefix] {
+			return localError(http.StatusBadRequest, "bad_request", endpoint,
+				"duplicate lifecycle rule for prefix %q", rule.FileNamePrefix)
+		}
+
+		prefixes[rule.FileNamePrefix] = true
+	}
+
+	return nil
+}
+
+// matchLifecycleRule returns the rule with the longest prefix matching the
+// file name, if any.
+func matchLifecycleRule(
+	rules []LifecycleRule,
+	name string,
+) (LifecycleRule, bool) {
+	var match LifecycleRule
+	found := false
+	for _, rule := range rules {
+		if strings.HasPrefix(name, rule.FileNamePrefix) &&
+			(!found || len(rule.FileNamePrefix) > len(match.FileNamePrefix)) {
+			match = rule
+			found = true
+		}
+	}
+
+	return match, found
+}
+
+// RunLifecycle applies the lifecycle rules of every bucket created by a dummy
+// account as if the current time were `now`, hiding and deleting files that
+// have expired. This allows testing lifecycle rules without waiting for them
+// to take effect, for example:
+//
+//	err := b2.RunLifecycle(time.Now().AddDate(0, 0, 30))
+//
+// Files are hidden at the time their rule takes effect rather than at `now`,
+// so a single call can both hide and delete a file. Files locked by a legal
+// hold or retention are hidden, but not deleted.
+//
+// Only dummy accounts can run lifecycle rules, since B2 applies them to
+// buckets automatically.
+func (b2Service *Service) RunLifecycle(now time.Time) error {
+	return b2Service.RunLifecycleContext(context.Background(), now)
+}
+
+// RunLifecycleContext is the same as RunLifecycle, but uses the provided
+// context.
+func (b2Service *Service) RunLifecycleContext(
+	ctx context.Context,
+	now time.Time,
+) error {
+	if !b2Service.Dummy {
+		return errors.New("lifecycle rules can only be run by dummy accounts")
+	}
+
+	bucketList, err := listLocalBuckets(ctx, b2Service.LocalPath, "", "")
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range bucketList.Buckets {
+		if len(bucket.LifecycleRules) == 0 {
+			continue
+		}
+
+		err = b2Service.runLocalLifecycle(ctx, bucket, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runLocalLifecycle applies a dummy account bucket's lifecycle rules to each
+// of the files in the bucket.
+func (b2Service *Service) runLocalLifecycle(
+	ctx context.Context,
+	bucket Bucket,
+	now time.Time,
+) error {
+	root := b2Service.LocalPath
+	versions, err := localFileVersions(ctx, root, bucket.BucketID)
+	if err != nil {
+		return err
+	}
+
+	hiddenAt := map[string]int64{}
+	for _, file := range versions {
+		if file.Action == ActionHide {
+			hiddenAt[file.FileID] = int64(file.UploadTimestamp)
+		}
+	}
+
+	for _, file := range versions {
+		rule, ok := matchLifecycleRule(bucket.LifecycleRules, file.FileName)
+		if file.Action != ActionUpload || !ok {
+			continue
+		}
+
+		marker := localHideMarkerPrefix + file.FileID
+		timestamp, hidden := hiddenAt[marker]
+		if !hidden && rule.DaysFromUploadingToHiding > 0 {
+			hideAt := time.UnixMilli(int64(file.UploadTimestamp)).
+				AddDate(0, 0, rule.DaysFromUploadingToHiding)
+			if hideAt.After(now) {
+				continue
+			}
+
+			timestamp, hidden = hideAt.UnixMilli(), true
+			if err = hideLocalFileAt(root, file.FileID, timestamp); err != nil {
+				return err
+			}
+
+			b2Service.notifyLocalEvent(ctx, root, Event{
+				EventType: EventHideMarkerCreatedLifecycleRule,
+				BucketID:  bucket.BucketID,
+				FileID:    marker,
+				FileName:  file.FileName,
+			})
+		}
+
+		if !hidden || rule.DaysFromHidingToDeleting == 0 {
+			continue
+		}
+
+		deleteAt := time.UnixMilli(timestamp).
+			AddDate(0, 0, rule.DaysFromHidingToDeleting)
+		if deleteAt.After(now) {
+			continue
+		}
+
+		err = checkLocalFileLock(root, file.FileID, false, APIDeleteFile)
+		if errors.Is(err, &APIError{Code: "access_denied"}) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if _, err = deleteLocalFile(ctx, file.FileID, root, false); err != nil {
+			return err
+		}
+
+		b2Service.notifyLocalDelete(
+			ctx, file.FileID, EventObjectDeletedLifecycleRule)
+	}
+
+	return nil
+}
@@ -1,36 +1,63 @@
 package b2
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/benbusby/b2/utils"
+	"io/fs"
 	"net/http"
-	"net/http/httputil"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
 const APIListFileVersions = "b2_list_file_versions"
+const APIListFileNames = "b2_list_file_names"
 
+// Values of the Action field for files returned by B2
+const (
+	// ActionUpload is a file that was uploaded
+	ActionUpload = "upload"
+
+	// ActionCopy is a file that was created with CopyFile
+	ActionCopy = "copy"
+
+	// ActionHide is a hide marker created by HideFile. Hide markers are
+	// listed as versions of the hidden file, and can be deleted with
+	// DeleteFile to make the file visible again.
+	ActionHide = "hide"
+
+	// ActionStart is a large file that was started with StartLargeFile but
+	// hasn't been finished or canceled yet.
+	ActionStart = "start"
+
+	// ActionFolder is a virtual folder, which is only returned when listing
+	// with a Delimiter. Folders don't have a file ID, and their name is the
+	// common prefix of the files they contain, including the delimiter.
+	ActionFolder = "folder"
+)
+
+// FileListItem is a single file returned by ListFiles or ListFileNames. The
+// Action field is one of ActionUpload, ActionHide, ActionStart, or
+// ActionFolder, and describes what the entry represents.
 type FileListItem struct {
-	AccountID     string `json:"accountId"`
-	Action        string `json:"action"`
-	BucketID      string `json:"bucketId"`
-	ContentLength int64  `json:"contentLength"`
-	ContentSha1   string `json:"contentSha1"`
-	ContentMd5    string `json:"contentMd5"`
-	ContentType   string `json:"contentType"`
-	FileID        string `json:"fileId"`
-	FileInfo      struct {
-		SrcLastModifiedMillis string `json:"src_last_modified_millis"`
-	} `json:"fileInfo"`
-	FileName      string `json:"fileName"`
+	AccountID     string            `json:"accountId"`
+	Action        string            `json:"action"`
+	BucketID      string            `json:"bucketId"`
+	ContentLength int64             `json:"contentLength"`
+	ContentSha1   string            `json:"contentSha1"`
+	ContentMd5    string            `json:"contentMd5"`
+	ContentType   string            `json:"contentType"`
+	FileID        string            `json:"fileId"`
+	FileInfo      map[string]string `json:"fileInfo"`
+	FileName      string            `json:"fileName"`
 	FileRetention struct {
-		IsClientAuthorizedToRead bool `json:"isClientAuthorizedToRead"`
-		Value                    struct {
-			Mode                 string `json:"mode"`
-			RetainUntilTimestamp string `json:"retainUntilTimestamp"`
-		} `json:"value"`
+		IsClientAuthorizedToRead bool          `json:"isClientAuthorizedToRead"`
+		Value                    FileRetention `json:"value"`
 	} `json:"fileRetention"`
 	LegalHold struct {
 		IsClientAuthorizedToRead bool   `json:"isClientAuthorizedToRead"`
@@ -53,7 +80,8 @@ type FileList struct {
 // ListAllFiles is a helper function for simply fetching all available files in
 // the bucket. If more than 100 files exist, the FileList struct will contain
 // NextFileName and NextFileID fields that can be used with ListFiles to fetch
-// the remainder.
+// the remainder. IterateFileVersions can be used instead to page through
+// every file without handling NextFileName and NextFileID directly.
 func (b2Service *Service) ListAllFiles(bucketID string) (FileList, error) {
 	return b2Service.ListFiles(bucketID, 100, "", "")
 }
@@ -73,43 +101,156 @@ func (b2Service *Service) ListFiles(
 	count int,
 	startName string,
 	startID string,
+) (FileList, error) {
+	return b2Service.ListFilesContext(
+		context.Background(), bucketID, count, startName, startID)
+}
+
+// ListFilesContext is the same as ListFiles, but uses the provided context
+// for the request.
+func (b2Service *Service) ListFilesContext(
+	ctx context.Context,
+	bucketID string,
+	count int,
+	startName string,
+	startID string,
+) (FileList, error) {
+	return b2Service.ListFileVersionsContext(ctx, bucketID, ListOptions{
+		Count:         count,
+		StartFileName: startName,
+		StartFileID:   startID,
+	})
+}
+
+// ListOptions contains optional settings for listing files.
+type ListOptions struct {
+	// Count is the maximum number of files returned. If not set, the default
+	// number of files returned is 100.
+	Count int
+
+	// StartFileName is the first file name to return. The NextFileName from
+	// a previous FileList can be used to continue listing where it left off.
+	StartFileName string
+
+	// StartFileID is the first file ID to return when listing file versions
+	// starting from StartFileName, and is ignored when listing file names.
+	StartFileID string
+
+	// Prefix limits the listing to files whose names begin with the prefix.
+	Prefix string
+
+	// Delimiter groups files whose names contain the delimiter after the
+	// Prefix into a single ActionFolder entry, similar to a directory. For
+	// example, a Delimiter of "/" lists "photos/a.jpg" and "photos/b.jpg" as
+	// the folder "photos/".
+	Delimiter string
+}
+
+// ListFileVersions is the same as ListFiles, but accepts the full set of
+// listing options, including a Prefix and Delimiter for browsing folders.
+func (b2Service *Service) ListFileVersions(
+	bucketID string,
+	opts ListOptions,
+) (FileList, error) {
+	return b2Service.ListFileVersionsContext(
+		context.Background(), bucketID, opts)
+}
+
+// ListFileVersionsContext is the same as ListFileVersions, but uses the
+// provided context for the request.
+func (b2Service *Service) ListFileVersionsContext(
+	ctx context.Context,
+	bucketID string,
+	opts ListOptions,
+) (FileList, error) {
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFile(
+			APIListFileVersions, "listFiles", bucketID, opts.Prefix)
+		if err != nil {
+			return FileList{}, err
+		}
+
+		return listLocalFiles(ctx, b2Service.LocalPath, bucketID, opts)
+	}
+
+	return b2Service.listFiles(ctx, APIListFileVersions, bucketID, opts)
+}
+
+// ListFileNames lists the current version of each file in the specified
+// bucket, skipping older versions and hidden files.
+func (b2Service *Service) ListFileNames(
+	bucketID string,
+	opts ListOptions,
+) (FileList, error) {
+	return b2Service.ListFileNamesContext(context.Background(), bucketID, opts)
+}
+
+// ListFileNamesContext is the same as ListFileNames, but uses the provided
+// context for the request.
+func (b2Service *Service) ListFileNamesContext(
+	ctx context.Context,
+	bucketID string,
+	opts ListOptions,
 ) (FileList, error) {
 	if b2Service.Dummy {
-		return listLocalFiles(b2Service.LocalPath)
+		err := b2Service.checkLocalKeyFile(
+			APIListFileNames, "listFiles", bucketID, opts.Prefix)
+		if err != nil {
+			return FileList{}, err
+		}
+
+		return listLocalFileNames(ctx, b2Service.LocalPath, bucketID, opts)
 	}
 
+	opts.StartFileID = ""
+	return b2Service.listFiles(ctx, APIListFileNames, bucketID, opts)
+}
+
+// listFiles requests a list of files from either b2_list_file_versions or
+// b2_list_file_names.
+func (b2Service *Service) listFiles(
+	ctx context.Context,
+	endpoint string,
+	bucketID string,
+	opts ListOptions,
+) (FileList, error) {
 	reqURL := utils.FormatB2URL(
-		b2Service.APIURL, b2Service.APIVersion, APIListFileVersions)
+		b2Service.apiURL(), b2Service.APIVersion, endpoint)
 
-	req, err := http.NewRequest("GET", reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
 		return FileList{}, err
 	}
 
 	q := req.URL.Query()
 	q.Add("bucketId", bucketID)
-	q.Add("maxFileCount", fmt.Sprintf("%d", count))
 
-	if len(startName) > 0 {
-		q.Add("startFileName", startName)
+	if opts.Count > 0 {
+		q.Add("maxFileCount", fmt.Sprintf("%d", opts.Count))
 	}
 
-	if len(startID) > 0 {
-		q.Add("startFileId", startID)
+	for name, value := range map[string]string{
+		"startFileName": opts.StartFileName,
+		"startFileId":   opts.StartFileID,
+		"prefix":        opts.Prefix,
+		"delimiter":     opts.Delimiter,
+	} {
+		if len(value) > 0 {
+			q.Add(name, value)
+		}
 	}
 
 	req.URL.RawQuery = q.Encode()
 	req.Header = http.Header{
-		"Authorization": {b2Service.AuthorizationToken},
+		"Authorization": {b2Service.token()},
 	}
 
-	res, err := utils.Client.Do(req)
+	res, err := b2Service.do(req)
 	if err != nil {
 		b2Service.Logf("B2Error requesting B2 file list: %v\n", err)
 		return FileList{}, err
 	} else if res.StatusCode >= 400 {
-		resp, _ := httputil.DumpResponse(res, true)
-		return FileList{}, utils.NewB2Error(nil, string(resp))
+		return FileList{}, b2Service.apiError(res, endpoint)
 	}
 
 	var b2FileList FileList
@@ -122,31 +263,240 @@ func (b2Service *Service) ListFiles(
 	return b2FileList, nil
 }
 
-// listLocalFiles returns all files within the specified path. Unlike the
-// B2 version of listing files, listing local files will return all files
-// within the directory.
-func listLocalFiles(path string) (FileList, error) {
-	dir, err := os.ReadDir(path)
+// localFileVersions returns every version of the files stored by a dummy
+// account within the specified path, or within the bucket's subdirectory of
+// that path if the ID of a bucket created by the dummy account is provided.
+// Since local files only have a single version, a hidden file is listed
+// after its hide marker, which is the newer version of the file. Large files
+// that haven't been finished are included as well. The files are sorted by
+// name, which B2 compares byte-by-byte, so nested directories are walked
+// first and sorted afterwards.
+func localFileVersions(
+	ctx context.Context,
+	root string,
+	bucketID string,
+) ([]FileListItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	path := root
+	if localBucketExists(root, bucketID) {
+		path = filepath.Join(root, bucketID)
+	}
+
+	hidden, err := readLocalHidden(root)
 	if err != nil {
-		return FileList{}, err
+		return nil, err
 	}
 
 	var fileList []FileListItem
-	for _, file := range dir {
-		name := file.Name()
-		filePath := fmt.Sprintf("%s/%s", strings.TrimSuffix(path, "/"), name)
-		stat, err := os.Stat(filePath)
+	err = filepath.WalkDir(path, func(
+		filePath string,
+		entry fs.DirEntry,
+		err error,
+	) error {
 		if err != nil {
-			return FileList{}, err
+			return err
+		} else if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(path, filePath)
+		if err != nil {
+			return err
+		}
+
+		name = filepath.ToSlash(name)
+		if entry.IsDir() {
+			// Dummy account metadata and buckets are stored alongside files
+			// in the account's root directory, but aren't part of the files
+			if name == localMetadataDir ||
+				(path == root && name != "." && localBucketExists(root, name)) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		id := localFileID(root, bucketID, name)
+		if timestamp, ok := hidden[id]; ok {
+			fileList = append(fileList, FileListItem{
+				Action:          ActionHide,
+				FileName:        name,
+				FileID:          localHideMarkerPrefix + id,
+				BucketID:        bucketID,
+				UploadTimestamp: int(timestamp),
+			})
+		}
+
+		metadata, err := readLocalFileMetadata(root, id)
+		if err != nil {
+			return err
+		}
+
+		item := FileListItem{
+			Action:          ActionUpload,
+			FileName:        name,
+			FileID:          id,
+			FileInfo:        metadata.FileInfo,
+			BucketID:        bucketID,
+			ContentLength:   info.Size(),
+			ContentSha1:     metadata.ContentSha1,
+			ContentType:     metadata.ContentType,
+			UploadTimestamp: int(info.ModTime().UnixMilli()),
+		}
+
+		item.ServerSideEncryption, item.FileRetention, item.LegalHold =
+			metadata.fileFields()
+		fileList = append(fileList, item)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	started, err := os.ReadDir(localMetadataPath(root, "parts"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, entry := range started {
+		if !entry.IsDir() {
+			continue
+		}
+
+		id, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		_, name := splitLocalFileID(root, id)
+		if localFileID(root, bucketID, name) != id {
+			continue
 		}
 
 		fileList = append(fileList, FileListItem{
-			FileName:      name,
-			FileID:        name,
-			BucketID:      name,
-			ContentLength: stat.Size(),
+			Action:   ActionStart,
+			FileName: name,
+			FileID:   id,
+			BucketID: bucketID,
 		})
 	}
 
-	return FileList{Files: fileList}, nil
+	sort.SliceStable(fileList, func(i, j int) bool {
+		return fileList[i].FileName < fileList[j].FileName
+	})
+
+	return fileList, nil
+}
+
+// listLocalFiles lists every version of the files stored by a dummy account
+// in the same way as b2_list_file_versions.
+func listLocalFiles(
+	ctx context.Context,
+	root string,
+	bucketID string,
+	opts ListOptions,
+) (FileList, error) {
+	versions, err := localFileVersions(ctx, root, bucketID)
+	if err != nil {
+		return FileList{}, err
+	}
+
+	return pageLocalFiles(versions, opts), nil
+}
+
+// listLocalFileNames lists the files stored by a dummy account in the same
+// way as b2_list_file_names, skipping hidden files and unfinished large
+// files.
+func listLocalFileNames(
+	ctx context.Context,
+	root string,
+	bucketID string,
+	opts ListOptions,
+) (FileList, error) {
+	versions, err := localFileVersions(ctx, root, bucketID)
+	if err != nil {
+		return FileList{}, err
+	}
+
+	var files []FileListItem
+	hidden := map[string]bool{}
+	for _, file := range versions {
+		if file.Action == ActionHide {
+			hidden[file.FileName] = true
+		} else if file.Action == ActionUpload && !hidden[file.FileName] {
+			files = append(files, file)
+		}
+	}
+
+	opts.StartFileID = ""
+	fileList := pageLocalFiles(files, opts)
+	fileList.NextFileID = ""
+
+	return fileList, nil
+}
+
+// pageLocalFiles applies listing options to a dummy account's files, which
+// must already be sorted by name. Files with a name containing the delimiter
+// after the prefix are replaced with a single folder entry, and NextFileName
+// and NextFileID are set to the first entry that didn't fit within the count.
+func pageLocalFiles(files []FileListItem, opts ListOptions) FileList {
+	count := opts.Count
+	if count <= 0 {
+		count = 100
+	}
+
+	// Versions with the same name as StartFileName are skipped until the
+	// version with StartFileID is found
+	skipping := len(opts.StartFileID) > 0
+
+	fileList := FileList{Files: []FileListItem{}}
+	for _, file := range files {
+		rest, ok := strings.CutPrefix(file.FileName, opts.Prefix)
+		if !ok {
+			continue
+		}
+
+		if len(opts.Delimiter) > 0 {
+			if i := strings.Index(rest, opts.Delimiter); i >= 0 {
+				file = FileListItem{
+					Action:   ActionFolder,
+					BucketID: file.BucketID,
+					FileName: opts.Prefix + rest[:i+len(opts.Delimiter)],
+				}
+			}
+		}
+
+		if file.FileName < opts.StartFileName {
+			continue
+		} else if skipping && file.FileName == opts.StartFileName {
+			if file.FileID != opts.StartFileID {
+				continue
+			}
+
+			skipping = false
+		}
+
+		last := len(fileList.Files) - 1
+		if file.Action == ActionFolder && last >= 0 &&
+			fileList.Files[last].FileName == file.FileName {
+			continue
+		} else if len(fileList.Files) == count {
+			fileList.NextFileName = file.FileName
+			fileList.NextFileID = file.FileID
+			break
+		}
+
+		fileList.Files = append(fileList.Files, file)
+	}
+
+	return fileList
 }
@@ -0,0 +1,505 @@
+package b2
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/benbusby/b2/utils"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const APISetBucketNotificationRules = "b2_set_bucket_notification_rules"
+const APIGetBucketNotificationRules = "b2_get_bucket_notification_rules"
+
+// Event types that can trigger an event notification. Types ending in "*"
+// match every event of that category.
+const (
+	EventObjectCreatedAll               = "b2:ObjectCreated:*"
+	EventObjectCreatedUpload            = "b2:ObjectCreated:Upload"
+	EventObjectCreatedMultipartUpload   = "b2:ObjectCreated:MultipartUpload"
+	EventObjectCreatedCopy              = "b2:ObjectCreated:Copy"
+	EventObjectCreatedReplica           = "b2:ObjectCreated:Replica"
+	EventObjectCreatedMultipartReplica  = "b2:ObjectCreated:MultipartReplica"
+	EventObjectDeletedAll               = "b2:ObjectDeleted:*"
+	EventObjectDeletedDelete            = "b2:ObjectDeleted:Delete"
+	EventObjectDeletedLifecycleRule     = "b2:ObjectDeleted:LifecycleRule"
+	EventHideMarkerCreatedAll           = "b2:HideMarkerCreated:*"
+	EventHideMarkerCreatedHide          = "b2:HideMarkerCreated:Hide"
+	EventHideMarkerCreatedLifecycleRule = "b2:HideMarkerCreated:LifecycleRule"
+	EventMultipartUploadCreatedAll      = "b2:MultipartUploadCreated:*"
+	EventMultipartUploadCreatedLiveRead = "b2:MultipartUploadCreated:LiveRead"
+)
+
+// eventTypes contains each event type accepted by B2
+var eventTypes = map[string]bool{
+	EventObjectCreatedAll:               true,
+	EventObjectCreatedUpload:            true,
+	EventObjectCreatedMultipartUpload:   true,
+	EventObjectCreatedCopy:              true,
+	EventObjectCreatedReplica:           true,
+	EventObjectCreatedMultipartReplica:  true,
+	EventObjectDeletedAll:               true,
+	EventObjectDeletedDelete:            true,
+	EventObjectDeletedLifecycleRule:     true,
+	EventHideMarkerCreatedAll:           true,
+	EventHideMarkerCreatedHide:          true,
+	EventHideMarkerCreatedLifecycleRule: true,
+	EventMultipartUploadCreatedAll:      true,
+	EventMultipartUploadCreatedLiveRead: true,
+}
+
+// EventTargetTypeWebhook is the only target type supported by B2
+const EventTargetTypeWebhook = "webhook"
+
+// EventSignatureHeader is the header containing the HMAC-SHA256 signature of
+// an event notification, which is only sent if the rule has a signing secret.
+const EventSignatureHeader = "X-Bz-Event-Notification-Signature"
+
+// eventSigningSecretSize is the required length of a signing secret
+const eventSigningSecretSize = 32
+
+var eventRuleNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,63}$`)
+var eventSigningSecretRegex = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// EventNotificationRule sends a notification to a webhook whenever one of
+// the EventTypes occurs for a file whose name starts with ObjectNamePrefix.
+type EventNotificationRule struct {
+	// Name is a unique name for the rule, and is included in each event as
+	// MatchedRuleName.
+	Name string `json:"name"`
+
+	// EventTypes contains the events that trigger a notification, using the
+	// Event constants.
+	EventTypes []string `json:"eventTypes"`
+
+	// ObjectNamePrefix limits the rule to files whose names start with the
+	// prefix. An empty prefix matches every file.
+	ObjectNamePrefix string `json:"objectNamePrefix"`
+
+	// IsEnabled determines whether notifications are sent for the rule.
+	IsEnabled bool `json:"isEnabled"`
+
+	TargetConfiguration EventNotificationTarget `json:"targetConfiguration"`
+
+	// IsSuspended and SuspensionReason are set by B2 when notifications for
+	// the rule are suspended after repeated delivery failures, and are
+	// ignored when setting rules.
+	IsSuspended      bool   `json:"isSuspended,omitempty"`
+	SuspensionReason string `json:"suspensionReason,omitempty"`
+}
+
+// EventNotificationTarget is the webhook that events are sent to.
+type EventNotificationTarget struct {
+	// TargetType defaults to EventTargetTypeWebhook if empty.
+	TargetType string `json:"targetType"`
+
+	// URL is the webhook URL that events are POSTed to. B2 requires HTTPS,
+	// but dummy accounts can use HTTP URLs for local servers.
+	URL string `json:"url"`
+
+	// CustomHeaders are added to each request sent to the webhook.
+	CustomHeaders []EventNotificationHeader `json:"customHeaders,omitempty"`
+
+	// HmacSha256SigningSecret, if set, is used to sign each request in the
+	// EventSignatureHeader, and must be 32 alphanumeric characters.
+	HmacSha256SigningSecret string `json:"hmacSha256SigningSecret,omitempty"`
+}
+
+// EventNotificationHeader is a custom header sent with each event
+// notification.
+type EventNotificationHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Event is a single event included in an event notification. The object
+// fields use the same names as the rest of the library's file fields.
+// ContentSha1 is only set when the checksum is known, and is empty for delete
+// events.
+type Event struct {
+	AccountID       string `json:"accountId"`
+	BucketID        string `json:"bucketId"`
+	BucketName      string `json:"bucketName"`
+	EventID         string `json:"eventId"`
+	EventTimestamp  int64  `json:"eventTimestamp"`
+	EventType       string `json:"eventType"`
+	EventVersion    int    `json:"eventVersion"`
+	MatchedRuleName string `json:"matchedRuleName"`
+	FileName        string `json:"objectName"`
+	ContentLength   int64  `json:"objectSize,omitempty"`
+	ContentSha1     string `json:"contentSha1,omitempty"`
+	FileID          string `json:"objectVersionId"`
+}
+
+// EventNotification is the request body sent to a webhook by B2.
+type EventNotification struct {
+	Events []Event `json:"events"`
+}
+
+// bucketNotificationRules is the request body for
+// b2_set_bucket_notification_rules, and the response body for both
+// b2_set_bucket_notification_rules and b2_get_bucket_notification_rules
+type bucketNotificationRules struct {
+	BucketID               string                  `json:"bucketId"`
+	EventNotificationRules []EventNotificationRule `json:"eventNotificationRules"`
+}
+
+// getNotificationRulesRequest is the request body for
+// b2_get_bucket_notification_rules
+type getNotificationRulesRequest struct {
+	BucketID string `json:"bucketId"`
+}
+
+// matchesEvent checks if the rule applies to an event for a file
+func (rule EventNotificationRule) matchesEvent(
+	eventType string,
+	name string,
+) bool {
+	if !rule.IsEnabled || !strings.HasPrefix(name, rule.ObjectNamePrefix) {
+		return false
+	}
+
+	for _, ruleType := range rule.EventTypes {
+		category, wildcard := strings.CutSuffix(ruleType, "*")
+		if ruleType == eventType ||
+			(wildcard && strings.HasPrefix(eventType, category)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateEventNotificationRules checks that each rule is valid
+func validateEventNotificationRules(
+	rules []EventNotificationRule,
+	endpoint string,
+) error {
+	invalid := func(format string, v ...any) error {
+		return localError(http.StatusBadRequest, "bad_request", endpoint,
+			format, v...)
+	}
+
+	names := map[string]bool{}
+	for _, rule := range rules {
+		target := rule.TargetConfiguration
+		secret := target.HmacSha256SigningSecret
+		if !eventRuleNameRegex.MatchString(rule.Name) {
+			return invalid("invalid event notification rule name %q",
+				rule.Name)
+		} else if names[rule.Name] {
+			return invalid("duplicate event notification rule name %q",
+				rule.Name)
+		} else if len(rule.EventTypes) == 0 {
+			return invalid("rule %s has no event types", rule.Name)
+		} else if target.TargetType != EventTargetTypeWebhook {
+			return invalid("rule %s has invalid target type %q",
+				rule.Name, target.TargetType)
+		} else if len(secret) > 0 && (len(secret) != eventSigningSecretSize ||
+			!eventSigningSecretRegex.MatchString(secret)) {
+			return invalid("rule %s signing secret must be %d alphanumeric "+
+				"characters", rule.Name, eventSigningSecretSize)
+		}
+
+		names[rule.Name] = true
+
+		for _, eventType := range rule.EventTypes {
+			if !eventTypes[eventType] {
+				return invalid("rule %s has invalid event type %q",
+					rule.Name, eventType)
+			}
+		}
+
+		targetURL, err := url.Parse(target.URL)
+		if err != nil || len(targetURL.Host) == 0 ||
+			(targetURL.Scheme != "https" && targetURL.Scheme != "http") {
+			return invalid("rule %s has invalid URL %q", rule.Name, target.URL)
+		}
+	}
+
+	return nil
+}
+
+// SetBucketNotificationRules replaces the event notification rules for a
+// bucket, returning the bucket's new rules. Passing an empty slice removes
+// all of the bucket's rules.
+//
+// Dummy accounts store the rules, and send notifications to each enabled
+// rule's URL after uploading, copying, hiding, or deleting a file (including
+// changes made by RunLifecycle).
+func (b2Service *Service) SetBucketNotificationRules(
+	bucketID string,
+	rules []EventNotificationRule,
+) ([]EventNotificationRule, error) {
+	return b2Service.SetBucketNotificationRulesContext(
+		context.Background(), bucketID, rules)
+}
+
+// SetBucketNotificationRulesContext is the same as SetBucketNotificationRules,
+// but uses the provided context for the request.
+func (b2Service *Service) SetBucketNotificationRulesContext(
+	ctx context.Context,
+	bucketID string,
+	rules []EventNotificationRule,
+) ([]EventNotificationRule, error) {
+	request := make([]EventNotificationRule, len(rules))
+	for i, rule := range rules {
+		if len(rule.TargetConfiguration.TargetType) == 0 {
+			rule.TargetConfiguration.TargetType = EventTargetTypeWebhook
+		}
+
+		rule.IsSuspended = false
+		rule.SuspensionReason = ""
+		request[i] = rule
+	}
+
+	err := validateEventNotificationRules(
+		request, APISetBucketNotificationRules)
+	if err != nil {
+		return nil, err
+	}
+
+	if b2Service.Dummy {
+		_, err = b2Service.checkLocalKeyBucket(APISetBucketNotificationRules,
+			"writeBucketNotifications", bucketID)
+		if err != nil {
+			return nil, err
+		}
+
+		return setLocalNotificationRules(
+			ctx, b2Service.LocalPath, bucketID, request)
+	}
+
+	var res bucketNotificationRules
+	err = b2Service.postJSON(ctx, APISetBucketNotificationRules,
+		bucketNotificationRules{
+			BucketID:               bucketID,
+			EventNotificationRules: request,
+		}, &res)
+
+	return res.EventNotificationRules, err
+}
+
+// GetBucketNotificationRules returns the event notification rules for a
+// bucket.
+func (b2Service *Service) GetBucketNotificationRules(
+	bucketID string,
+) ([]EventNotificationRule, error) {
+	return b2Service.GetBucketNotificationRulesContext(
+		context.Background(), bucketID)
+}
+
+// GetBucketNotificationRulesContext is the same as GetBucketNotificationRules,
+// but uses the provided context for the request.
+func (b2Service *Service) GetBucketNotificationRulesContext(
+	ctx context.Context,
+	bucketID string,
+) ([]EventNotificationRule, error) {
+	if b2Service.Dummy {
+		_, err := b2Service.checkLocalKeyBucket(APIGetBucketNotificationRules,
+			"readBucketNotifications", bucketID)
+		if err != nil {
+			return nil, err
+		}
+
+		return getLocalNotificationRules(ctx, b2Service.LocalPath, bucketID)
+	}
+
+	var res bucketNotificationRules
+	err := b2Service.postJSON(ctx, APIGetBucketNotificationRules,
+		getNotificationRulesRequest{BucketID: bucketID}, &res)
+
+	return res.EventNotificationRules, err
+}
+
+// signEventNotification returns the value of the EventSignatureHeader for an
+// event notification's request body.
+func signEventNotification(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// localNotificationRulesPath returns the path to the event notification
+// rules for a bucket created by a dummy account.
+func localNotificationRulesPath(root string, bucketID string) string {
+	return localMetadataPath(root, "notifications", bucketID+".json")
+}
+
+// getLocalNotificationRules reads the event notification rules for a bucket
+// created by a dummy account.
+func getLocalNotificationRules(
+	ctx context.Context,
+	root string,
+	bucketID string,
+) ([]EventNotificationRule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	} else if !localBucketExists(root, bucketID) {
+		return nil, localError(http.StatusBadRequest, "bad_bucket_id",
+			APIGetBucketNotificationRules, "bucket %s does not exist",
+			bucketID)
+	}
+
+	rules := []EventNotificationRule{}
+	err := utils.ReadJSONFile(localNotificationRulesPath(root, bucketID), &rules)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// setLocalNotificationRules stores the event notification rules for a bucket
+// created by a dummy account.
+func setLocalNotificationRules(
+	ctx context.Context,
+	root string,
+	bucketID string,
+	rules []EventNotificationRule,
+) ([]EventNotificationRule, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	} else if !localBucketExists(root, bucketID) {
+		return nil, localError(http.StatusBadRequest, "bad_bucket_id",
+			APISetBucketNotificationRules, "bucket %s does not exist",
+			bucketID)
+	}
+
+	path := localNotificationRulesPath(root, bucketID)
+	return rules, utils.WriteJSONFile(path, rules)
+}
+
+// event returns an event of the provided type for the file
+func (file File) event(eventType string) Event {
+	return Event{
+		EventType:     eventType,
+		BucketID:      file.BucketID,
+		FileID:        file.FileID,
+		FileName:      file.FileName,
+		ContentLength: file.ContentLength,
+		ContentSha1:   file.ContentSha1,
+	}
+}
+
+// notifyLocalDelete sends an event notification for a dummy account's file
+// (or hide marker) that has been deleted.
+func (b2Service *Service) notifyLocalDelete(
+	ctx context.Context,
+	id string,
+	eventType string,
+) {
+	fileID := strings.TrimPrefix(id, localHideMarkerPrefix)
+	bucketID, name := splitLocalFileID(b2Service.LocalPath, fileID)
+	b2Service.notifyLocalEvent(ctx, b2Service.LocalPath, Event{
+		EventType: eventType,
+		BucketID:  bucketID,
+		FileID:    id,
+		FileName:  name,
+	})
+}
+
+// notifyLocalEvent sends an event notification for a dummy account's file to
+// each enabled rule of the file's bucket that matches the event. The event
+// must already have its type and file fields set. Like B2, notifications are
+// sent after the file has been changed, and failing to deliver one doesn't
+// cause the change to fail; failures are only logged. Notifications are sent
+// using the context of the request that changed the file, so canceling it
+// stops waiting for a slow webhook.
+//
+// The receiver can be nil for uploads made with a FileInfo that wasn't
+// returned by GetUploadURL.
+func (b2Service *Service) notifyLocalEvent(
+	ctx context.Context,
+	root string,
+	event Event,
+) {
+	if !localBucketExists(root, event.BucketID) {
+		return
+	}
+
+	rules, err := getLocalNotificationRules(ctx, root, event.BucketID)
+	if err != nil {
+		b2Service.Logf("Error reading local notification rules: %v\n", err)
+		return
+	}
+
+	for _, rule := range rules {
+		if !rule.matchesEvent(event.EventType, event.FileName) {
+			continue
+		}
+
+		id := make([]byte, 16)
+		if _, err = rand.Read(id); err != nil {
+			b2Service.Logf("Error creating local event ID: %v\n", err)
+			return
+		}
+
+		event.EventID = hex.EncodeToString(id)
+		event.EventTimestamp = time.Now().UnixMilli()
+		event.EventVersion = 1
+		event.BucketName = event.BucketID
+		event.MatchedRuleName = rule.Name
+		if b2Service != nil {
+			event.AccountID = b2Service.AccountID
+		}
+
+		err = b2Service.sendLocalEvent(ctx, rule.TargetConfiguration, event)
+		if err != nil {
+			b2Service.Logf("Error sending local event to %s: %v\n",
+				rule.TargetConfiguration.URL, err)
+		}
+	}
+}
+
+// sendLocalEvent POSTs an event notification to a rule's webhook in the same
+// format as B2.
+func (b2Service *Service) sendLocalEvent(
+	ctx context.Context,
+	target EventNotificationTarget,
+	event Event,
+) error {
+	body, err := json.Marshal(EventNotification{Events: []Event{event}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, "POST", target.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "B2/EventNotifications")
+	for _, header := range target.CustomHeaders {
+		req.Header.Set(header.Name, header.Value)
+	}
+
+	if len(target.HmacSha256SigningSecret) > 0 {
+		req.Header.Set(EventSignatureHeader,
+			signEventNotification(target.HmacSha256SigningSecret, body))
+	}
+
+	res, err := b2Service.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+
+	_ = res.Body.Close()
+	if res.StatusCode >= 400 {
+		return errors.New(res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package b2
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"github.com/benbusby/b2/utils"
+	"io"
+	"strings"
+	"sync"
+)
+
+const DefaultDownloadWorkers = 4
+
+// ParallelDownloadOptions contains optional settings for
+// ParallelDownloadById.
+type ParallelDownloadOptions struct {
+	// PartSize is the number of bytes requested in each ranged download.
+	// Defaults to the account's RecommendedPartSize, or DefaultPartSize if
+	// the account doesn't have one.
+	PartSize int64
+
+	// Workers is the number of ranges that are downloaded concurrently.
+	// Defaults to DefaultDownloadWorkers.
+	Workers int
+
+	// Encryption contains the customer key for downloading a file that was
+	// encrypted with SSEModeC.
+	Encryption *ServerSideEncryption
+}
+
+// downloadedPart is a single byte range of a file that has been downloaded
+type downloadedPart struct {
+	num      int64
+	contents []byte
+	err      error
+}
+
+// ParallelDownloadById downloads a file from B2 by splitting it into byte
+// ranges that are downloaded concurrently and written to `w`. Once every
+// range has been downloaded, the SHA1 checksum of the full file is compared
+// against the checksum stored in B2 (or the "large_file_sha1" file info for
+// large files), and utils.ChecksumError is returned if they don't match.
+// Large files uploaded without a "large_file_sha1" value are not verified.
+//
+// Up to (2 * Workers) ranges are held in memory at a time while waiting for
+// the checksum to be calculated in order.
+func (b2Service *Service) ParallelDownloadById(
+	ctx context.Context,
+	id string,
+	w io.WriterAt,
+	opts ParallelDownloadOptions,
+) (DownloadInfo, error) {
+	partSize := opts.PartSize
+	if partSize <= 0 {
+		partSize = b2Service.recommendedPartSize()
+	}
+
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultDownloadWorkers
+	}
+
+	if err := ctx.Err(); err != nil {
+		return DownloadInfo{}, err
+	}
+
+	// The file's size and checksum are read with a HEAD request, so that
+	// only the ranges themselves are downloaded
+	info, err := b2Service.headById(ctx, id, opts.Encryption)
+	if err != nil {
+		return DownloadInfo{}, err
+	}
+
+	expectedSha1 := info.ContentSha1
+	if len(expectedSha1) == 0 || expectedSha1 == "none" {
+		expectedSha1 = info.FileInfo["large_file_sha1"]
+	}
+
+	expectedSha1 = strings.TrimPrefix(expectedSha1, "unverified:")
+
+	numParts := (info.ContentLength + partSize - 1) / partSize
+
+	downloadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int64)
+	results := make(chan downloadedPart)
+	slots := make(chan struct{}, workers*2)
+
+	go func() {
+		defer close(jobs)
+		for num := int64(0); num < numParts; num++ {
+			select {
+			case slots <- struct{}{}:
+			case <-downloadCtx.Done():
+				return
+			}
+
+			select {
+			case jobs <- num:
+			case <-downloadCtx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for num := range jobs {
+				part := b2Service.downloadPart(
+					downloadCtx, id, w, num, partSize, info.ContentLength,
+					opts.Encryption)
+				select {
+				case results <- part:
+				case <-downloadCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	h := sha1.New()
+	pending := map[int64][]byte{}
+	next := int64(0)
+	for next < numParts && err == nil {
+		select {
+		case part := <-results:
+			if part.err != nil {
+				err = fmt.Errorf("range %d: %w", part.num, part.err)
+				continue
+			}
+
+			// Parts are hashed in order as soon as they're available
+			pending[part.num] = part.contents
+			for contents, ok := pending[next]; ok; contents, ok = pending[next] {
+				h.Write(contents)
+				delete(pending, next)
+				next += 1
+				<-slots
+			}
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	cancel()
+	wg.Wait()
+
+	if err != nil {
+		return DownloadInfo{}, err
+	}
+
+	if len(expectedSha1) > 0 && fmt.Sprintf("%x", h.Sum(nil)) != expectedSha1 {
+		return DownloadInfo{}, utils.ChecksumError
+	}
+
+	return info, nil
+}
+
+// downloadPart downloads a single byte range of a file and writes it to `w`
+// at the range's offset.
+func (b2Service *Service) downloadPart(
+	ctx context.Context,
+	id string,
+	w io.WriterAt,
+	num int64,
+	partSize int64,
+	fileSize int64,
+	sse *ServerSideEncryption,
+) downloadedPart {
+	begin := num * partSize
+	end := begin + partSize - 1
+	if end >= fileSize {
+		end = fileSize - 1
+	}
+
+	reader, _, err := b2Service.DownloadReaderByIdWithOptionsContext(
+		ctx, id, DownloadOptions{
+			Range:      &ByteRange{Begin: begin, End: end},
+			Encryption: sse,
+		})
+	if err != nil {
+		return downloadedPart{num: num, err: err}
+	}
+
+	defer func(reader io.ReadCloser) {
+		_ = reader.Close()
+	}(reader)
+
+	contents := make([]byte, end-begin+1)
+	if _, err = io.ReadFull(reader, contents); err != nil {
+		return downloadedPart{num: num, err: err}
+	}
+
+	if _, err = w.WriteAt(contents, begin); err != nil {
+		return downloadedPart{num: num, err: err}
+	}
+
+	return downloadedPart{num: num, contents: contents}
+}
@@ -0,0 +1,298 @@
+package b2
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const DefaultPartSize int64 = 100 * 1000 * 1000
+const DefaultUploadWorkers = 4
+
+// LargeUploadOptions contains optional settings for UploadLarge.
+type LargeUploadOptions struct {
+	// PartSize is the number of bytes uploaded in each part of the file.
+	// Defaults to the account's RecommendedPartSize, or DefaultPartSize if
+	// the account doesn't have one.
+	PartSize int64
+
+	// Workers is the number of parts that are uploaded concurrently, with
+	// each worker using its own part upload URL. Defaults to
+	// DefaultUploadWorkers.
+	Workers int
+
+	// ContentType is the MIME type of the file. Defaults to ContentTypeAuto.
+	ContentType string
+
+	// FileInfo contains custom values stored with the file, in the same way
+	// as UploadOptions.
+	FileInfo map[string]string
+
+	// Encryption sets the server-side encryption used for storing the file,
+	// and is also used for uploading each part of a file encrypted with
+	// SSEModeC.
+	Encryption *ServerSideEncryption
+
+	// Retention and LegalHold set the Object Lock settings of the file, in
+	// the same way as UploadOptions.
+	Retention *FileRetention
+	LegalHold string
+}
+
+// filePart is a single part of a large file waiting to be uploaded
+type filePart struct {
+	num      int
+	checksum string
+	contents []byte
+}
+
+// UploadLarge uploads the contents of `r` to B2 as a large file, handling the
+// process of splitting the contents into parts, uploading them concurrently,
+// and finishing the file once all parts have been uploaded. If any part fails
+// to upload, or if the context is canceled, the large file is canceled and the
+// error is returned.
+//
+// Only (Workers + 1) parts are held in memory at a time. Contents that fit
+// within a single part are uploaded as a regular file instead.
+func (b2Service *Service) UploadLarge(
+	ctx context.Context,
+	bucketID string,
+	filename string,
+	r io.Reader,
+	opts LargeUploadOptions,
+) (LargeFile, error) {
+	partSize := opts.PartSize
+	if partSize <= 0 {
+		partSize = b2Service.recommendedPartSize()
+	}
+
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultUploadWorkers
+	}
+
+	uploadOpts := UploadOptions{
+		ContentType: opts.ContentType,
+		FileInfo:    opts.FileInfo,
+		Encryption:  opts.Encryption,
+		Retention:   opts.Retention,
+		LegalHold:   opts.LegalHold,
+	}
+
+	if len(uploadOpts.ContentType) == 0 {
+		uploadOpts.ContentType = ContentTypeAuto
+	}
+
+	if err := ctx.Err(); err != nil {
+		return LargeFile{}, err
+	}
+
+	// The first two parts are read before starting the large file, since
+	// B2 requires large files to have more than one part.
+	contents, eof, err := readFilePart(r, partSize)
+	if err != nil {
+		return LargeFile{}, err
+	}
+
+	var next []byte
+	if !eof {
+		next, eof, err = readFilePart(r, partSize)
+		if err != nil {
+			return LargeFile{}, err
+		}
+	}
+
+	if len(next) == 0 {
+		return b2Service.uploadSinglePart(
+			ctx, bucketID, filename, contents, uploadOpts)
+	}
+
+	startFile, err := b2Service.StartLargeFileWithOptionsContext(
+		ctx, filename, bucketID, uploadOpts)
+	if err != nil {
+		return LargeFile{}, err
+	}
+
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var uploadErr error
+	checksums := map[int]string{}
+
+	fail := func(err error) {
+		mu.Lock()
+		if uploadErr == nil {
+			uploadErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	parts := make(chan filePart)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			partInfo, err := b2Service.GetUploadPartURLContext(
+				uploadCtx, startFile.FileID)
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			for {
+				select {
+				case <-uploadCtx.Done():
+					return
+				case part, ok := <-parts:
+					if !ok {
+						return
+					}
+
+					err = UploadFilePartWithOptionsContext(
+						uploadCtx,
+						partInfo,
+						part.num,
+						part.checksum,
+						part.contents,
+						PartOptions{Encryption: opts.Encryption})
+					if err != nil {
+						fail(fmt.Errorf("part %d: %w", part.num, err))
+						return
+					}
+
+					mu.Lock()
+					checksums[part.num] = part.checksum
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	num := 1
+produce:
+	for len(contents) > 0 {
+		part := filePart{
+			num:      num,
+			checksum: fmt.Sprintf("%x", sha1.Sum(contents)),
+			contents: contents,
+		}
+
+		select {
+		case parts <- part:
+		case <-uploadCtx.Done():
+			break produce
+		}
+
+		num += 1
+		switch {
+		case next != nil:
+			contents, next = next, nil
+		case eof:
+			contents = nil
+		default:
+			contents, eof, err = readFilePart(r, partSize)
+			if err != nil {
+				fail(err)
+				break produce
+			}
+		}
+	}
+
+	close(parts)
+	wg.Wait()
+
+	if uploadErr == nil {
+		uploadErr = ctx.Err()
+	}
+
+	if uploadErr != nil {
+		// The large file is canceled even if the provided context was
+		// canceled, so that the uploaded parts don't linger in B2
+		_, err = b2Service.CancelLargeFile(startFile.FileID)
+		if err != nil {
+			b2Service.Logf("B2Error canceling large file: %v\n", err)
+		}
+
+		return LargeFile{}, uploadErr
+	}
+
+	orderedChecksums := make([]string, num-1)
+	for i := range orderedChecksums {
+		orderedChecksums[i] = checksums[i+1]
+	}
+
+	return b2Service.FinishLargeFileContext(
+		ctx, startFile.FileID, orderedChecksums)
+}
+
+// readFilePart reads up to `size` bytes from `r`, and reports whether the end
+// of `r` has been reached.
+func readFilePart(r io.Reader, size int64) ([]byte, bool, error) {
+	contents := make([]byte, size)
+	n, err := io.ReadFull(r, contents)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return contents[:n], true, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return contents, false, nil
+}
+
+// uploadSinglePart uploads contents that are too small to be a large file as
+// a regular file, and returns the result as a LargeFile.
+func (b2Service *Service) uploadSinglePart(
+	ctx context.Context,
+	bucketID string,
+	filename string,
+	contents []byte,
+	opts UploadOptions,
+) (LargeFile, error) {
+	info, err := b2Service.GetUploadURLContext(ctx, bucketID)
+	if err != nil {
+		return LargeFile{}, err
+	}
+
+	opts.Checksum = fmt.Sprintf("%x", sha1.Sum(contents))
+	file, err := UploadFileFromReaderContext(
+		ctx,
+		info,
+		filename,
+		bytes.NewReader(contents),
+		int64(len(contents)),
+		opts)
+	if err != nil {
+		return LargeFile{}, err
+	}
+
+	return LargeFile{
+		AccountID:       file.AccountID,
+		Action:          file.Action,
+		BucketID:        file.BucketID,
+		ContentLength:   file.ContentLength,
+		ContentMd5:      file.ContentMd5,
+		ContentSha1:     file.ContentSha1,
+		ContentType:     file.ContentType,
+		FileID:          file.FileID,
+		FileInfo:        file.FileInfo,
+		FileName:        file.FileName,
+		UploadTimestamp: file.UploadTimestamp,
+
+		FileRetention:        file.FileRetention,
+		LegalHold:            file.LegalHold,
+		ServerSideEncryption: file.ServerSideEncryption,
+	}, nil
+}
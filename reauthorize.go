@@ -0,0 +1,146 @@
+package b2
+
+import (
+	"context"
+	"github.com/benbusby/b2/utils"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CredentialProvider returns the application key ID and key used for
+// authorizing an account. It's called each time the account's authorization
+// token expires, and can be used to provide keys that are rotated while the
+// Service is in use.
+type CredentialProvider func(ctx context.Context) (string, string, error)
+
+// WithCredentialProvider sets the CredentialProvider used for reauthorizing
+// the account once its authorization token has expired. By default, the key
+// used for the initial authorization is reused.
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(b2Service *Service) {
+		b2Service.credentials = provider
+	}
+}
+
+// setCredentials stores the key used for authorizing the account, unless a
+// CredentialProvider has already been provided with WithCredentialProvider.
+func (b2Service *Service) setCredentials(b2BucketKeyId, b2BucketKey string) {
+	if b2Service.credentials != nil {
+		return
+	}
+
+	b2Service.credentials = func(context.Context) (string, string, error) {
+		return b2BucketKeyId, b2BucketKey, nil
+	}
+}
+
+// apiURL returns the account's current API URL.
+func (b2Service *Service) apiURL() string {
+	b2Service.authMu.RLock()
+	defer b2Service.authMu.RUnlock()
+
+	return b2Service.APIURL
+}
+
+// downloadURL returns the account's current download URL.
+func (b2Service *Service) downloadURL() string {
+	b2Service.authMu.RLock()
+	defer b2Service.authMu.RUnlock()
+
+	return b2Service.DownloadURL
+}
+
+// recommendedPartSize returns the account's current recommended part size.
+func (b2Service *Service) recommendedPartSize() int64 {
+	b2Service.authMu.RLock()
+	defer b2Service.authMu.RUnlock()
+
+	return b2Service.RecommendedPartSize
+}
+
+// token returns the account's current authorization token.
+func (b2Service *Service) token() string {
+	b2Service.authMu.RLock()
+	defer b2Service.authMu.RUnlock()
+
+	return b2Service.AuthorizationToken
+}
+
+// reauthorize authorizes the account again after `expiredToken` has expired.
+// If multiple goroutines attempt to reauthorize at the same time, only the
+// first one sends a new authorization request.
+func (b2Service *Service) reauthorize(
+	ctx context.Context,
+	expiredToken string,
+) error {
+	b2Service.reauthMu.Lock()
+	defer b2Service.reauthMu.Unlock()
+
+	if b2Service.token() != expiredToken {
+		// Another goroutine has already reauthorized the account
+		return nil
+	}
+
+	b2BucketKeyId, b2BucketKey, err := b2Service.credentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	b2Service.Logf("B2 authorization token expired, reauthorizing\n")
+
+	if b2Service.APIVersion == "v2" {
+		_, err = b2Service.authorizeV2(ctx, b2BucketKeyId, b2BucketKey)
+	} else {
+		_, err = b2Service.authorizeV3(ctx, b2BucketKeyId, b2BucketKey)
+	}
+
+	return err
+}
+
+// canReauthorize reports whether a failed request was authorized with the
+// account's authorization token, and can be sent again after reauthorizing.
+func (b2Service *Service) canReauthorize(req *http.Request) bool {
+	auth := req.Header.Get("Authorization")
+	return b2Service != nil &&
+		b2Service.credentials != nil &&
+		len(auth) > 0 &&
+		!strings.HasPrefix(auth, "Basic ")
+}
+
+// isExpiredToken reports whether a response was rejected due to an expired
+// or invalid authorization token. The response body can still be read
+// afterwards.
+func isExpiredToken(res *http.Response) bool {
+	if res == nil || res.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+
+	code := newAPIError(res, "").Code
+	return code == "expired_auth_token" || code == "bad_auth_token"
+}
+
+// rebaseURL replaces the base of a request URL with the account's current API
+// URL (or download URL, for files downloaded by name), which may change after
+// reauthorizing.
+func (b2Service *Service) rebaseURL(reqURL *url.URL) (*url.URL, error) {
+	path := reqURL.EscapedPath()
+	base := b2Service.apiURL()
+	idx := strings.Index(path, "/"+utils.APIPrefix+"/")
+	if idx < 0 {
+		base = b2Service.downloadURL()
+		idx = strings.Index(path, "/file/")
+	}
+
+	if idx < 0 || len(base) == 0 {
+		return reqURL, nil
+	}
+
+	rebased, err := url.Parse(strings.TrimSuffix(base, "/") + path[idx:])
+	if err != nil {
+		return nil, err
+	}
+
+	rebased.RawQuery = reqURL.RawQuery
+	return rebased, nil
+}
@@ -0,0 +1,254 @@
+package b2
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy determines how requests that fail with a retryable error are
+// retried. B2 considers 408, 429, 500, and 503 responses (as well as network
+// errors) to be retryable.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is sent,
+	// including the first attempt. A value of 1 disables retries.
+	MaxAttempts int
+
+	// InitialBackoff is the amount of time to wait before the first retry,
+	// which doubles after each subsequent attempt.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum amount of time to wait between attempts.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction (between 0 and 1) of each backoff that is
+	// randomized, to avoid multiple clients retrying at the same time.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used by any Service that hasn't been configured with
+// WithRetryPolicy, and follows the backoff recommended by B2's integration
+// guidelines.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: time.Second,
+	MaxBackoff:     64 * time.Second,
+	Jitter:         0.5,
+}
+
+// WithRetryPolicy sets the policy used for retrying failed requests made by
+// the Service.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(b2Service *Service) {
+		b2Service.RetryPolicy = &policy
+	}
+}
+
+// retryPolicy returns the RetryPolicy that should be used for requests made
+// by the Service.
+func (b2Service *Service) retryPolicy() RetryPolicy {
+	if b2Service == nil || b2Service.RetryPolicy == nil {
+		return DefaultRetryPolicy
+	}
+
+	return *b2Service.RetryPolicy
+}
+
+// backoff returns the amount of time to wait after a failed attempt. The
+// "Retry-After" header is used instead if it was included in the response.
+func (policy RetryPolicy) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+		if err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	delay := policy.InitialBackoff
+	for i := 1; i < attempt && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+
+	if policy.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * policy.Jitter * float64(delay))
+	}
+
+	return delay
+}
+
+// isRetryable reports whether a request should be retried, based on the
+// response or error returned from sending it.
+func isRetryable(req *http.Request, res *http.Response, err error) bool {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return false
+		}
+
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		var netErr net.Error
+		return errors.As(err, &netErr) ||
+			errors.Is(err, io.EOF) ||
+			errors.Is(err, io.ErrUnexpectedEOF)
+	}
+
+	switch res.StatusCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusServiceUnavailable:
+		return true
+	}
+
+	return false
+}
+
+// do sends a request using the Service's http.Client, retrying it according
+// to the Service's RetryPolicy. If the account's authorization token has
+// expired, the account is reauthorized and the request is sent again.
+func (b2Service *Service) do(req *http.Request) (*http.Response, error) {
+	return b2Service.doUpload(req, nil)
+}
+
+// doUpload is the same as do, but calls `refresh` before each retry to fetch
+// a new URL and authorization token for the request. B2 requires a new
+// upload URL to be used after an upload fails, or once the upload URL's
+// authorization token has expired.
+func (b2Service *Service) doUpload(
+	req *http.Request,
+	refresh func(ctx context.Context) (string, string, error),
+) (*http.Response, error) {
+	ctx := req.Context()
+	policy := b2Service.retryPolicy()
+	reauthorized := false
+
+	for attempt := 1; ; attempt++ {
+		res, err := b2Service.httpClient().Do(req)
+
+		// Requests can only be sent again if the body can be read again
+		if req.Body != nil && req.GetBody == nil {
+			return res, err
+		}
+
+		// Expired tokens are only replaced once per request, and don't
+		// count as a failed attempt
+		if !reauthorized && isExpiredToken(res) &&
+			(refresh != nil || b2Service.canReauthorize(req)) {
+			reauthorized = true
+			_ = res.Body.Close()
+
+			if refresh == nil {
+				err = b2Service.reauthorize(
+					ctx, req.Header.Get("Authorization"))
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			req, err = b2Service.nextRequest(req, refresh, true)
+			if err != nil {
+				return nil, err
+			}
+
+			attempt -= 1
+			continue
+		}
+
+		if attempt >= policy.MaxAttempts || !isRetryable(req, res, err) {
+			return res, err
+		}
+
+		delay := policy.backoff(attempt, res)
+		if res != nil {
+			_, _ = io.Copy(io.Discard, res.Body)
+			_ = res.Body.Close()
+			b2Service.Logf("B2Error %s %s -- status %d, retrying in %v\n",
+				req.Method, req.URL, res.StatusCode, delay)
+		} else {
+			b2Service.Logf("B2Error %s %s -- %v, retrying in %v\n",
+				req.Method, req.URL, err, delay)
+		}
+
+		if err = sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		req, err = b2Service.nextRequest(req, refresh, reauthorized)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// nextRequest copies a request so that it can be sent again, rewinding the
+// request body. Uploads are sent to a new upload URL fetched with `refresh`,
+// and requests sent after reauthorizing use the account's new
+// authorization token and API URL.
+func (b2Service *Service) nextRequest(
+	req *http.Request,
+	refresh func(ctx context.Context) (string, string, error),
+	reauthorized bool,
+) (*http.Request, error) {
+	var err error
+	ctx := req.Context()
+
+	next := req.Clone(ctx)
+	if req.GetBody != nil {
+		next.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if refresh != nil {
+		uploadURL, token, err := refresh(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		next.URL, err = url.Parse(uploadURL)
+		if err != nil {
+			return nil, err
+		}
+
+		next.Host = next.URL.Host
+		next.Header.Set("Authorization", token)
+	} else if reauthorized {
+		next.URL, err = b2Service.rebaseURL(next.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		next.Host = next.URL.Host
+		next.Header.Set("Authorization", b2Service.token())
+	}
+
+	return next, nil
+}
+
+// sleepContext waits for the specified duration, or until the context is
+// done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
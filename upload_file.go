@@ -2,38 +2,46 @@ package b2
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha1"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/benbusby/b2/utils"
+	"hash"
+	"io"
+	"mime"
 	"net/http"
-	"net/http/httputil"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const APIGetUploadURL string = "b2_get_upload_url"
+const APIUploadFile string = "b2_upload_file"
 
 // File represents the data returned by UploadFile
 type File struct {
-	AccountID     string `json:"accountId"`
-	Action        string `json:"action"`
-	BucketID      string `json:"bucketId"`
-	ContentLength int64  `json:"contentLength"`
-	ContentMd5    string `json:"contentMd5"`
-	ContentSha1   string `json:"contentSha1"`
-	ContentType   string `json:"contentType"`
-	FileID        string `json:"fileId"`
-	FileInfo      struct {
-	} `json:"fileInfo"`
-	FileName      string `json:"fileName"`
+	AccountID     string            `json:"accountId"`
+	Action        string            `json:"action"`
+	BucketID      string            `json:"bucketId"`
+	ContentLength int64             `json:"contentLength"`
+	ContentMd5    string            `json:"contentMd5"`
+	ContentSha1   string            `json:"contentSha1"`
+	ContentType   string            `json:"contentType"`
+	FileID        string            `json:"fileId"`
+	FileInfo      map[string]string `json:"fileInfo"`
+	FileName      string            `json:"fileName"`
 	FileRetention struct {
-		IsClientAuthorizedToRead bool `json:"isClientAuthorizedToRead"`
-		Value                    any  `json:"value"`
+		IsClientAuthorizedToRead bool          `json:"isClientAuthorizedToRead"`
+		Value                    FileRetention `json:"value"`
 	} `json:"fileRetention"`
 	LegalHold struct {
-		IsClientAuthorizedToRead bool `json:"isClientAuthorizedToRead"`
-		Value                    any  `json:"value"`
+		IsClientAuthorizedToRead bool   `json:"isClientAuthorizedToRead"`
+		Value                    string `json:"value"`
 	} `json:"legalHold"`
 	ServerSideEncryption struct {
 		Algorithm string `json:"algorithm"`
@@ -49,47 +57,66 @@ type FileInfo struct {
 	AuthorizationToken string `json:"authorizationToken"`
 	Dummy              bool
 	StorageMaximum     int64
+
+	// service is the Service that requested the upload URL, and is used for
+	// making the upload request.
+	service *Service
 }
 
 // GetUploadURL returns a FileInfo struct containing the URL to use
 // for uploading a file, the ID of the bucket the file will be put
 // in, and a token for authenticating the upload request.
 func (b2Service *Service) GetUploadURL(bucketID string) (FileInfo, error) {
+	return b2Service.GetUploadURLContext(context.Background(), bucketID)
+}
+
+// GetUploadURLContext is the same as GetUploadURL, but uses the provided
+// context for the request.
+func (b2Service *Service) GetUploadURLContext(
+	ctx context.Context,
+	bucketID string,
+) (FileInfo, error) {
 	if b2Service.Dummy {
+		_, err := b2Service.checkLocalKeyBucket(
+			APIGetUploadURL, "writeFiles", bucketID)
+		if err != nil {
+			return FileInfo{}, err
+		}
+
 		return FileInfo{
+			BucketID:       bucketID,
 			UploadURL:      b2Service.LocalPath,
 			StorageMaximum: b2Service.StorageMaximum,
 			Dummy:          true,
+			service:        b2Service,
 		}, nil
 	}
 
 	reqURL := utils.FormatB2URL(
-		b2Service.APIURL, b2Service.APIVersion, APIGetUploadURL)
-
-	req, err := http.NewRequest("GET", reqURL, nil)
-
-	q := req.URL.Query()
-	q.Add("bucketId", bucketID)
-	req.URL.RawQuery = q.Encode()
+		b2Service.apiURL(), b2Service.APIVersion, APIGetUploadURL)
 
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
 		b2Service.Logf("B2Error creating new HTTP request: %v\n", err)
 		return FileInfo{}, err
 	}
 
+	q := req.URL.Query()
+	q.Add("bucketId", bucketID)
+	req.URL.RawQuery = q.Encode()
+
 	req.Header = http.Header{
 		"Content-Type":  {"application/json"},
-		"Authorization": {b2Service.AuthorizationToken},
+		"Authorization": {b2Service.token()},
 	}
 
-	res, err := utils.Client.Do(req)
+	res, err := b2Service.do(req)
 	if err != nil {
 		b2Service.Logf("B2Error requesting B2 upload URL: %v\n", err)
 		return FileInfo{}, err
 	} else if res.StatusCode >= 400 {
 		b2Service.Logf("\n%s %s\n", "GET", reqURL)
-		resp, _ := httputil.DumpResponse(res, true)
-		return FileInfo{}, utils.NewB2Error(nil, string(resp))
+		return FileInfo{}, b2Service.apiError(res, APIGetUploadURL)
 	}
 
 	var upload FileInfo
@@ -99,9 +126,67 @@ func (b2Service *Service) GetUploadURL(bucketID string) (FileInfo, error) {
 		return FileInfo{}, err
 	}
 
+	upload.service = b2Service
+
 	return upload, nil
 }
 
+// Keys of file info values that B2 treats specially. The "b2-" values are
+// returned as the matching HTTP header when the file is downloaded.
+const (
+	FileInfoLastModified       = "src_last_modified_millis"
+	FileInfoLargeFileSha1      = "large_file_sha1"
+	FileInfoContentDisposition = "b2-content-disposition"
+	FileInfoContentLanguage    = "b2-content-language"
+	FileInfoExpires            = "b2-expires"
+	FileInfoCacheControl       = "b2-cache-control"
+	FileInfoContentEncoding    = "b2-content-encoding"
+)
+
+// ContentTypeAuto tells B2 to choose the content type of a file based on the
+// extension of its name.
+const ContentTypeAuto = "b2/x-auto"
+
+// maxFileInfoCount is the maximum number of file info values B2 allows per file
+const maxFileInfoCount = 10
+
+// UploadOptions contains optional settings for uploading a file with
+// UploadFileFromReader, or starting a large file with
+// StartLargeFileWithOptions.
+type UploadOptions struct {
+	// ContentType is the MIME type of the file. Defaults to
+	// "application/octet-stream" for files, and ContentTypeAuto for large
+	// files.
+	ContentType string
+
+	// Checksum is the hex-encoded SHA1 checksum of the file contents. If
+	// left empty, the checksum is calculated while the contents are being
+	// uploaded and appended to the end of the request body. For large files,
+	// the checksum of the entire file is stored as the FileInfoLargeFileSha1
+	// file info value.
+	Checksum string
+
+	// FileInfo contains up to 10 custom values stored with the file, such as
+	// FileInfoLastModified or FileInfoContentDisposition. Values are returned
+	// as "X-Bz-Info-*" headers when the file is downloaded.
+	FileInfo map[string]string
+
+	// Encryption sets the server-side encryption used for storing the file
+	// in B2. Defaults to the bucket's default encryption. Files encrypted
+	// with SSEModeC can only be downloaded or copied with the same key.
+	Encryption *ServerSideEncryption
+
+	// Retention sets the Object Lock retention of the file, which prevents
+	// it from being deleted until the retention expires. Requires a bucket
+	// with Object Lock enabled.
+	Retention *FileRetention
+
+	// LegalHold is either LegalHoldOn or LegalHoldOff, and prevents the file
+	// from being deleted while it's on. Requires a bucket with Object Lock
+	// enabled.
+	LegalHold string
+}
+
 // UploadFile uploads file byte content to B2 alongside a name for the file
 // and a SHA1 checksum for the byte content. It returns a File object, which
 // contains fields such as FileID and ContentLength which can be stored and
@@ -111,34 +196,137 @@ func UploadFile(
 	filename string,
 	checksum string,
 	contents []byte,
+) (File, error) {
+	return UploadFileContext(
+		context.Background(), b2Info, filename, checksum, contents)
+}
+
+// UploadFileContext is the same as UploadFile, but uses the provided context
+// for the upload request.
+func UploadFileContext(
+	ctx context.Context,
+	b2Info FileInfo,
+	filename string,
+	checksum string,
+	contents []byte,
+) (File, error) {
+	return UploadFileFromReaderContext(
+		ctx,
+		b2Info,
+		filename,
+		bytes.NewReader(contents),
+		int64(len(contents)),
+		UploadOptions{Checksum: checksum})
+}
+
+// UploadFileFromReader uploads `size` bytes read from `r` to B2, without
+// needing to hold the full file contents in memory. Unless a checksum is
+// provided in `opts`, the SHA1 checksum of the contents is calculated while
+// uploading and sent at the end of the request using B2's
+// "hex_digits_at_end" checksum mode.
+//
+// Failed uploads are retried with a new upload URL according to the
+// RetryPolicy of the Service that provided `b2Info`, but only if `r` is an
+// io.Seeker that can be rewound to re-read the contents.
+func UploadFileFromReader(
+	b2Info FileInfo,
+	filename string,
+	r io.Reader,
+	size int64,
+	opts UploadOptions,
+) (File, error) {
+	return UploadFileFromReaderContext(
+		context.Background(), b2Info, filename, r, size, opts)
+}
+
+// UploadFileFromReaderContext is the same as UploadFileFromReader, but uses
+// the provided context for the upload request.
+func UploadFileFromReaderContext(
+	ctx context.Context,
+	b2Info FileInfo,
+	filename string,
+	r io.Reader,
+	size int64,
+	opts UploadOptions,
 ) (File, error) {
 	if b2Info.Dummy {
-		return uploadLocalFile(b2Info, filename, contents)
+		file, err := uploadLocalFile(ctx, b2Info, filename, r, size, opts)
+		if err == nil {
+			b2Info.service.notifyLocalEvent(ctx,
+				b2Info.UploadURL, file.event(EventObjectCreatedUpload))
+		}
+
+		return file, err
+	}
+
+	if len(opts.ContentType) == 0 {
+		opts.ContentType = "application/octet-stream"
+	}
+
+	checksum := opts.Checksum
+	contentLength := size
+	if len(checksum) == 0 {
+		checksum = "hex_digits_at_end"
+		contentLength += sha1.Size * 2
+	}
+
+	newBody := func() io.Reader {
+		if len(opts.Checksum) > 0 {
+			return r
+		}
+
+		h := sha1.New()
+		return io.MultiReader(
+			io.TeeReader(io.LimitReader(r, size), h),
+			&checksumSuffixReader{hash: h})
 	}
 
-	req, err := http.NewRequest(
-		"POST",
-		b2Info.UploadURL,
-		bytes.NewBuffer(contents))
+	req, err := http.NewRequestWithContext(
+		ctx, "POST", b2Info.UploadURL, newBody())
 	if err != nil {
 		return File{}, err
 	}
 
+	req.GetBody = nil
+	if seeker, ok := r.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				_, err := seeker.Seek(start, io.SeekStart)
+				if err != nil {
+					return nil, err
+				}
+
+				return io.NopCloser(newBody()), nil
+			}
+		}
+	}
+
+	req.ContentLength = contentLength
 	req.Header = http.Header{
 		"Authorization":     {b2Info.AuthorizationToken},
-		"Content-Type":      {"application/octet-stream"},
-		"Content-Length":    {strconv.Itoa(len(contents))},
-		"X-Bz-File-Name":    {filename},
+		"Content-Type":      {opts.ContentType},
+		"Content-Length":    {strconv.FormatInt(contentLength, 10)},
+		"X-Bz-File-Name":    {escapeB2Value(filename)},
 		"X-Bz-Content-Sha1": {checksum},
 	}
 
-	res, err := utils.Client.Do(req)
+	for key, value := range opts.FileInfo {
+		req.Header.Set("X-Bz-Info-"+key, escapeB2Value(value))
+	}
+
+	opts.Encryption.setUploadHeaders(req.Header)
+	opts.Retention.setHeaders(req.Header)
+	if len(opts.LegalHold) > 0 {
+		req.Header.Set("X-Bz-File-Legal-Hold", opts.LegalHold)
+	}
+
+	res, err := b2Info.service.doUpload(req, b2Info.refresh)
 
 	if err != nil {
 		return File{}, err
 	} else if res.StatusCode >= 400 {
-		resp, _ := httputil.DumpResponse(res, true)
-		return File{}, utils.NewB2Error(nil, string(resp))
+		return File{}, b2Info.service.apiError(res, APIUploadFile)
 	}
 
 	var b2File File
@@ -150,15 +338,78 @@ func UploadFile(
 	return b2File, nil
 }
 
+// refresh fetches a new upload URL and authorization token for the bucket,
+// which is used for retrying a failed upload. If the FileInfo wasn't returned
+// by GetUploadURL, the same URL is reused.
+func (b2Info FileInfo) refresh(ctx context.Context) (string, string, error) {
+	if b2Info.service == nil {
+		return b2Info.UploadURL, b2Info.AuthorizationToken, nil
+	}
+
+	info, err := b2Info.service.GetUploadURLContext(ctx, b2Info.BucketID)
+	return info.UploadURL, info.AuthorizationToken, err
+}
+
+// checksumSuffixReader writes the hex-encoded sum of a hash once it's read
+// from, and is used after the content being hashed has been fully read.
+type checksumSuffixReader struct {
+	hash   hash.Hash
+	suffix io.Reader
+}
+
+func (c *checksumSuffixReader) Read(p []byte) (int, error) {
+	if c.suffix == nil {
+		c.suffix = strings.NewReader(fmt.Sprintf("%x", c.hash.Sum(nil)))
+	}
+
+	return c.suffix.Read(p)
+}
+
 // uploadLocalFile skips the usual uploading to a B2 bucket and instead
-// writes the file to a path specified in b2Info.UploadURL
+// writes the file to a path specified in b2Info.UploadURL. If the upload info
+// was fetched for a bucket created by the dummy account, the file is written
+// to that bucket's subdirectory.
 func uploadLocalFile(
+	ctx context.Context,
 	b2Info FileInfo,
 	filename string,
-	contents []byte,
+	r io.Reader,
+	size int64,
+	opts UploadOptions,
 ) (File, error) {
+	if err := ctx.Err(); err != nil {
+		return File{}, err
+	} else if err = validateFileInfo(opts.FileInfo, APIUploadFile); err != nil {
+		return File{}, err
+	} else if err = opts.Encryption.validate(APIUploadFile); err != nil {
+		return File{}, err
+	} else if err = opts.Retention.validate(APIUploadFile, time.Now()); err != nil {
+		return File{}, err
+	} else if err = validateLegalHold(opts.LegalHold, APIUploadFile); err != nil {
+		return File{}, err
+	} else if err = b2Info.service.checkLocalKeyFile(
+		APIUploadFile, "writeFiles", b2Info.BucketID, filename); err != nil {
+		return File{}, err
+	}
+
+	// Dummy accounts only keep one version of each file, so a locked file
+	// can't be replaced by a new version like it would be in B2
+	id := localFileID(b2Info.UploadURL, b2Info.BucketID, filename)
+	err := checkLocalFileName(b2Info.UploadURL, id, APIUploadFile)
+	if err != nil {
+		return File{}, err
+	} else if err = checkLocalFileLock(
+		b2Info.UploadURL, id, false, APIUploadFile); err != nil {
+		return File{}, err
+	}
+
+	path := fmt.Sprintf("%s/%s", strings.TrimSuffix(b2Info.UploadURL, "/"), id)
+	// Names containing "/" are stored in subdirectories, which are created as
+	// needed in the same way that B2 treats them as virtual folders
 	if _, err := os.Stat(b2Info.UploadURL); err != nil {
 		return File{}, err
+	} else if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return File{}, err
 	}
 
 	if b2Info.StorageMaximum > 0 {
@@ -167,29 +418,240 @@ func uploadLocalFile(
 			return File{}, err
 		}
 
-		if dirSize+int64(len(contents)) > int64(b2Info.StorageMaximum) {
+		if dirSize+size > b2Info.StorageMaximum {
 			return File{}, utils.StorageError
 		}
 	}
 
-	path := fmt.Sprintf("%s/%s",
-		strings.TrimSuffix(b2Info.UploadURL, "/"),
-		filename)
-
-	file, err := os.Create(path)
+	// The contents are written to a temporary file until they've been
+	// checked, so that a failed upload doesn't replace an existing file
+	file, err := createLocalTempFile(b2Info.UploadURL)
 	if err != nil {
 		return File{}, err
 	}
 
-	_, err = file.Write(contents)
+	defer func(f *os.File) {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}(file)
+
+	// Files encrypted with a customer key are encrypted at rest, so that
+	// reading them without the same key fails like it would in B2
+	var w io.Writer = file
+	encryption := newLocalEncryption(opts.Encryption)
+	if encryption.isCustomerKey() {
+		var iv []byte
+		if w, iv, err = newLocalCipherWriter(file, opts.Encryption); err != nil {
+			return File{}, err
+		}
+
+		encryption.Segments = []localCipherSegment{{Offset: 0, IV: iv}}
+	}
+
+	h := sha1.New()
+	written, err := io.Copy(
+		io.MultiWriter(w, h),
+		utils.NewContextReader(ctx, io.LimitReader(r, size)))
+	if err == nil && written != size {
+		err = fmt.Errorf("%w: expected %d bytes, received %d",
+			io.ErrUnexpectedEOF, size, written)
+	}
+
+	checksum := fmt.Sprintf("%x", h.Sum(nil))
+	if err == nil && len(opts.Checksum) > 0 && opts.Checksum != checksum {
+		err = localError(http.StatusBadRequest, "bad_request", APIUploadFile,
+			"checksum did not match data received for %s", filename)
+	}
+
 	if err != nil {
 		return File{}, err
+	} else if err = file.Close(); err != nil {
+		return File{}, err
+	} else if err = os.Rename(file.Name(), path); err != nil {
+		return File{}, err
+	}
+
+	metadata := newLocalFileMetadata(filename, opts.ContentType, opts.FileInfo)
+	metadata.ContentSha1 = checksum
+	metadata.Encryption = encryption
+	metadata.setLock(opts.Retention, opts.LegalHold)
+	if err = writeLocalFileMetadata(b2Info.UploadURL, id, metadata); err != nil {
+		return File{}, err
 	}
 
-	return File{
-		FileID:        filename,
-		BucketID:      filename,
+	// Uploading a new version of a hidden file makes it visible again
+	if _, err = unhideLocalFile(b2Info.UploadURL, id); err != nil {
+		return File{}, err
+	}
+
+	b2File := File{
+		Action:        ActionUpload,
+		FileID:        id,
+		BucketID:      b2Info.BucketID,
 		FileName:      filename,
-		ContentLength: int64(len(contents)),
-	}, nil
+		ContentLength: written,
+		ContentSha1:   metadata.ContentSha1,
+		ContentType:   metadata.ContentType,
+		FileInfo:      metadata.FileInfo,
+	}
+
+	b2File.ServerSideEncryption, b2File.FileRetention, b2File.LegalHold =
+		metadata.fileFields()
+	return b2File, nil
+}
+
+// validateFileInfo checks the number of file info values and their names
+func validateFileInfo(fileInfo map[string]string, endpoint string) error {
+	if len(fileInfo) > maxFileInfoCount {
+		return localError(http.StatusBadRequest, "bad_request", endpoint,
+			"too many file info values: %d (max %d)",
+			len(fileInfo), maxFileInfoCount)
+	}
+
+	for key := range fileInfo {
+		valid := len(key) > 0 && len(key) <= 50
+		for _, c := range key {
+			valid = valid && (c == '-' || c == '_' || c == '.' ||
+				('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') ||
+				('0' <= c && c <= '9'))
+		}
+
+		if !valid {
+			return localError(http.StatusBadRequest, "bad_request", endpoint,
+				"invalid file info name: %q", key)
+		}
+	}
+
+	return nil
+}
+
+// localFileMetadata is the metadata stored alongside a dummy account's file,
+// which B2 would otherwise store with the file itself. The checksum is stored
+// as well, since it can't be calculated from a file encrypted with a customer
+// key unless the key is provided.
+type localFileMetadata struct {
+	ContentType string            `json:"contentType"`
+	ContentSha1 string            `json:"contentSha1,omitempty"`
+	FileInfo    map[string]string `json:"fileInfo"`
+	Encryption  *localEncryption  `json:"serverSideEncryption,omitempty"`
+	Retention   *FileRetention    `json:"fileRetention,omitempty"`
+	LegalHold   string            `json:"legalHold,omitempty"`
+}
+
+// newLocalFileMetadata creates the metadata for a new dummy account file,
+// using the same content type defaults as B2.
+func newLocalFileMetadata(
+	filename string,
+	contentType string,
+	fileInfo map[string]string,
+) localFileMetadata {
+	if contentType == ContentTypeAuto {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+
+	metadata := localFileMetadata{
+		ContentType: contentType,
+		FileInfo:    map[string]string{},
+	}
+
+	// B2 treats file info names as case-insensitive, and returns them in
+	// lowercase
+	for key, value := range fileInfo {
+		metadata.FileInfo[strings.ToLower(key)] = value
+	}
+
+	return metadata
+}
+
+// fileEncryptionField, fileRetentionField, and fileLegalHoldField are the
+// forms that B2 returns a file's encryption, retention, and legal hold in.
+type fileEncryptionField = struct {
+	Algorithm string `json:"algorithm"`
+	Mode      string `json:"mode"`
+}
+
+type fileRetentionField = struct {
+	IsClientAuthorizedToRead bool          `json:"isClientAuthorizedToRead"`
+	Value                    FileRetention `json:"value"`
+}
+
+type fileLegalHoldField = struct {
+	IsClientAuthorizedToRead bool   `json:"isClientAuthorizedToRead"`
+	Value                    string `json:"value"`
+}
+
+// fileFields returns the encryption, retention, and legal hold of a dummy
+// account's file, in the same form as B2 returns them.
+func (metadata localFileMetadata) fileFields() (
+	encryption fileEncryptionField,
+	retention fileRetentionField,
+	legalHold fileLegalHoldField,
+) {
+	encryption.Algorithm = metadata.Encryption.algorithm()
+	encryption.Mode = metadata.Encryption.mode()
+	retention.IsClientAuthorizedToRead = true
+	retention.Value = metadata.retention()
+	legalHold.IsClientAuthorizedToRead = true
+	legalHold.Value = metadata.LegalHold
+	return encryption, retention, legalHold
+}
+
+// localFileMetadataPath returns the path to the metadata stored alongside a
+// dummy account's file.
+func localFileMetadataPath(root string, id string) string {
+	return localMetadataPath(root, "info", url.PathEscape(id)+".json")
+}
+
+// createLocalTempFile creates a temporary file in a dummy account's metadata
+// directory. Since it's within LocalPath, it can be renamed into place once
+// it's complete.
+func createLocalTempFile(root string) (*os.File, error) {
+	dir := localMetadataPath(root, "tmp")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return os.CreateTemp(dir, "")
+}
+
+// readLocalFileMetadata reads the metadata stored alongside a dummy account's
+// file. Files without any stored metadata use the defaults for a file
+// uploaded without any options.
+func readLocalFileMetadata(root string, id string) (localFileMetadata, error) {
+	var metadata localFileMetadata
+	err := utils.ReadJSONFile(localFileMetadataPath(root, id), &metadata)
+	if errors.Is(err, os.ErrNotExist) {
+		_, filename := splitLocalFileID(root, id)
+		return newLocalFileMetadata(filename, "", nil), nil
+	} else if err != nil {
+		return localFileMetadata{}, err
+	} else if metadata.FileInfo == nil {
+		metadata.FileInfo = map[string]string{}
+	}
+
+	return metadata, nil
+}
+
+// writeLocalFileMetadata stores metadata alongside a dummy account's file.
+func writeLocalFileMetadata(
+	root string,
+	id string,
+	metadata localFileMetadata,
+) error {
+	return utils.WriteJSONFile(localFileMetadataPath(root, id), metadata)
+}
+
+// removeLocalFileMetadata removes the metadata stored alongside a deleted
+// dummy account file.
+func removeLocalFileMetadata(root string, id string) error {
+	err := os.Remove(localFileMetadataPath(root, id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
 }
@@ -2,43 +2,47 @@ package b2
 
 import (
 	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/sha1"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/benbusby/b2/utils"
+	"io"
 	"net/http"
-	"net/http/httputil"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const APIStartLargeFile string = "b2_start_large_file"
 const APIGetUploadPartURL string = "b2_get_upload_part_url"
+const APIUploadPart string = "b2_upload_part"
 const APIFinishLargeFile = "b2_finish_large_file"
 const APICancelLargeFile = "b2_cancel_large_file"
 
 // StartFile represents the data returned by StartLargeFile
 type StartFile struct {
-	AccountID     string `json:"accountId"`
-	Action        string `json:"action"`
-	BucketID      string `json:"bucketId"`
-	ContentLength int64  `json:"contentLength"`
-	ContentSha1   string `json:"contentSha1"`
-	ContentType   string `json:"contentType"`
-	FileID        string `json:"fileId"`
-	FileInfo      struct {
-	} `json:"fileInfo"`
-	FileName      string `json:"fileName"`
+	AccountID     string            `json:"accountId"`
+	Action        string            `json:"action"`
+	BucketID      string            `json:"bucketId"`
+	ContentLength int64             `json:"contentLength"`
+	ContentSha1   string            `json:"contentSha1"`
+	ContentType   string            `json:"contentType"`
+	FileID        string            `json:"fileId"`
+	FileInfo      map[string]string `json:"fileInfo"`
+	FileName      string            `json:"fileName"`
 	FileRetention struct {
-		IsClientAuthorizedToRead bool `json:"isClientAuthorizedToRead"`
-		Value                    struct {
-			Mode                 any `json:"mode"`
-			RetainUntilTimestamp any `json:"retainUntilTimestamp"`
-		} `json:"value"`
+		IsClientAuthorizedToRead bool          `json:"isClientAuthorizedToRead"`
+		Value                    FileRetention `json:"value"`
 	} `json:"fileRetention"`
 	LegalHold struct {
-		IsClientAuthorizedToRead bool `json:"isClientAuthorizedToRead"`
-		Value                    any  `json:"value"`
+		IsClientAuthorizedToRead bool   `json:"isClientAuthorizedToRead"`
+		Value                    string `json:"value"`
 	} `json:"legalHold"`
 	ServerSideEncryption struct {
 		Algorithm any `json:"algorithm"`
@@ -54,28 +58,31 @@ type FilePartInfo struct {
 	AuthorizationToken string `json:"authorizationToken"`
 	Dummy              bool
 	StorageMaximum     int64
+
+	// service is the Service that requested the upload part URL, and is
+	// used for making the upload request.
+	service *Service
 }
 
 // LargeFile represents the file object created by FinishLargeFile
 type LargeFile struct {
-	AccountID     string `json:"accountId"`
-	Action        string `json:"action"`
-	BucketID      string `json:"bucketId"`
-	ContentLength int64  `json:"contentLength"`
-	ContentMd5    any    `json:"contentMd5"`
-	ContentSha1   string `json:"contentSha1"`
-	ContentType   string `json:"contentType"`
-	FileID        string `json:"fileId"`
-	FileInfo      struct {
-	} `json:"fileInfo"`
-	FileName      string `json:"fileName"`
+	AccountID     string            `json:"accountId"`
+	Action        string            `json:"action"`
+	BucketID      string            `json:"bucketId"`
+	ContentLength int64             `json:"contentLength"`
+	ContentMd5    any               `json:"contentMd5"`
+	ContentSha1   string            `json:"contentSha1"`
+	ContentType   string            `json:"contentType"`
+	FileID        string            `json:"fileId"`
+	FileInfo      map[string]string `json:"fileInfo"`
+	FileName      string            `json:"fileName"`
 	FileRetention struct {
-		IsClientAuthorizedToRead bool `json:"isClientAuthorizedToRead"`
-		Value                    any  `json:"value"`
+		IsClientAuthorizedToRead bool          `json:"isClientAuthorizedToRead"`
+		Value                    FileRetention `json:"value"`
 	} `json:"fileRetention"`
 	LegalHold struct {
-		IsClientAuthorizedToRead bool `json:"isClientAuthorizedToRead"`
-		Value                    any  `json:"value"`
+		IsClientAuthorizedToRead bool   `json:"isClientAuthorizedToRead"`
+		Value                    string `json:"value"`
 	} `json:"legalHold"`
 	ServerSideEncryption struct {
 		Algorithm string `json:"algorithm"`
@@ -90,89 +97,148 @@ func (b2Service *Service) StartLargeFile(
 	filename string,
 	bucketID string,
 ) (StartFile, error) {
-	if b2Service.Dummy {
-		return StartFile{FileID: filename, FileName: filename}, nil
-	}
+	return b2Service.StartLargeFileContext(
+		context.Background(), filename, bucketID)
+}
 
-	reqBody := bytes.NewBuffer([]byte(fmt.Sprintf(`{
-		"bucketId": "%s",
-		"fileName": "%s",
-		"contentType": "b2/x-auto"
-	}`, bucketID, filename)))
-	reqURL := utils.FormatB2URL(
-		b2Service.APIURL, b2Service.APIVersion, APIStartLargeFile)
+// StartLargeFileContext is the same as StartLargeFile, but uses the provided
+// context for the request.
+func (b2Service *Service) StartLargeFileContext(
+	ctx context.Context,
+	filename string,
+	bucketID string,
+) (StartFile, error) {
+	return b2Service.StartLargeFileWithOptionsContext(
+		ctx, filename, bucketID, UploadOptions{})
+}
 
-	req, err := http.NewRequest("POST", reqURL, reqBody)
-	if err != nil {
-		b2Service.Logf("B2Error creating new HTTP request: %v\n", err)
-		return StartFile{}, err
-	}
+// StartLargeFileWithOptions is the same as StartLargeFile, but allows setting
+// the content type, file info, and encryption of the finished file. If a
+// Checksum is provided, it's stored as the FileInfoLargeFileSha1 file info
+// value, since B2 doesn't calculate checksums for large files. Large files
+// encrypted with SSEModeC require the same key for uploading each part (see
+// UploadFilePartWithOptions).
+func (b2Service *Service) StartLargeFileWithOptions(
+	filename string,
+	bucketID string,
+	opts UploadOptions,
+) (StartFile, error) {
+	return b2Service.StartLargeFileWithOptionsContext(
+		context.Background(), filename, bucketID, opts)
+}
 
-	req.Header = http.Header{
-		"Content-Type":  {"application/json"},
-		"Authorization": {b2Service.AuthorizationToken},
+// startLargeFileRequest is the request body for b2_start_large_file
+type startLargeFileRequest struct {
+	BucketID    string            `json:"bucketId"`
+	FileName    string            `json:"fileName"`
+	ContentType string            `json:"contentType"`
+	FileInfo    map[string]string `json:"fileInfo,omitempty"`
+
+	ServerSideEncryption *sseRequest    `json:"serverSideEncryption,omitempty"`
+	FileRetention        *FileRetention `json:"fileRetention,omitempty"`
+	LegalHold            string         `json:"legalHold,omitempty"`
+}
+
+// StartLargeFileWithOptionsContext is the same as StartLargeFileWithOptions,
+// but uses the provided context for the request.
+func (b2Service *Service) StartLargeFileWithOptionsContext(
+	ctx context.Context,
+	filename string,
+	bucketID string,
+	opts UploadOptions,
+) (StartFile, error) {
+	if len(opts.ContentType) == 0 {
+		opts.ContentType = ContentTypeAuto
 	}
 
-	res, err := utils.Client.Do(req)
-	if err != nil {
-		b2Service.Logf("B2Error starting B2 file: %v\n", err)
-		return StartFile{}, err
-	} else if res.StatusCode >= 400 {
-		b2Service.Logf("\n%s %s\n", "POST", reqURL)
-		resp, _ := httputil.DumpResponse(res, true)
-		return StartFile{}, utils.NewB2Error(nil, string(resp))
+	fileInfo := opts.FileInfo
+	if len(opts.Checksum) > 0 {
+		fileInfo = map[string]string{FileInfoLargeFileSha1: opts.Checksum}
+		for key, value := range opts.FileInfo {
+			fileInfo[key] = value
+		}
 	}
 
-	var file StartFile
-	err = json.NewDecoder(res.Body).Decode(&file)
-	if err != nil {
-		b2Service.Logf("B2Error decoding B2 file init: %v", err)
-		return StartFile{}, err
+	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFile(
+			APIStartLargeFile, "writeFiles", bucketID, filename)
+		if err != nil {
+			return StartFile{}, err
+		}
+
+		return startLocalLargeFile(
+			ctx, b2Service.LocalPath, filename, bucketID, fileInfo, opts)
 	}
 
-	return file, nil
+	var file StartFile
+	err := b2Service.postJSON(ctx, APIStartLargeFile, startLargeFileRequest{
+		BucketID:    bucketID,
+		FileName:    filename,
+		ContentType: opts.ContentType,
+		FileInfo:    fileInfo,
+
+		ServerSideEncryption: opts.Encryption.request(),
+		FileRetention:        opts.Retention,
+		LegalHold:            opts.LegalHold,
+	}, &file)
+
+	return file, err
 }
 
 // GetUploadPartURL generates a URL and token for uploading individual chunks
 // of a file to B2. It requires a StartFile struct returned by StartLargeFile,
 // which contains the unique file ID for this new file.
 func (b2Service *Service) GetUploadPartURL(fileID string) (FilePartInfo, error) {
+	return b2Service.GetUploadPartURLContext(context.Background(), fileID)
+}
+
+// GetUploadPartURLContext is the same as GetUploadPartURL, but uses the
+// provided context for the request.
+func (b2Service *Service) GetUploadPartURLContext(
+	ctx context.Context,
+	fileID string,
+) (FilePartInfo, error) {
 	if b2Service.Dummy {
+		err := b2Service.checkLocalKeyFileID(
+			APIGetUploadPartURL, "writeFiles", fileID)
+		if err != nil {
+			return FilePartInfo{}, err
+		}
+
 		return FilePartInfo{
 			FileID:         fileID,
 			UploadURL:      b2Service.LocalPath,
 			Dummy:          true,
 			StorageMaximum: b2Service.StorageMaximum,
+			service:        b2Service,
 		}, nil
 	}
 
 	reqURL := utils.FormatB2URL(
-		b2Service.APIURL, b2Service.APIVersion, APIGetUploadPartURL)
-
-	req, err := http.NewRequest("GET", reqURL, nil)
-
-	q := req.URL.Query()
-	q.Add("fileId", fileID)
-	req.URL.RawQuery = q.Encode()
+		b2Service.apiURL(), b2Service.APIVersion, APIGetUploadPartURL)
 
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
 		b2Service.Logf("B2Error creating new HTTP request: %v\n", err)
 		return FilePartInfo{}, err
 	}
 
+	q := req.URL.Query()
+	q.Add("fileId", fileID)
+	req.URL.RawQuery = q.Encode()
+
 	req.Header = http.Header{
 		"Content-Type":  {"application/json"},
-		"Authorization": {b2Service.AuthorizationToken},
+		"Authorization": {b2Service.token()},
 	}
 
-	res, err := utils.Client.Do(req)
+	res, err := b2Service.do(req)
 	if err != nil {
 		b2Service.Logf("B2Error getting B2 upload url: %v\n", err)
 		return FilePartInfo{}, err
 	} else if res.StatusCode >= 400 {
 		b2Service.Logf("\n%s %s\n", "GET", reqURL)
-		resp, _ := httputil.DumpResponse(res, true)
-		return FilePartInfo{}, utils.NewB2Error(nil, string(resp))
+		return FilePartInfo{}, b2Service.apiError(res, APIGetUploadPartURL)
 	}
 
 	var upload FilePartInfo
@@ -182,6 +248,8 @@ func (b2Service *Service) GetUploadPartURL(fileID string) (FilePartInfo, error)
 		return FilePartInfo{}, err
 	}
 
+	upload.service = b2Service
+
 	return upload, nil
 }
 
@@ -194,12 +262,61 @@ func UploadFilePart(
 	chunkNum int,
 	checksum string,
 	contents []byte,
+) error {
+	return UploadFilePartContext(
+		context.Background(), b2PartInfo, chunkNum, checksum, contents)
+}
+
+// UploadFilePartContext is the same as UploadFilePart, but uses the provided
+// context for the upload request.
+func UploadFilePartContext(
+	ctx context.Context,
+	b2PartInfo FilePartInfo,
+	chunkNum int,
+	checksum string,
+	contents []byte,
+) error {
+	return UploadFilePartWithOptionsContext(
+		ctx, b2PartInfo, chunkNum, checksum, contents, PartOptions{})
+}
+
+// PartOptions contains optional settings for UploadFilePartWithOptions.
+type PartOptions struct {
+	// Encryption contains the customer key of the large file, if it was
+	// started with SSEModeC. It isn't needed for other large files.
+	Encryption *ServerSideEncryption
+}
+
+// UploadFilePartWithOptions is the same as UploadFilePart, but allows
+// uploading a part of a large file encrypted with a customer key.
+func UploadFilePartWithOptions(
+	b2PartInfo FilePartInfo,
+	chunkNum int,
+	checksum string,
+	contents []byte,
+	opts PartOptions,
+) error {
+	return UploadFilePartWithOptionsContext(
+		context.Background(), b2PartInfo, chunkNum, checksum, contents, opts)
+}
+
+// UploadFilePartWithOptionsContext is the same as UploadFilePartWithOptions,
+// but uses the provided context for the upload request.
+func UploadFilePartWithOptionsContext(
+	ctx context.Context,
+	b2PartInfo FilePartInfo,
+	chunkNum int,
+	checksum string,
+	contents []byte,
+	opts PartOptions,
 ) error {
 	if b2PartInfo.Dummy {
-		return uploadLocalFilePart(b2PartInfo, contents)
+		return uploadLocalFilePart(
+			ctx, b2PartInfo, chunkNum, checksum, contents, opts)
 	}
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
 		b2PartInfo.UploadURL,
 		bytes.NewBuffer(contents))
@@ -214,25 +331,56 @@ func UploadFilePart(
 		"X-Bz-Content-Sha1": {checksum},
 	}
 
-	res, err := utils.Client.Do(req)
+	opts.Encryption.setCustomerHeaders(req.Header)
+
+	res, err := b2PartInfo.service.doUpload(req, b2PartInfo.refresh)
 
 	if err != nil {
 		return err
 	} else if res.StatusCode >= 400 {
-		resp, _ := httputil.DumpResponse(res, true)
-		return utils.NewB2Error(nil, string(resp))
+		return b2PartInfo.service.apiError(res, APIUploadPart)
 	}
 
 	return nil
 }
 
+// refresh fetches a new upload part URL and authorization token for the
+// file, which is used for retrying a failed part upload. If the FilePartInfo
+// wasn't returned by GetUploadPartURL, the same URL is reused.
+func (b2PartInfo FilePartInfo) refresh(
+	ctx context.Context,
+) (string, string, error) {
+	if b2PartInfo.service == nil {
+		return b2PartInfo.UploadURL, b2PartInfo.AuthorizationToken, nil
+	}
+
+	info, err := b2PartInfo.service.GetUploadPartURLContext(
+		ctx, b2PartInfo.FileID)
+	return info.UploadURL, info.AuthorizationToken, err
+}
+
 // CancelLargeFile cancels an in-progress large file upload and deletes the
 // partial file from the B2 bucket. Returns true if the file was successfully
 // deleted, otherwise false.
 // Requires the fileID returned from StartLargeFile.
 func (b2Service *Service) CancelLargeFile(fileID string) (bool, error) {
+	return b2Service.CancelLargeFileContext(context.Background(), fileID)
+}
+
+// CancelLargeFileContext is the same as CancelLargeFile, but uses the
+// provided context for the request.
+func (b2Service *Service) CancelLargeFileContext(
+	ctx context.Context,
+	fileID string,
+) (bool, error) {
 	if b2Service.Dummy {
-		return cancelLocalLargeFile(fileID, b2Service.LocalPath)
+		err := b2Service.checkLocalKeyFileID(
+			APICancelLargeFile, "writeFiles", fileID)
+		if err != nil {
+			return false, err
+		}
+
+		return cancelLocalLargeFile(ctx, fileID, b2Service.LocalPath)
 	}
 
 	reqBody := bytes.NewBuffer([]byte(fmt.Sprintf(`{
@@ -240,27 +388,26 @@ func (b2Service *Service) CancelLargeFile(fileID string) (bool, error) {
 	}`, fileID)))
 
 	reqURL := utils.FormatB2URL(
-		b2Service.APIURL, b2Service.APIVersion, APICancelLargeFile)
+		b2Service.apiURL(), b2Service.APIVersion, APICancelLargeFile)
 
-	req, err := http.NewRequest("POST", reqURL, reqBody)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, reqBody)
 	if err != nil {
 		b2Service.Logf("B2Error creating new HTTP request: %v\n", err)
 		return false, err
 	}
 
 	req.Header = http.Header{
-		"Authorization": {b2Service.AuthorizationToken},
+		"Authorization": {b2Service.token()},
 	}
 
-	res, err := utils.Client.Do(req)
+	res, err := b2Service.do(req)
 
 	if err != nil {
 		b2Service.Logf("B2Error canceling B2 large file: %v\n", err)
 		return false, err
 	} else if res.StatusCode >= 400 {
 		b2Service.Logf("\n%s %s\n", "POST", reqURL)
-		resp, _ := httputil.DumpResponse(res, true)
-		return false, utils.NewB2Error(nil, string(resp))
+		return false, b2Service.apiError(res, APICancelLargeFile)
 	}
 
 	return true, nil
@@ -273,9 +420,39 @@ func (b2Service *Service) CancelLargeFile(fileID string) (bool, error) {
 func (b2Service *Service) FinishLargeFile(
 	fileID string,
 	checksums []string,
+) (LargeFile, error) {
+	return b2Service.FinishLargeFileContext(
+		context.Background(), fileID, checksums)
+}
+
+// FinishLargeFileContext is the same as FinishLargeFile, but uses the
+// provided context for the request.
+func (b2Service *Service) FinishLargeFileContext(
+	ctx context.Context,
+	fileID string,
+	checksums []string,
 ) (LargeFile, error) {
 	if b2Service.Dummy {
-		return finishLargeLocalFile(fileID, b2Service.LocalPath)
+		err := b2Service.checkLocalKeyFileID(
+			APIFinishLargeFile, "writeFiles", fileID)
+		if err != nil {
+			return LargeFile{}, err
+		}
+
+		largeFile, err := finishLargeLocalFile(
+			ctx, fileID, b2Service.LocalPath, checksums)
+		if err == nil {
+			b2Service.notifyLocalEvent(ctx, b2Service.LocalPath, Event{
+				EventType:     EventObjectCreatedMultipartUpload,
+				BucketID:      largeFile.BucketID,
+				FileID:        largeFile.FileID,
+				FileName:      largeFile.FileName,
+				ContentLength: largeFile.ContentLength,
+				ContentSha1:   largeFile.ContentSha1,
+			})
+		}
+
+		return largeFile, err
 	}
 
 	checksumsString := "[\"" + strings.Join(checksums, "\",\"") + "\"]"
@@ -286,9 +463,9 @@ func (b2Service *Service) FinishLargeFile(
 	}`, fileID, checksumsString)))
 
 	reqURL := utils.FormatB2URL(
-		b2Service.APIURL, b2Service.APIVersion, APIFinishLargeFile)
+		b2Service.apiURL(), b2Service.APIVersion, APIFinishLargeFile)
 
-	req, err := http.NewRequest("POST", reqURL, reqBody)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, reqBody)
 	if err != nil {
 		b2Service.Logf("B2Error creating new HTTP request: %v\n", err)
 		return LargeFile{}, err
@@ -296,18 +473,17 @@ func (b2Service *Service) FinishLargeFile(
 
 	req.Header = http.Header{
 		"Content-Type":  {"application/json"},
-		"Authorization": {b2Service.AuthorizationToken},
+		"Authorization": {b2Service.token()},
 	}
 
-	res, err := utils.Client.Do(req)
+	res, err := b2Service.do(req)
 
 	if err != nil {
 		b2Service.Logf("B2Error finishing B2 upload: %v\n", err)
 		return LargeFile{}, err
 	} else if res.StatusCode >= 400 {
 		b2Service.Logf("\n%s %s\n", "POST", reqURL)
-		resp, _ := httputil.DumpResponse(res, true)
-		return LargeFile{}, utils.NewB2Error(nil, string(resp))
+		return LargeFile{}, b2Service.apiError(res, APIFinishLargeFile)
 	}
 
 	var largeFile LargeFile
@@ -320,9 +496,107 @@ func (b2Service *Service) FinishLargeFile(
 	return largeFile, nil
 }
 
+// localPartsPath returns the directory used for storing the uploaded parts of
+// an unfinished large file for a dummy account.
+func localPartsPath(root string, id string) string {
+	return localMetadataPath(root, "parts", url.PathEscape(id))
+}
+
+// startLocalLargeFile prepares a dummy account for uploading the parts of a
+// large file. The parts directory is created up front so that unfinished
+// large files are included when listing file versions, and the file's
+// metadata is stored next to it until the large file is finished.
+func startLocalLargeFile(
+	ctx context.Context,
+	root string,
+	filename string,
+	bucketID string,
+	fileInfo map[string]string,
+	opts UploadOptions,
+) (StartFile, error) {
+	if err := ctx.Err(); err != nil {
+		return StartFile{}, err
+	} else if err = validateFileInfo(fileInfo, APIStartLargeFile); err != nil {
+		return StartFile{}, err
+	} else if err = opts.Encryption.validate(APIStartLargeFile); err != nil {
+		return StartFile{}, err
+	} else if err = opts.Retention.validate(APIStartLargeFile, time.Now()); err != nil {
+		return StartFile{}, err
+	} else if err = validateLegalHold(opts.LegalHold, APIStartLargeFile); err != nil {
+		return StartFile{}, err
+	}
+
+	id := localFileID(root, bucketID, filename)
+	if err := checkLocalFileName(root, id, APIStartLargeFile); err != nil {
+		return StartFile{}, err
+	}
+
+	partsPath := localPartsPath(root, id)
+	if err := os.MkdirAll(partsPath, 0755); err != nil {
+		return StartFile{}, err
+	}
+
+	metadata := newLocalFileMetadata(filename, opts.ContentType, fileInfo)
+	metadata.Encryption = newLocalEncryption(opts.Encryption)
+	metadata.setLock(opts.Retention, opts.LegalHold)
+	err := utils.WriteJSONFile(partsPath+".json", metadata)
+	if err != nil {
+		return StartFile{}, err
+	}
+
+	startFile := StartFile{
+		Action:      ActionStart,
+		BucketID:    bucketID,
+		ContentType: metadata.ContentType,
+		FileID:      id,
+		FileInfo:    metadata.FileInfo,
+		FileName:    filename,
+	}
+
+	// StartFile's encryption fields aren't strings, so they're set separately
+	encryption, retention, legalHold := metadata.fileFields()
+	startFile.ServerSideEncryption.Algorithm = encryption.Algorithm
+	startFile.ServerSideEncryption.Mode = encryption.Mode
+	startFile.FileRetention, startFile.LegalHold = retention, legalHold
+	return startFile, nil
+}
+
+// readLocalLargeFileMetadata reads the metadata stored for an unfinished large
+// file when it was started by a dummy account.
+func readLocalLargeFileMetadata(
+	root string,
+	id string,
+) (localFileMetadata, error) {
+	_, filename := splitLocalFileID(root, id)
+	metadata := newLocalFileMetadata(filename, ContentTypeAuto, nil)
+	err := utils.ReadJSONFile(localPartsPath(root, id)+".json", &metadata)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return localFileMetadata{}, err
+	}
+
+	return metadata, nil
+}
+
 // uploadLocalFilePart writes part of a file to the machine instead of to a B2
-// bucket
-func uploadLocalFilePart(info FilePartInfo, contents []byte) error {
+// bucket. Parts are stored separately until the large file is finished, so
+// that they can be uploaded in any order. Parts of a large file encrypted with
+// a customer key are encrypted with their own IV, which is stored at the start
+// of the part after the part's checksum.
+func uploadLocalFilePart(
+	ctx context.Context,
+	info FilePartInfo,
+	chunkNum int,
+	checksum string,
+	contents []byte,
+	opts PartOptions,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	} else if err = info.service.checkLocalKeyFileID(
+		APIUploadPart, "writeFiles", info.FileID); err != nil {
+		return err
+	}
+
 	if info.StorageMaximum > 0 {
 		dirSize, err := utils.CheckDirSize(info.UploadURL)
 		if err != nil {
@@ -330,7 +604,7 @@ func uploadLocalFilePart(info FilePartInfo, contents []byte) error {
 		}
 
 		if dirSize+int64(len(contents)) > int64(info.StorageMaximum) {
-			_, err = cancelLocalLargeFile(info.FileID, info.UploadURL)
+			_, err = cancelLocalLargeFile(ctx, info.FileID, info.UploadURL)
 			if err != nil {
 				return err
 			}
@@ -338,47 +612,222 @@ func uploadLocalFilePart(info FilePartInfo, contents []byte) error {
 		}
 	}
 
-	filename := fmt.Sprintf("%s/%s", strings.TrimSuffix(info.UploadURL, "/"), info.FileID)
-	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	sum := fmt.Sprintf("%x", sha1.Sum(contents))
+	if len(checksum) > 0 && checksum != sum {
+		return localError(http.StatusBadRequest, "bad_request", APIUploadPart,
+			"checksum did not match data received for part %d", chunkNum)
+	}
+
+	metadata, err := readLocalLargeFileMetadata(info.UploadURL, info.FileID)
 	if err != nil {
 		return err
 	}
 
+	err = metadata.Encryption.checkKey(opts.Encryption, APIUploadPart,
+		info.FileID)
+	if err != nil {
+		return err
+	}
+
+	partsPath := localPartsPath(info.UploadURL, info.FileID)
+	if err = os.MkdirAll(partsPath, 0755); err != nil {
+		return err
+	}
+
+	// The checksum is stored with the part, so that it can be compared with
+	// the checksums provided when the large file is finished
+	part := bytes.NewBufferString(sum)
+	if metadata.Encryption.isCustomerKey() {
+		w, iv, err := newLocalCipherWriter(part, opts.Encryption)
+		if err != nil {
+			return err
+		}
+
+		part.Write(iv)
+		if _, err = w.Write(contents); err != nil {
+			return err
+		}
+	} else {
+		part.Write(contents)
+	}
+
+	return os.WriteFile(
+		fmt.Sprintf("%s/%d", partsPath, chunkNum),
+		part.Bytes(),
+		0600)
+}
+
+// readLocalPartChecksum reads the checksum stored at the start of a part
+// uploaded to a dummy account.
+func readLocalPartChecksum(partsPath string, partNumber int) (string, error) {
+	part, err := os.Open(fmt.Sprintf("%s/%d", partsPath, partNumber))
+	if err != nil {
+		return "", err
+	}
+
 	defer func(f *os.File) {
 		_ = f.Close()
-	}(f)
+	}(part)
 
-	_, err = f.Write(contents)
-	if err != nil {
-		return err
+	checksum := make([]byte, sha1.Size*2)
+	if _, err = io.ReadFull(part, checksum); err != nil {
+		return "", err
 	}
 
-	return nil
+	return string(checksum), nil
 }
 
 // cancelLocalLargeFile cancels an in-progress large file being written to
-// disk by deleting it.
-func cancelLocalLargeFile(id string, path string) (bool, error) {
-	if len(id) == 0 {
+// disk by deleting any uploaded parts.
+func cancelLocalLargeFile(
+	ctx context.Context,
+	id string,
+	path string,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	} else if len(id) == 0 {
 		return false, nil
 	}
 
-	return deleteLocalFile(id, path)
+	partsPath := localPartsPath(path, id)
+	if _, err := os.Stat(partsPath); err != nil {
+		return false, localFileError(err, APICancelLargeFile, id)
+	}
+
+	err := os.Remove(partsPath + ".json")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	return true, os.RemoveAll(partsPath)
 }
 
 // finishLargeLocalFile completes the process of uploading a file chunk-by-chunk
-// to the local machine
-func finishLargeLocalFile(id string, path string) (LargeFile, error) {
+// to the local machine by combining each uploaded part, in order, into the
+// final file.
+func finishLargeLocalFile(
+	ctx context.Context,
+	id string,
+	path string,
+	checksums []string,
+) (LargeFile, error) {
+	if err := ctx.Err(); err != nil {
+		return LargeFile{}, err
+	} else if err = checkLocalFileName(path, id, APIFinishLargeFile); err != nil {
+		return LargeFile{}, err
+	}
+
+	partsPath := localPartsPath(path, id)
+	parts, err := os.ReadDir(partsPath)
+	if err != nil {
+		return LargeFile{}, localFileError(err, APIFinishLargeFile, id)
+	} else if len(parts) != len(checksums) {
+		return LargeFile{}, localError(http.StatusBadRequest, "bad_request",
+			APIFinishLargeFile, "expected %d parts, found %d",
+			len(checksums), len(parts))
+	}
+
+	// Like B2, each checksum has to match the part with the same number
+	for i, checksum := range checksums {
+		stored, err := readLocalPartChecksum(partsPath, i+1)
+		if err != nil {
+			return LargeFile{}, localFileError(err, APIFinishLargeFile, id)
+		} else if checksum != stored {
+			return LargeFile{}, localError(http.StatusBadRequest, "bad_request",
+				APIFinishLargeFile, "checksum for part %d does not match the "+
+					"uploaded part", i+1)
+		}
+	}
+
+	err = checkLocalFileLock(path, id, false, APIFinishLargeFile)
+	if err != nil {
+		return LargeFile{}, err
+	}
+
 	filePath := fmt.Sprintf("%s/%s", strings.TrimSuffix(path, "/"), id)
-	stat, err := os.Stat(filePath)
+	if err = os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return LargeFile{}, err
+	}
+
+	// The parts are combined in a temporary file, so that an existing file
+	// with the same name is only replaced once every part has been written
+	file, err := createLocalTempFile(path)
 	if err != nil {
 		return LargeFile{}, err
 	}
 
-	return LargeFile{
+	defer func(f *os.File) {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}(file)
+
+	metadata, err := readLocalLargeFileMetadata(path, id)
+	if err != nil {
+		return LargeFile{}, err
+	}
+
+	var size int64
+	for i := range checksums {
+		if err = ctx.Err(); err != nil {
+			return LargeFile{}, err
+		}
+
+		contents, err := os.ReadFile(fmt.Sprintf("%s/%d", partsPath, i+1))
+		if err != nil {
+			return LargeFile{}, err
+		}
+
+		contents = contents[sha1.Size*2:]
+
+		// Each encrypted part becomes a segment of the file with its own IV
+		if metadata.Encryption.isCustomerKey() {
+			metadata.Encryption.Segments = append(
+				metadata.Encryption.Segments,
+				localCipherSegment{Offset: size, IV: contents[:aes.BlockSize]})
+			contents = contents[aes.BlockSize:]
+		}
+
+		if _, err = file.Write(contents); err != nil {
+			return LargeFile{}, err
+		}
+
+		size += int64(len(contents))
+	}
+
+	if err = file.Close(); err != nil {
+		return LargeFile{}, err
+	} else if err = os.Rename(file.Name(), filePath); err != nil {
+		return LargeFile{}, err
+	}
+
+	bucketID, filename := splitLocalFileID(path, id)
+
+	// Like B2, large files have no checksum of their own, so they aren't
+	// hashed when being opened later on
+	metadata.ContentSha1 = "none"
+	if err = writeLocalFileMetadata(path, id, metadata); err != nil {
+		return LargeFile{}, err
+	} else if err = os.RemoveAll(partsPath); err != nil {
+		return LargeFile{}, err
+	} else if err = os.RemoveAll(partsPath + ".json"); err != nil {
+		return LargeFile{}, err
+	} else if _, err = unhideLocalFile(path, id); err != nil {
+		return LargeFile{}, err
+	}
+
+	largeFile := LargeFile{
+		Action:        ActionUpload,
 		FileID:        id,
-		FileName:      id,
-		BucketID:      id,
-		ContentLength: stat.Size(),
-	}, nil
+		FileName:      filename,
+		BucketID:      bucketID,
+		ContentLength: size,
+		ContentSha1:   metadata.ContentSha1,
+		ContentType:   metadata.ContentType,
+		FileInfo:      metadata.FileInfo,
+	}
+
+	largeFile.ServerSideEncryption, largeFile.FileRetention, largeFile.LegalHold =
+		metadata.fileFields()
+	return largeFile, nil
 }
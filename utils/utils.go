@@ -1,8 +1,11 @@
 package utils
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -11,9 +14,21 @@ import (
 
 const APIPrefix string = "b2api"
 
-var Client = &http.Client{Timeout: 10 * time.Second}
+// Client has no overall timeout, since that would include the time spent
+// streaming a file's contents. Instead, the transport stops waiting for B2 to
+// respond after ResponseHeaderTimeout, and contexts can be used to limit the
+// length of a request.
+var Client = &http.Client{Transport: newTransport()}
 var B2Error = errors.New("b2 client error")
 var StorageError = errors.New("local storage has been exceeded")
+var ChecksumError = errors.New("downloaded file checksum does not match")
+var SignatureError = errors.New("event notification signature does not match")
+
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = time.Minute
+	return transport
+}
 
 func CheckDirSize(path string) (int64, error) {
 	var size int64
@@ -35,7 +50,56 @@ func FormatB2URL(apiURL, apiVersion, endpoint string) string {
 		apiURL, APIPrefix, apiVersion, endpoint)
 }
 
+// NewB2Error wraps an error with an additional message.
+//
+// Deprecated: Errors returned by B2 and dummy accounts are *b2.APIError
+// values, which can be inspected with errors.As or matched with errors.Is.
 func NewB2Error(err error, errMsg string) error {
 	fullMsg := fmt.Sprintf("B2 Error: %v\n%s", err, errMsg)
 	return errors.New(fullMsg)
 }
+
+// ReadJSONFile decodes the JSON contents of the file at path into v.
+func ReadJSONFile(path string, v any) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(contents, v)
+}
+
+// WriteJSONFile encodes v as JSON and writes it to the file at path, creating
+// any missing parent directories along the way.
+func WriteJSONFile(path string, v any) error {
+	contents, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, contents, 0600)
+}
+
+// contextReader is an io.Reader that stops reading once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.r.Read(p)
+}
+
+// NewContextReader wraps an io.Reader so that reads fail with the context's
+// error once the context is canceled or its deadline is exceeded.
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return contextReader{ctx: ctx, r: r}
+}